@@ -0,0 +1,47 @@
+package dnsnameresolver
+
+import (
+	"sync"
+	"time"
+)
+
+// addressAgeTracker records, per DNS name, when each resolved address was
+// first observed, so applyMaxAddressAge can measure how long an address
+// has stayed continuously resolved independent of how many times its TTL
+// has since been refreshed.
+type addressAgeTracker struct {
+	mu        sync.Mutex
+	firstSeen map[string]map[string]time.Time
+}
+
+func newAddressAgeTracker() *addressAgeTracker {
+	return &addressAgeTracker{firstSeen: make(map[string]map[string]time.Time)}
+}
+
+// observe returns the time ip was first seen for dnsName, recording now as
+// that time if this is the first observation.
+func (t *addressAgeTracker) observe(dnsName, ip string, now time.Time) time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byIP, ok := t.firstSeen[dnsName]
+	if !ok {
+		byIP = make(map[string]time.Time)
+		t.firstSeen[dnsName] = byIP
+	}
+	if seen, ok := byIP[ip]; ok {
+		return seen
+	}
+	byIP[ip] = now
+	return now
+}
+
+// reset discards ip's tracked first-seen time for dnsName, so the next
+// observe call treats it as newly seen. Used once an address hits its
+// hard maximum age, so its age clock restarts rather than tripping the
+// same threshold on every subsequent refresh.
+func (t *addressAgeTracker) reset(dnsName, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.firstSeen[dnsName], ip)
+}
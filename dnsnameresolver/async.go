@@ -0,0 +1,76 @@
+package dnsnameresolver
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+// asyncStatusUpdateQueueSize bounds how many status updates may be in
+// flight at once when the asyncStatusUpdate directive is set, so a burst
+// of queries can't spawn unbounded goroutines against the apiserver.
+// Updates that arrive once the queue is full are dropped rather than
+// queued, since ServeDNS has already returned the response by the time
+// they'd run.
+var asyncStatusUpdateQueueSize int
+
+// shutdownFlushTimeout bounds how long OnFinalShutdown waits for
+// in-flight asyncStatusUpdate updates (see asyncUpdateQueue.drain) to
+// finish writing before giving up and letting shutdown proceed anyway.
+var shutdownFlushTimeout time.Duration
+
+func init() {
+	flag.IntVar(&asyncStatusUpdateQueueSize, "async-status-update-queue-size", 256,
+		"Maximum number of status updates that may be in flight at once when the asyncStatusUpdate directive is set. Updates beyond this are dropped and logged.")
+	flag.DurationVar(&shutdownFlushTimeout, "shutdown-flush-timeout", 5*time.Second,
+		"How long graceful shutdown waits for in-flight asyncStatusUpdate updates to finish writing to the apiserver before giving up and shutting down anyway.")
+}
+
+// asyncUpdateQueue bounds the number of concurrently in-flight background
+// status updates a plugin instance will run when asyncStatusUpdate is
+// enabled.
+type asyncUpdateQueue struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newAsyncUpdateQueue(size int) *asyncUpdateQueue {
+	return &asyncUpdateQueue{slots: make(chan struct{}, size)}
+}
+
+// tryRun starts fn in its own goroutine and reports true, unless the
+// queue is already at capacity, in which case it does nothing and
+// reports false.
+func (q *asyncUpdateQueue) tryRun(fn func()) bool {
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		return false
+	}
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		defer func() { <-q.slots }()
+		fn()
+	}()
+	return true
+}
+
+// drain waits for every update tryRun has already started to finish,
+// e.g. so a graceful shutdown doesn't cut a still-running status update
+// short and lose it. It reports whether every update finished before
+// timeout elapsed; on false, shutdown proceeds anyway with some updates
+// still in flight; they will be retried on the next resolution.
+func (q *asyncUpdateQueue) drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,118 @@
+package dnsnameresolver
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+// PluginConfig is a snapshot of the effective, already-parsed
+// configuration a running OCPDNSNameResolver instance is using. It
+// exists so operators (and tests) can ask "what is this plugin actually
+// running with" without reaching into unexported fields.
+type PluginConfig struct {
+	Namespaces                []string
+	UpdateTimeout             time.Duration
+	AnswerLimit               int
+	FollowSRV                 bool
+	FollowSVCB                bool
+	FailOnUpdateError         bool
+	ClearUnwatchedStatus      bool
+	ApplyMode                 string
+	SearchSuffixes            []string
+	Zones                     []string
+	WildcardSubdomainTracking bool
+	AsyncStatusUpdate         bool
+	LogSkippedQueries         bool
+	LogUpdateDecisions        bool
+	SchedulerStateNamespace   string
+	SchedulerStateConfigMap   string
+	ClientCIDRs               []*net.IPNet
+	RequireRecursionDesired   bool
+	DisableWildcards          bool
+	TTLRoundingSeconds        uint32
+	FamilyOrder               string
+	ManagedBySelector         string
+	FailureRcodes             []int
+	RcodeMessages             map[int]string
+	APIVersion                string
+	InstanceAnnotationKey     string
+	MaxStatusBytes            int
+	NodataCountsAsFailure     bool
+	ExportPath                string
+	WildcardGroupRefresh      bool
+	FailureThreshold          int
+	DedupeResolvedAddresses   bool
+	TrackPTR                  bool
+	RequireAuthoritative      bool
+	Tracing                   bool
+	ZeroTTLPolicy             string
+	ZeroTTLMinimum            uint32
+	MaxAddressAge             time.Duration
+	ProcessingBudget          time.Duration
+	WarmupPeriod              time.Duration
+}
+
+// Config returns a snapshot of h's effective configuration.
+func (h *OCPDNSNameResolver) Config() PluginConfig {
+	h.namespacesMu.RLock()
+	namespaces := h.namespaces.list()
+	h.namespacesMu.RUnlock()
+
+	return PluginConfig{
+		Namespaces:                namespaces,
+		UpdateTimeout:             h.updateTimeout,
+		AnswerLimit:               h.answerLimit,
+		FollowSRV:                 h.followSRV,
+		FollowSVCB:                h.followSVCB,
+		FailOnUpdateError:         h.failOnUpdateError,
+		ClearUnwatchedStatus:      h.clearUnwatchedStatus,
+		ApplyMode:                 h.applyMode,
+		SearchSuffixes:            h.searchSuffixes,
+		Zones:                     h.zones,
+		WildcardSubdomainTracking: h.wildcardSubdomainTracking,
+		AsyncStatusUpdate:         h.asyncStatusUpdate,
+		LogSkippedQueries:         h.logSkippedQueries,
+		LogUpdateDecisions:        h.logUpdateDecisions,
+		SchedulerStateNamespace:   h.schedulerStateNamespace,
+		SchedulerStateConfigMap:   h.schedulerStateConfigMapName,
+		ClientCIDRs:               h.clientCIDRs,
+		RequireRecursionDesired:   h.requireRecursionDesired,
+		DisableWildcards:          h.disableWildcards,
+		TTLRoundingSeconds:        h.ttlRoundingSeconds,
+		FamilyOrder:               h.familyOrder,
+		ManagedBySelector:         h.managedBySelectorRaw,
+		FailureRcodes:             sortedRcodes(h.failureRcodes),
+		RcodeMessages:             h.rcodeMessages,
+		APIVersion:                h.apiVersion,
+		InstanceAnnotationKey:     h.instanceAnnotationKey,
+		MaxStatusBytes:            h.maxStatusBytes,
+		NodataCountsAsFailure:     h.nodataCountsAsFailure,
+		ExportPath:                h.exportPath,
+		WildcardGroupRefresh:      h.wildcardGroupRefresh,
+		FailureThreshold:          h.failureThreshold,
+		DedupeResolvedAddresses:   h.dedupeResolvedAddresses,
+		TrackPTR:                  h.trackPTR,
+		RequireAuthoritative:      h.requireAuthoritative,
+		Tracing:                   h.tracingEnabled,
+		ZeroTTLPolicy:             h.zeroTTLPolicy,
+		ZeroTTLMinimum:            h.zeroTTLMinimum,
+		MaxAddressAge:             h.maxAddressAge,
+		ProcessingBudget:          h.processingBudget,
+		WarmupPeriod:              h.warmupPeriod,
+	}
+}
+
+// sortedRcodes returns rcodes' keys in ascending order, so Config()'s
+// output doesn't depend on map iteration order.
+func sortedRcodes(rcodes map[int]bool) []int {
+	if len(rcodes) == 0 {
+		return nil
+	}
+	sorted := make([]int, 0, len(rcodes))
+	for rcode := range rcodes {
+		sorted = append(sorted, rcode)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
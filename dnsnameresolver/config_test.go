@@ -0,0 +1,169 @@
+package dnsnameresolver
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/miekg/dns"
+)
+
+// TestConfigMatchesParse asserts that Config() reports exactly the
+// configuration parse() produced from a sample Corefile, so the two
+// can't silently drift apart as directives are added.
+func TestConfigMatchesParse(t *testing.T) {
+	input := `dnsnameresolver {
+    namespaces openshift-ingress tenant-*
+    updateTimeout 5s
+    answerLimit 10
+    followSRV
+    followSVCB
+    failOnUpdateError
+    clearUnwatchedStatus
+    applyMode serverSideApply
+    searchSuffixes svc.cluster.local. cluster.local.
+    zones example.com. example.org.
+    wildcardSubdomainTracking off
+    wildcardGroupRefresh
+    logSkippedQueries
+    logUpdateDecisions
+    persistSchedulerState openshift-dns dnsnameresolver-scheduler-state
+    clientCIDRs 10.128.0.0/14 fd01::/48
+    requireRecursionDesired
+    disableWildcards
+    ttlRounding 5
+    familyOrder v4first
+    managedBySelector app=dnsnameresolver-owner
+    failureRcodes SERVFAIL REFUSED
+    rcodeMessages SERVFAIL upstream-failure REFUSED upstream-refused
+    apiVersion network.openshift.io/v1alpha1
+    instanceAnnotation network.openshift.io/updated-by
+    maxStatusBytes 262144
+    nodataCountsAsFailure
+    exportPath /var/run/dnsnameresolver/export.json
+    failureThreshold 3
+    dedupeResolvedAddresses
+    trackPTR
+    requireAuthoritative
+    tracing
+    zeroTTLPolicy storeVolatile 30
+    maxAddressAge 720h
+    processingBudget 50ms
+    warmup 5s
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	want := PluginConfig{
+		Namespaces:              []string{"openshift-ingress", "tenant-*"},
+		UpdateTimeout:           5 * time.Second,
+		AnswerLimit:             10,
+		FollowSRV:               true,
+		FollowSVCB:              true,
+		FailOnUpdateError:       true,
+		ClearUnwatchedStatus:    true,
+		ApplyMode:               applyModeServerSideApply,
+		SearchSuffixes:          []string{"svc.cluster.local.", "cluster.local."},
+		Zones:                   []string{"example.com.", "example.org."},
+		LogSkippedQueries:       true,
+		LogUpdateDecisions:      true,
+		SchedulerStateNamespace: "openshift-dns",
+		SchedulerStateConfigMap: "dnsnameresolver-scheduler-state",
+		ClientCIDRs:             mustParseCIDRs(t, "10.128.0.0/14", "fd01::/48"),
+		RequireRecursionDesired: true,
+		DisableWildcards:        true,
+		TTLRoundingSeconds:      5,
+		FamilyOrder:             familyOrderV4First,
+		ManagedBySelector:       "app=dnsnameresolver-owner",
+		FailureRcodes:           []int{dns.RcodeServerFailure, dns.RcodeRefused},
+		RcodeMessages:           map[int]string{dns.RcodeServerFailure: "upstream-failure", dns.RcodeRefused: "upstream-refused"},
+		APIVersion:              supportedAPIVersion,
+		InstanceAnnotationKey:   "network.openshift.io/updated-by",
+		MaxStatusBytes:          262144,
+		NodataCountsAsFailure:   true,
+		ExportPath:              "/var/run/dnsnameresolver/export.json",
+		WildcardGroupRefresh:    true,
+		FailureThreshold:        3,
+		DedupeResolvedAddresses: true,
+		TrackPTR:                true,
+		RequireAuthoritative:    true,
+		Tracing:                 true,
+		ZeroTTLPolicy:           zeroTTLPolicyStoreVolatile,
+		ZeroTTLMinimum:          30,
+		MaxAddressAge:           720 * time.Hour,
+		ProcessingBudget:        50 * time.Millisecond,
+		WarmupPeriod:            5 * time.Second,
+	}
+
+	if got := h.Config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Config() = %+v, want %+v", got, want)
+	}
+}
+
+// TestConfigAsyncStatusUpdate asserts that Config() reports
+// asyncStatusUpdate, which can't share a Corefile with failOnUpdateError
+// (see TestParseRejectsAsyncStatusUpdateWithFailOnUpdateError) so it gets
+// its own sample Corefile rather than joining TestConfigMatchesParse.
+func TestConfigAsyncStatusUpdate(t *testing.T) {
+	input := `dnsnameresolver {
+    asyncStatusUpdate
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	want := PluginConfig{
+		UpdateTimeout:             defaultUpdateTimeout,
+		ApplyMode:                 applyModeUpdateStatus,
+		WildcardSubdomainTracking: true,
+		AsyncStatusUpdate:         true,
+		APIVersion:                supportedAPIVersion,
+		FailureThreshold:          1,
+	}
+
+	if got := h.Config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Config() = %+v, want %+v", got, want)
+	}
+}
+
+// TestConfigDefaults asserts Config() reports New()'s defaults when no
+// directives are given.
+func TestConfigDefaults(t *testing.T) {
+	h := New()
+
+	want := PluginConfig{
+		UpdateTimeout:             defaultUpdateTimeout,
+		ApplyMode:                 applyModeUpdateStatus,
+		WildcardSubdomainTracking: true,
+		APIVersion:                supportedAPIVersion,
+		FailureThreshold:          1,
+	}
+
+	if got := h.Config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Config() = %+v, want %+v", got, want)
+	}
+}
+
+// mustParseCIDRs parses each CIDR string, failing the test on error, for
+// building the []*net.IPNet a want PluginConfig compares against.
+func mustParseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("net.ParseCIDR(%q) error = %v", cidr, err)
+		}
+		nets[i] = ipNet
+	}
+	return nets
+}
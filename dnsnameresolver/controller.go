@@ -0,0 +1,196 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// reconcileBaseDelay and reconcileMaxDelay tune the per-key exponential
+// backoff controller-runtime applies when a DNSNameResolver reconcile is
+// requeued (on error, or an explicit RequeueAfter), so a single hot
+// object that keeps getting requeued doesn't spin the reconciler as fast
+// as it can loop. This doesn't throttle the initial reconcile triggered
+// by a watch event on every apiserver update to the object; there's no
+// requeue to rate-limit in that case.
+var reconcileBaseDelay time.Duration
+var reconcileMaxDelay time.Duration
+
+// reconcileResyncInterval, when non-zero, makes every successful
+// DNSNameResolver reconcile requeue itself after this interval, on top of
+// the normal watch-driven reconciles. This repo has no separate
+// controller that manages the DNSNameResolver CustomResourceDefinition's
+// own lifecycle (the CRD is installed by the OpenShift cluster network
+// operator, not by this plugin), so there's nothing here that "re-ensures
+// the CRD" the way a missed watch event might call for; what a missed
+// event on the actual reconciled objects does risk is this plugin's
+// in-memory cache drifting from the apiserver. A periodic resync bounds
+// how long that drift can last without depending on the watch alone.
+// Zero by default, matching this reconciler's long-standing
+// watch-only behavior.
+var reconcileResyncInterval time.Duration
+
+// maxConcurrentReconciles bounds how many DNSNameResolver reconciles the
+// controller runs at once, both during the initial reconcile surge right
+// after the manager's cache finishes its first sync (when every existing
+// object in scope queues up together) and in ongoing steady-state
+// operation. controller-runtime defaults this to 1; a larger inventory
+// can raise it to reconcile that initial backlog faster, at the cost of
+// more concurrent apiserver traffic from this plugin instance.
+var maxConcurrentReconciles int
+
+func init() {
+	flag.DurationVar(&reconcileBaseDelay, "reconcile-base-delay", 5*time.Millisecond,
+		"Base delay of the rate limiter applied to requeued DNSNameResolver reconciles.")
+	flag.DurationVar(&reconcileMaxDelay, "reconcile-max-delay", 1000*time.Second,
+		"Maximum delay of the rate limiter applied to requeued DNSNameResolver reconciles.")
+	flag.DurationVar(&reconcileResyncInterval, "reconcile-resync-interval", 0,
+		"If non-zero, periodically re-reconcile every DNSNameResolver object at this interval, in addition to watch-driven reconciles. Disabled (0) by default.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Maximum number of DNSNameResolver reconciles the controller runs concurrently, including the initial reconcile surge right after startup.")
+}
+
+// reconcileRateLimiter returns the workqueue rate limiter the controller
+// uses for the DNSNameResolver reconciler.
+func reconcileRateLimiter() workqueue.RateLimiter {
+	return workqueue.NewItemExponentialFailureRateLimiter(reconcileBaseDelay, reconcileMaxDelay)
+}
+
+// reconciler keeps the plugin's in-memory object cache in sync with the
+// DNSNameResolver objects that exist in the configured namespaces.
+type reconciler struct {
+	client client.Client
+	plugin *OCPDNSNameResolver
+}
+
+// reconcilerOptions returns the controller.Options the DNSNameResolver
+// controller is built with, factored out of addToManager so the wiring
+// between the --max-concurrent-reconciles flag and controller-runtime is
+// testable without standing up a real manager.
+func reconcilerOptions() controller.Options {
+	return controller.Options{RateLimiter: reconcileRateLimiter(), MaxConcurrentReconciles: maxConcurrentReconciles}
+}
+
+// addToManager registers the reconciler with mgr so that it starts
+// receiving DNSNameResolver events once the manager runs.
+func (h *OCPDNSNameResolver) addToManager(mgr manager.Manager) error {
+	r := &reconciler{client: mgr.GetClient(), plugin: h}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&networkv1alpha1.DNSNameResolver{}).
+		WithOptions(reconcilerOptions()).
+		Complete(r)
+}
+
+func (r *reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if !r.plugin.configuredNamespace(req.Namespace) {
+		if r.plugin.clearUnwatchedStatus {
+			return ctrl.Result{}, r.clearStatus(ctx, req.NamespacedName)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// Deletion is detected by re-Get-ing the object and checking
+	// IsNotFound, rather than by a raw informer DeleteFunc callback
+	// receiving the last known object (or a cache.DeletedFinalStateUnknown
+	// tombstone if the delete event was missed before that). That's a
+	// controller-runtime convention this reconciler follows throughout, so
+	// there's no delete-handler type assertion here to lose track of a
+	// tombstoned object; removeObject always runs off a namespace/name
+	// this Reconcile call was actually invoked with.
+	var resolver networkv1alpha1.DNSNameResolver
+	if err := r.client.Get(ctx, req.NamespacedName, &resolver); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.plugin.removeObject(req.Namespace, req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !r.plugin.objectManaged(resolver.Labels) {
+		// Either this object never matched --managedBySelector, or it did
+		// and was since relabeled out from under it; either way, this
+		// plugin must not go on updating (or start updating) its status.
+		r.plugin.removeObject(req.Namespace, req.Name)
+		return ctrl.Result{}, nil
+	}
+
+	dnsName := string(resolver.Spec.Name)
+	isWildcard := strings.HasPrefix(dnsName, "*.")
+	wasTracked := r.plugin.hasObject(req.Namespace, req.Name)
+	if prevDNSName, prevIsWildcard, ok := r.plugin.trackedSpec(req.Namespace, req.Name); ok && (prevDNSName != dnsName || prevIsWildcard != isWildcard) {
+		// A tracked object's spec changing between reconciles means either
+		// a watch event was missed (a live edit landed while this
+		// controller was down or its watch connection was disrupted) or
+		// this is the periodic reconcileResyncInterval requeue catching up
+		// on a change the watch itself should have already delivered.
+		// Either way, the cache above was already stale until this
+		// reconcile ran.
+		specDriftTotal.Inc()
+		clog.Warningf("dnsnameresolver: %s/%s spec.name changed from %q to %q since last reconciled; a watch event may have been missed", req.Namespace, req.Name, prevDNSName, dnsName)
+	}
+	r.plugin.addOrUpdateObject(req.Namespace, req.Name, dnsName, isWildcard)
+
+	if wasTracked && statusLooksTampered(&resolver, dnsName) {
+		externalStatusEditsDetectedTotal.Inc()
+		clog.Warningf("dnsnameresolver: %s/%s status resolved addresses for %q were cleared without this plugin's involvement; scheduling a corrective lookup", req.Namespace, req.Name, dnsName)
+		r.plugin.resolver.ScheduleNow(dnsName)
+	}
+
+	return ctrl.Result{RequeueAfter: reconcileResyncInterval}, nil
+}
+
+// clearStatus wipes the resolved-name status of a DNSNameResolver object
+// that's no longer in a namespace this plugin instance is configured to
+// watch (e.g. after the `namespaces` directive changed across a
+// Corefile reload), so it stops presenting IPs the plugin has stopped
+// maintaining.
+func (r *reconciler) clearStatus(ctx context.Context, key client.ObjectKey) error {
+	var resolverObj networkv1alpha1.DNSNameResolver
+	if err := r.client.Get(ctx, key, &resolverObj); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if len(resolverObj.Status.ResolvedNames) == 0 {
+		return nil
+	}
+
+	newResolverObj := resolverObj.DeepCopy()
+	newResolverObj.Status.ResolvedNames = nil
+	return r.client.Status().Update(ctx, newResolverObj)
+}
+
+// reconcileAllNow lists every DNSNameResolver object across the cluster
+// and adopts each one that's in scope (configuredNamespace and
+// objectManaged) directly, bypassing the rate-limited workqueue a watch
+// event normally arrives through. It's meant to run once, right after
+// the manager's cache finishes its initial sync, so a namespace added to
+// the namespaces directive on this reload gets its existing objects
+// adopted immediately instead of trickling in only as each object's own
+// initial watch event works its way through reconcileRateLimiter.
+func (h *OCPDNSNameResolver) reconcileAllNow(ctx context.Context, c client.Client) error {
+	var list networkv1alpha1.DNSNameResolverList
+	if err := c.List(ctx, &list); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if !h.configuredNamespace(obj.Namespace) || !h.objectManaged(obj.Labels) {
+			continue
+		}
+		dnsName := string(obj.Spec.Name)
+		h.addOrUpdateObject(obj.Namespace, obj.Name, dnsName, strings.HasPrefix(dnsName, "*."))
+	}
+	return nil
+}
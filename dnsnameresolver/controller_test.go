@@ -0,0 +1,445 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestReconcileClearsUnwatchedStatus verifies that, with
+// clearUnwatchedStatus enabled, an object in a namespace the plugin
+// instance is no longer configured to watch has its resolved-name
+// status wiped rather than silently left stale.
+func TestReconcileClearsUnwatchedStatus(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "excluded"
+	resolverObj.Name = "obj1"
+	resolverObj.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "foo.example.com."},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := &OCPDNSNameResolver{
+		namespaces:           parseNamespaces([]string{"kept"}),
+		clearUnwatchedStatus: true,
+	}
+	r := &reconciler{client: fakeClient, plugin: h}
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(resolverObj)}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, &got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 0 {
+		t.Fatalf("Status.ResolvedNames after Reconcile() = %v, want cleared", got.Status.ResolvedNames)
+	}
+}
+
+// TestReconcileLeavesUnwatchedStatusByDefault verifies that without
+// clearUnwatchedStatus, an object in an unconfigured namespace is left
+// untouched, matching the plugin's long-standing default behavior.
+func TestReconcileLeavesUnwatchedStatusByDefault(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "excluded"
+	resolverObj.Name = "obj1"
+	resolverObj.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "foo.example.com."},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := &OCPDNSNameResolver{namespaces: parseNamespaces([]string{"kept"})}
+	r := &reconciler{client: fakeClient, plugin: h}
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(resolverObj)}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, &got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames after Reconcile() = %v, want left untouched", got.Status.ResolvedNames)
+	}
+}
+
+// TestReconcileRateLimiterThrottlesRepeatedKey verifies that repeated
+// requeues of the same DNSNameResolver key back off with increasing
+// delay, bounded by reconcileMaxDelay, rather than being requeued as
+// fast as the workqueue can loop.
+func TestReconcileRateLimiterThrottlesRepeatedKey(t *testing.T) {
+	oldBase, oldMax := reconcileBaseDelay, reconcileMaxDelay
+	defer func() { reconcileBaseDelay, reconcileMaxDelay = oldBase, oldMax }()
+	reconcileBaseDelay = 10 * time.Millisecond
+	reconcileMaxDelay = 40 * time.Millisecond
+
+	rl := reconcileRateLimiter()
+	key := ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "ns1", Name: "obj1"}}
+
+	first := rl.When(key)
+	second := rl.When(key)
+	third := rl.When(key)
+
+	if first < reconcileBaseDelay {
+		t.Errorf("first requeue delay = %v, want at least the base delay %v", first, reconcileBaseDelay)
+	}
+	if second <= first {
+		t.Errorf("second requeue delay %v did not increase over the first %v", second, first)
+	}
+	if third > reconcileMaxDelay {
+		t.Errorf("third requeue delay %v exceeded reconcileMaxDelay %v", third, reconcileMaxDelay)
+	}
+
+	rl.Forget(key)
+	if got := rl.NumRequeues(key); got != 0 {
+		t.Errorf("NumRequeues() after Forget() = %d, want 0", got)
+	}
+}
+
+// TestReconcilerOptionsAppliesMaxConcurrentReconciles verifies that
+// --max-concurrent-reconciles is wired straight through to the
+// controller's MaxConcurrentReconciles option.
+func TestReconcilerOptionsAppliesMaxConcurrentReconciles(t *testing.T) {
+	old := maxConcurrentReconciles
+	defer func() { maxConcurrentReconciles = old }()
+	maxConcurrentReconciles = 8
+
+	if got := reconcilerOptions().MaxConcurrentReconciles; got != 8 {
+		t.Errorf("reconcilerOptions().MaxConcurrentReconciles = %d, want 8", got)
+	}
+}
+
+// TestReconcileSchedulesPeriodicResync verifies that a successful
+// reconcile requeues itself after reconcileResyncInterval when that flag
+// is set, so the plugin's cache resyncs periodically even if a future
+// watch event is missed.
+func TestReconcileSchedulesPeriodicResync(t *testing.T) {
+	oldInterval := reconcileResyncInterval
+	defer func() { reconcileResyncInterval = oldInterval }()
+	reconcileResyncInterval = 10 * time.Minute
+
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "kept"
+	resolverObj.Name = "obj1"
+	resolverObj.Spec.Name = "example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	h := &OCPDNSNameResolver{namespaces: parseNamespaces([]string{"kept"})}
+	r := &reconciler{client: fakeClient, plugin: h}
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(resolverObj)}
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != reconcileResyncInterval {
+		t.Errorf("Reconcile() RequeueAfter = %v, want %v", result.RequeueAfter, reconcileResyncInterval)
+	}
+}
+
+// TestReconcileNoResyncByDefault verifies that with
+// reconcileResyncInterval at its zero-value default, a successful
+// reconcile doesn't schedule a requeue, matching this reconciler's
+// long-standing watch-only behavior.
+func TestReconcileNoResyncByDefault(t *testing.T) {
+	oldInterval := reconcileResyncInterval
+	defer func() { reconcileResyncInterval = oldInterval }()
+	reconcileResyncInterval = 0
+
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "kept"
+	resolverObj.Name = "obj1"
+	resolverObj.Spec.Name = "example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	h := &OCPDNSNameResolver{namespaces: parseNamespaces([]string{"kept"})}
+	r := &reconciler{client: fakeClient, plugin: h}
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(resolverObj)}
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != 0 {
+		t.Errorf("Reconcile() RequeueAfter = %v, want 0", result.RequeueAfter)
+	}
+}
+
+// TestReconcileTracksOwnedObject verifies that with managedBySelector
+// set, a DNSNameResolver object whose labels satisfy it is tracked
+// normally.
+func TestReconcileTracksOwnedObject(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "kept"
+	resolverObj.Name = "obj1"
+	resolverObj.Labels = map[string]string{"app": "dnsnameresolver-owner"}
+	resolverObj.Spec.Name = "example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	h := &OCPDNSNameResolver{
+		namespaces:        parseNamespaces([]string{"kept"}),
+		managedBySelector: labels.SelectorFromSet(labels.Set{"app": "dnsnameresolver-owner"}),
+		objects:           make(map[string]*object),
+		byName:            make(map[string]map[string]*object),
+		wildcards:         make(map[string]map[string]*object),
+	}
+	r := &reconciler{client: fakeClient, plugin: h}
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(resolverObj)}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if matches := h.matchingObjects("example.com."); len(matches) != 1 {
+		t.Fatalf("matchingObjects() after reconciling an owned object = %v, want 1 match", matches)
+	}
+}
+
+// TestReconcileSkipsUnownedObject verifies that with managedBySelector
+// set, a DNSNameResolver object whose labels don't satisfy it is never
+// tracked, so this plugin can't clobber another controller's status
+// updates to it.
+func TestReconcileSkipsUnownedObject(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "kept"
+	resolverObj.Name = "obj1"
+	resolverObj.Labels = map[string]string{"app": "someone-else"}
+	resolverObj.Spec.Name = "example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	h := &OCPDNSNameResolver{
+		namespaces:        parseNamespaces([]string{"kept"}),
+		managedBySelector: labels.SelectorFromSet(labels.Set{"app": "dnsnameresolver-owner"}),
+		objects:           make(map[string]*object),
+		byName:            make(map[string]map[string]*object),
+		wildcards:         make(map[string]map[string]*object),
+	}
+	r := &reconciler{client: fakeClient, plugin: h}
+
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(resolverObj)}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if matches := h.matchingObjects("example.com."); len(matches) != 0 {
+		t.Fatalf("matchingObjects() after reconciling an unowned object = %v, want no matches", matches)
+	}
+}
+
+// TestReconcileRemovesDeletedObject verifies that reconciling a
+// namespaced name no longer present on the apiserver (the fake client
+// returns IsNotFound, the same as after a real delete) removes the
+// object from every tracking map, so a deleted DNSNameResolver doesn't
+// leak an entry that keeps it resolved forever.
+func TestReconcileRemovesDeletedObject(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		namespaces: parseNamespaces([]string{"kept"}),
+		objects:    make(map[string]*object),
+		byName:     make(map[string]map[string]*object),
+		wildcards:  make(map[string]map[string]*object),
+	}
+	h.addOrUpdateObject("kept", "obj1", "example.com.", false)
+	if !h.hasObject("kept", "obj1") {
+		t.Fatalf("hasObject() = false before delete, want true")
+	}
+
+	fakeClient := fake.NewClientBuilder().Build()
+	r := &reconciler{client: fakeClient, plugin: h}
+
+	req := ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "kept", Name: "obj1"}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if h.hasObject("kept", "obj1") {
+		t.Errorf("hasObject() = true after reconciling a deleted object, want false")
+	}
+	if matches := h.matchingObjects("example.com."); len(matches) != 0 {
+		t.Errorf("matchingObjects() after reconciling a deleted object = %v, want no matches", matches)
+	}
+}
+
+// TestReconcileSchedulesCorrectiveLookupOnManualStatusEdit verifies that
+// when a tracked DNSNameResolver's resolved addresses are cleared by
+// something other than this plugin (no NoAddresses condition to account
+// for it), Reconcile brings the name's next proactive lookup forward
+// instead of waiting for its normal TTL-driven schedule.
+func TestReconcileSchedulesCorrectiveLookupOnManualStatusEdit(t *testing.T) {
+	lookupCalled := make(chan struct{}, 10)
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookupCalled <- struct{}{}
+		return map[string]ipTTL{"192.0.2.1": {ip: "192.0.2.1", ttl: 300}}, 0, nil
+	}, nil)
+
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "kept"
+	resolverObj.Name = "obj1"
+	resolverObj.Spec.Name = "example.com."
+	resolverObj.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{
+			DNSName:           "example.com.",
+			ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "192.0.2.1"}},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := &OCPDNSNameResolver{
+		namespaces: parseNamespaces([]string{"kept"}),
+		objects:    make(map[string]*object),
+		byName:     make(map[string]map[string]*object),
+		wildcards:  make(map[string]map[string]*object),
+		resolver:   r,
+	}
+	rec := &reconciler{client: fakeClient, plugin: h}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(resolverObj)}
+
+	if _, err := rec.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	select {
+	case <-lookupCalled:
+	case <-time.After(time.Second):
+		t.Fatal("initial Add-triggered lookup never ran")
+	}
+
+	before := readCounter(t, externalStatusEditsDetectedTotal)
+
+	var toEdit networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, &toEdit); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	toEdit.Status.ResolvedNames[0].ResolvedAddresses = nil
+	if err := fakeClient.Status().Update(context.Background(), &toEdit); err != nil {
+		t.Fatalf("Status().Update() error = %v", err)
+	}
+
+	if _, err := rec.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("second Reconcile() error = %v", err)
+	}
+
+	if after := readCounter(t, externalStatusEditsDetectedTotal); after != before+1 {
+		t.Errorf("externalStatusEditsDetectedTotal = %v, want %v", after, before+1)
+	}
+
+	r.mu.Lock()
+	nextLookupTime := r.dnsNames["example.com."].nextLookupTime
+	r.mu.Unlock()
+	if nextLookupTime.After(time.Now()) {
+		t.Errorf("nextLookupTime = %v, want brought forward to no later than now", nextLookupTime)
+	}
+}
+
+// TestReconcileDetectsSpecDrift verifies that when a tracked
+// DNSNameResolver's spec.name changes between reconciles without this
+// plugin having seen an intervening watch event for the change (e.g. one
+// was missed), Reconcile counts it as drift and updates its cache to the
+// new name.
+func TestReconcileDetectsSpecDrift(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "kept"
+	resolverObj.Name = "obj1"
+	resolverObj.Spec.Name = "example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	h := &OCPDNSNameResolver{
+		namespaces: parseNamespaces([]string{"kept"}),
+		objects:    make(map[string]*object),
+		byName:     make(map[string]map[string]*object),
+		wildcards:  make(map[string]map[string]*object),
+	}
+	r := &reconciler{client: fakeClient, plugin: h}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(resolverObj)}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	before := readCounter(t, specDriftTotal)
+
+	var toEdit networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), req.NamespacedName, &toEdit); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	toEdit.Spec.Name = "changed.example.com."
+	if err := fakeClient.Update(context.Background(), &toEdit); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("second Reconcile() error = %v", err)
+	}
+
+	if after := readCounter(t, specDriftTotal); after != before+1 {
+		t.Errorf("specDriftTotal = %v, want %v", after, before+1)
+	}
+	if matches := h.matchingObjects("changed.example.com."); len(matches) != 1 {
+		t.Errorf("matchingObjects(%q) after drift = %v, want the object tracked under its new name", "changed.example.com.", matches)
+	}
+	if dnsName, _, ok := h.trackedSpec("kept", "obj1"); !ok || dnsName != "changed.example.com." {
+		t.Errorf("trackedSpec() after drift = (%q, %v), want (%q, true)", dnsName, ok, "changed.example.com.")
+	}
+}
+
+// TestReconcileAllNowAdoptsNewlyConfiguredNamespace verifies that
+// reconcileAllNow adopts an existing object in a namespace that's just
+// been added to the namespaces directive, without waiting for that
+// object's own watch event to trigger a Reconcile call.
+func TestReconcileAllNowAdoptsNewlyConfiguredNamespace(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "newly-configured"
+	resolverObj.Name = "obj1"
+	resolverObj.Spec.Name = "example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	h := &OCPDNSNameResolver{
+		namespaces: parseNamespaces([]string{"newly-configured"}),
+		objects:    make(map[string]*object),
+		byName:     make(map[string]map[string]*object),
+		wildcards:  make(map[string]map[string]*object),
+	}
+
+	if err := h.reconcileAllNow(context.Background(), fakeClient); err != nil {
+		t.Fatalf("reconcileAllNow() error = %v", err)
+	}
+
+	if matches := h.matchingObjects("example.com."); len(matches) != 1 {
+		t.Fatalf("matchingObjects() after reconcileAllNow() = %v, want the newly-configured namespace's object adopted", matches)
+	}
+}
+
+// TestReconcileAllNowSkipsOutOfScopeObject verifies that reconcileAllNow
+// still leaves an object in a namespace outside the namespaces directive
+// untouched, matching Reconcile's own filtering.
+func TestReconcileAllNowSkipsOutOfScopeObject(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "excluded"
+	resolverObj.Name = "obj1"
+	resolverObj.Spec.Name = "example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	h := &OCPDNSNameResolver{
+		namespaces: parseNamespaces([]string{"kept"}),
+		objects:    make(map[string]*object),
+		byName:     make(map[string]map[string]*object),
+		wildcards:  make(map[string]map[string]*object),
+	}
+
+	if err := h.reconcileAllNow(context.Background(), fakeClient); err != nil {
+		t.Fatalf("reconcileAllNow() error = %v", err)
+	}
+
+	if matches := h.matchingObjects("example.com."); len(matches) != 0 {
+		t.Fatalf("matchingObjects() after reconcileAllNow() = %v, want the excluded namespace's object left untouched", matches)
+	}
+}
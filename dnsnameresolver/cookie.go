@@ -0,0 +1,71 @@
+package dnsnameresolver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// dnsCookieEnabled attaches an EDNS0 COOKIE option (RFC 7873) to outbound
+// lookups, for upstreams beyond CoreDNS itself that enforce cookies.
+var dnsCookieEnabled bool
+
+func init() {
+	flag.BoolVar(&dnsCookieEnabled, "dns-cookie", false,
+		"Attach an EDNS0 COOKIE option to outbound DNS lookups, for upstreams that require cookies.")
+}
+
+// cookieJar maintains the client cookie and per-server cookie state
+// needed to participate in RFC 7873 DNS cookies: a fixed 8-byte client
+// cookie generated once, plus the most recent 8-byte server cookie
+// returned by each server queried.
+type cookieJar struct {
+	mu      sync.Mutex
+	client  [8]byte
+	servers map[string]string // server address -> hex-encoded server cookie
+}
+
+// defaultCookieJar is shared by every lookup this process makes.
+var defaultCookieJar = newCookieJar()
+
+func newCookieJar() *cookieJar {
+	var client [8]byte
+	_, _ = rand.Read(client[:])
+	return &cookieJar{client: client, servers: make(map[string]string)}
+}
+
+// option returns the EDNS0_COOKIE to attach to a query against server,
+// combining the fixed client cookie with the last server cookie
+// observed from that server, if any.
+func (j *cookieJar) option(server string) *dns.EDNS0_COOKIE {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return &dns.EDNS0_COOKIE{
+		Code:   dns.EDNS0COOKIE,
+		Cookie: hex.EncodeToString(j.client[:]) + j.servers[server],
+	}
+}
+
+// observe records the server cookie carried by a response from server,
+// if any, so the next query to that server can present it back.
+func (j *cookieJar) observe(server string, resp *dns.Msg) {
+	if resp == nil {
+		return
+	}
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return
+	}
+	for _, o := range opt.Option {
+		c, ok := o.(*dns.EDNS0_COOKIE)
+		if !ok || len(c.Cookie) <= 16 {
+			continue
+		}
+		j.mu.Lock()
+		j.servers[server] = c.Cookie[16:]
+		j.mu.Unlock()
+	}
+}
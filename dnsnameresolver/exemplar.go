@@ -0,0 +1,53 @@
+package dnsnameresolver
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// traceIDContextKey is the context key ContextWithTraceID stores a trace
+// ID under.
+type traceIDContextKey struct{}
+
+// ContextWithTraceID returns a copy of ctx carrying traceID, so that a
+// latency histogram observation recorded against that context (see
+// observeWithExemplar) attaches it as a Prometheus exemplar, letting an
+// operator jump from a slow update in a metric straight to the
+// corresponding trace. This plugin carries no tracing SDK dependency of
+// its own; it's the caller's responsibility (e.g. an embedding CoreDNS
+// build with tracing enabled) to extract a trace ID from whatever
+// tracing context it already has and attach it here before the request
+// reaches ServeDNS. traceID being "" is a no-op.
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIDContextKey{}, traceID)
+}
+
+// traceIDFromContext returns the trace ID attached via ContextWithTraceID,
+// if any.
+func traceIDFromContext(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceIDContextKey{}).(string)
+	return traceID, ok
+}
+
+// observeWithExemplar records value against h, the way h.Observe(value)
+// would, except that when ctx carries a trace ID it's attached as an
+// exemplar under the "traceID" label, using the ExemplarObserver
+// interface prometheus's own Histogram implementation already supports.
+// This is currently only wired into the update path (updateStatus),
+// where ServeDNS's own request context reaches all the way through; the
+// proactive resolver's lookup path (sendDNSLookupRequest) runs off an
+// internal scheduler, not an inbound request, so there's no request
+// trace context to extract there.
+func observeWithExemplar(ctx context.Context, h prometheus.Histogram, value float64) {
+	if traceID, ok := traceIDFromContext(ctx); ok {
+		if eo, ok := h.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(value, prometheus.Labels{"traceID": traceID})
+			return
+		}
+	}
+	h.Observe(value)
+}
@@ -0,0 +1,68 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func exemplarTraceID(t *testing.T, m *dto.Metric) (string, bool) {
+	t.Helper()
+	for _, b := range m.GetHistogram().GetBucket() {
+		if b.Exemplar == nil {
+			continue
+		}
+		for _, l := range b.Exemplar.GetLabel() {
+			if l.GetName() == "traceID" {
+				return l.GetValue(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// TestObserveWithExemplarAttachesTraceID verifies that observing against
+// a context carrying a trace ID (via ContextWithTraceID) records that
+// trace ID as a Prometheus exemplar on the histogram.
+func TestObserveWithExemplarAttachesTraceID(t *testing.T) {
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "test_observe_with_exemplar",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	ctx := ContextWithTraceID(context.Background(), "abc123")
+	observeWithExemplar(ctx, h, 0.05)
+
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if traceID, ok := exemplarTraceID(t, &m); !ok || traceID != "abc123" {
+		t.Fatalf("exemplar traceID = %q, ok = %v, want \"abc123\", true", traceID, ok)
+	}
+}
+
+// TestObserveWithExemplarNoTraceIDRecordsPlainObservation verifies that
+// without a trace ID on ctx, the observation is still recorded, just
+// without an exemplar attached.
+func TestObserveWithExemplarNoTraceIDRecordsPlainObservation(t *testing.T) {
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "test_observe_without_exemplar",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	observeWithExemplar(context.Background(), h, 0.05)
+
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 1 {
+		t.Fatalf("SampleCount = %d, want 1", got)
+	}
+	if _, ok := exemplarTraceID(t, &m); ok {
+		t.Fatalf("exemplar recorded without a trace ID on ctx, want none")
+	}
+}
@@ -0,0 +1,131 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+)
+
+// exportInterval controls how often, when exportPath is configured, the
+// tracked DNSNameResolver objects' resolved names and addresses are
+// written out to it. It's a flag rather than a directive argument since
+// it's an operational tuning knob rather than a feature toggle, matching
+// schedulerStateSaveInterval.
+var exportInterval time.Duration
+
+func init() {
+	flag.DurationVar(&exportInterval, "export-interval", 30*time.Second,
+		"How often the tracked DNSNameResolver objects' resolved names are written to exportPath, when configured.")
+}
+
+// exportedName is one entry of the exportPath JSON dump: a tracked DNS
+// name and the addresses currently recorded for it, flattened out of
+// whichever DNSNameResolver object(s) track that name. Non-Kubernetes
+// firewall tooling that can't watch the apiserver directly is the
+// intended consumer, so the shape is deliberately minimal rather than a
+// reflection of the DNSNameResolver API.
+type exportedName struct {
+	DNSName   string   `json:"dnsName"`
+	Addresses []string `json:"addresses"`
+}
+
+// exportOnce lists every DNSNameResolver object this instance is
+// configured to watch (see configuredNamespace and objectManaged) and
+// writes their resolved names and addresses to h.exportPath as a single
+// JSON array, atomically (temp file + rename) so a reader never observes
+// a partially-written file.
+func (h *OCPDNSNameResolver) exportOnce(ctx context.Context) error {
+	var list networkv1alpha1.DNSNameResolverList
+	if err := h.client.List(ctx, &list); err != nil {
+		return err
+	}
+
+	byName := make(map[string]map[string]struct{})
+	for _, obj := range list.Items {
+		if !h.configuredNamespace(obj.Namespace) || !h.objectManaged(obj.Labels) {
+			continue
+		}
+		for _, entry := range obj.Status.ResolvedNames {
+			name := string(entry.DNSName)
+			addrs, ok := byName[name]
+			if !ok {
+				addrs = make(map[string]struct{})
+				byName[name] = addrs
+			}
+			for _, addr := range entry.ResolvedAddresses {
+				addrs[addr.IP] = struct{}{}
+			}
+		}
+	}
+
+	names := make([]exportedName, 0, len(byName))
+	for name, addrs := range byName {
+		addrList := make([]string, 0, len(addrs))
+		for addr := range addrs {
+			addrList = append(addrList, addr)
+		}
+		sort.Strings(addrList)
+		names = append(names, exportedName{DNSName: name, Addresses: addrList})
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].DNSName < names[j].DNSName })
+
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(h.exportPath, data)
+}
+
+// writeFileAtomically writes data to path by writing it to a temporary
+// file in the same directory and renaming it into place, so a reader
+// never observes a partially-written file and a crash mid-write can't
+// corrupt the previous, still-valid export.
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runExporter periodically calls exportOnce until stopCh is closed,
+// exporting once more on the way out on a best-effort basis, mirroring
+// runSchedulerStatePersistence.
+func (h *OCPDNSNameResolver) runExporter(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	export := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), h.updateTimeout)
+		defer cancel()
+		if err := h.exportOnce(ctx); err != nil {
+			clog.Warningf("dnsnameresolver: failed to export resolved names to %s: %v", h.exportPath, err)
+		}
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			export()
+			return
+		case <-ticker.C:
+			export()
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestExportOnceWritesTrackedState verifies that exportOnce writes a JSON
+// file whose content matches the resolved names and addresses currently
+// tracked across the watched DNSNameResolver objects, deduplicating
+// addresses recorded more than once and skipping objects this instance
+// isn't configured to watch or manage.
+func TestExportOnceWritesTrackedState(t *testing.T) {
+	tracked := &networkv1alpha1.DNSNameResolver{}
+	tracked.Namespace = "ns1"
+	tracked.Name = "obj1"
+	tracked.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{
+			DNSName: "foo.example.com.",
+			ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{
+				{IP: "10.0.0.1"},
+				{IP: "10.0.0.2"},
+			},
+		},
+	}
+
+	unwatched := &networkv1alpha1.DNSNameResolver{}
+	unwatched.Namespace = "ns2"
+	unwatched.Name = "obj2"
+	unwatched.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{
+			DNSName: "bar.example.com.",
+			ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{
+				{IP: "10.0.0.3"},
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithObjects(tracked, unwatched).Build()
+	h := New()
+	h.client = fakeClient
+	h.namespaces = &namespaceMatcher{exact: map[string]struct{}{"ns1": {}}}
+
+	exportPath := filepath.Join(t.TempDir(), "export.json")
+	h.exportPath = exportPath
+
+	if err := h.exportOnce(context.Background()); err != nil {
+		t.Fatalf("exportOnce() error = %v", err)
+	}
+
+	data, err := os.ReadFile(exportPath)
+	if err != nil {
+		t.Fatalf("failed to read exported file: %v", err)
+	}
+
+	var got []exportedName
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to unmarshal exported file: %v", err)
+	}
+
+	want := []exportedName{
+		{DNSName: "foo.example.com.", Addresses: []string{"10.0.0.1", "10.0.0.2"}},
+	}
+	if len(got) != len(want) || got[0].DNSName != want[0].DNSName || len(got[0].Addresses) != 2 ||
+		got[0].Addresses[0] != want[0].Addresses[0] || got[0].Addresses[1] != want[0].Addresses[1] {
+		t.Errorf("exported content = %+v, want %+v", got, want)
+	}
+}
+
+// TestWriteFileAtomicallyReplacesExistingFile verifies that
+// writeFileAtomically leaves the target path holding the new content,
+// with no leftover temp file, even when a previous export already exists
+// at that path.
+func TestWriteFileAtomicallyReplacesExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.json")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatalf("failed to seed existing file: %v", err)
+	}
+
+	if err := writeFileAtomically(path, []byte("new")); err != nil {
+		t.Fatalf("writeFileAtomically() error = %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if string(got) != "new" {
+		t.Errorf("file content = %q, want %q", got, "new")
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory entries = %v, want exactly the target file (no leftover temp file)", entries)
+	}
+}
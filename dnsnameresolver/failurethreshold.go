@@ -0,0 +1,78 @@
+package dnsnameresolver
+
+import (
+	"strconv"
+	"sync"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// failureThresholdAnnotation lets an individual DNSNameResolver object
+// override the plugin-wide failureThreshold directive. There's no
+// first-class API field for this yet; the annotation is the interim
+// mechanism until one exists.
+const failureThresholdAnnotation = "dnsnameresolver.openshift.io/failure-threshold"
+
+// effectiveFailureThreshold returns the number of consecutive update
+// failures a resolved name must accumulate before markDegraded actually
+// upserts a Degraded condition for it, honoring a per-object override via
+// failureThresholdAnnotation over deflt (the plugin-wide failureThreshold
+// directive). An override that isn't a positive integer is logged and
+// ignored, falling back to deflt, so a typo in the annotation can't
+// silently disable degraded reporting.
+func effectiveFailureThreshold(annotations map[string]string, deflt int) int {
+	raw, ok := annotations[failureThresholdAnnotation]
+	if !ok || raw == "" {
+		return deflt
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		clog.Warningf("dnsnameresolver: ignoring invalid %s annotation %q: must be a positive integer", failureThresholdAnnotation, raw)
+		return deflt
+	}
+	return n
+}
+
+// failureCounters tracks each object's consecutive update failures, keyed
+// by "namespace/name", so markDegraded can wait for failureThreshold (or
+// its per-object annotation override) consecutive failures before
+// upserting a Degraded condition instead of reacting to a single
+// transient one.
+type failureCounters struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newFailureCounters() *failureCounters {
+	return &failureCounters{counts: make(map[string]int)}
+}
+
+// recordFailure increments key's consecutive failure count and returns
+// the new total. A nil receiver (as in tests that build an
+// OCPDNSNameResolver by hand without going through New()) always returns
+// 1 rather than panicking, matching a fresh counter's first failure.
+func (f *failureCounters) recordFailure(key string) int {
+	if f == nil {
+		return 1
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[key]++
+	return f.counts[key]
+}
+
+// recordSuccess resets key's consecutive failure count to zero and
+// reports whether key had accumulated any failures beforehand, so a
+// caller can tell a genuine recovery (there were failures to clear) from
+// a success that follows a run of other successes (nothing to do). A nil
+// receiver is a no-op that reports false.
+func (f *failureCounters) recordSuccess(key string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	hadFailures := f.counts[key] > 0
+	delete(f.counts, key)
+	return hadFailures
+}
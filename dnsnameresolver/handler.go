@@ -0,0 +1,1804 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coredns/coredns/plugin"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/coredns/coredns/plugin/pkg/nonwriter"
+	"github.com/coredns/coredns/request"
+	"github.com/miekg/dns"
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// defaultUpdateTimeout bounds how long ServeDNS waits on status updates
+// when the Corefile doesn't set updateTimeout explicitly.
+const defaultUpdateTimeout = 2 * time.Second
+
+// applyMode values for the `applyMode` directive, selecting how
+// updateStatus persists a DNSNameResolver object's status.
+const (
+	// applyModeUpdateStatus does a conventional Get/DeepCopy/Status().Update
+	// read-modify-write. It's the default, and conflicts on the object's
+	// ResourceVersion regardless of which fields actually changed.
+	applyModeUpdateStatus = "updateStatus"
+	// applyModeServerSideApply instead does a Status().Patch with
+	// client.Apply and a dedicated field manager, which only conflicts
+	// with another manager that owns the same fields. This avoids
+	// spurious conflicts on hot objects that several controllers (or
+	// several dnsnameresolver replicas) update concurrently.
+	applyModeServerSideApply = "serverSideApply"
+)
+
+// familyOrder values for the `familyOrder` directive, selecting the sort
+// order applied to a DNSNameResolver object's ResolvedAddresses before
+// they're written.
+const (
+	// familyOrderV4First sorts IPv4 addresses before IPv6 addresses.
+	familyOrderV4First = "v4first"
+	// familyOrderV6First sorts IPv6 addresses before IPv4 addresses.
+	familyOrderV6First = "v6first"
+)
+
+// zeroTTLPolicy values for the `zeroTTLPolicy` directive, selecting how
+// updateStatus handles a resolved address answered with TTL 0
+// ("don't cache").
+const (
+	// zeroTTLPolicyStore is the default: TTL-0 addresses are stored
+	// exactly as observed, the same as any other TTL.
+	zeroTTLPolicyStore = "store"
+	// zeroTTLPolicyFloor raises a TTL-0 address's stored TTL to
+	// zeroTTLMinimum, so a downstream consumer polling status doesn't
+	// treat it as perpetually about to expire.
+	zeroTTLPolicyFloor = "floor"
+	// zeroTTLPolicySkip drops a TTL-0 address from this cycle's update
+	// entirely, leaving whatever was already stored for it (if anything)
+	// untouched, for operators who'd rather keep a stale-but-known-good
+	// address than churn status on every "don't cache" answer.
+	zeroTTLPolicySkip = "skip"
+	// zeroTTLPolicyStoreVolatile floors a TTL-0 address's stored TTL to
+	// zeroTTLMinimum like zeroTTLPolicyFloor, but additionally brings the
+	// name's next proactive lookup forward to now (see
+	// Resolver.ScheduleNow), so an operator who doesn't trust an
+	// upstream's TTL-0 answers gets it re-resolved on the very next
+	// scheduler tick instead of waiting out defaultRetryInterval.
+	zeroTTLPolicyStoreVolatile = "storeVolatile"
+)
+
+// fieldManager identifies this plugin's ownership of the status fields
+// it writes via server-side apply.
+const fieldManager = "dnsnameresolver"
+
+// supportedAPIVersion is the only DNSNameResolver API version this build
+// knows how to reconcile against: networkv1alpha1 is the only version
+// currently vendored from github.com/openshift/api. The apiVersion
+// directive validates against this constant rather than accepting any
+// string, so a Corefile written for a future build that adds v1beta1/v1
+// support fails loudly on this build instead of quietly running against
+// v1alpha1 anyway.
+const supportedAPIVersion = "network.openshift.io/v1alpha1"
+
+// OCPDNSNameResolver is a CoreDNS plugin that observes DNS answers passing
+// through this server and records the resolved addresses and their TTLs
+// into the status of the matching DNSNameResolver object. It also runs a
+// Resolver that proactively re-queries CoreDNS ahead of TTL expiry so
+// status stays fresh even without live query traffic.
+type OCPDNSNameResolver struct {
+	Next plugin.Handler
+
+	namespaces           *namespaceMatcher
+	namespacesMu         sync.RWMutex
+	client               client.Client
+	resolver             *Resolver
+	stopCh               chan struct{}
+	updateTimeout        time.Duration
+	limiters             *namespaceLimiters
+	objectLocks          *objectLocks
+	answerLimit          int
+	followSRV            bool
+	followSVCB           bool
+	failOnUpdateError    bool
+	clearUnwatchedStatus bool
+	applyMode            string
+	searchSuffixes       []string
+	history              *resolutionHistory
+	successRatios        *successRatioTracker
+
+	// zones, when non-empty, restricts ServeDNS to qnames falling under
+	// one of the listed zones (see the zones directive), passing through
+	// any query outside them untouched. This mirrors the zone-scoping
+	// convention most CoreDNS plugins follow, letting this plugin be
+	// declared in a server block that also handles zones it shouldn't
+	// track DNSNameResolver status for. Empty by default, which applies
+	// no zone restriction (every qname the server block itself sees is a
+	// candidate).
+	zones []string
+
+	// asyncStatusUpdate, when set, makes ServeDNS return the DNS response
+	// as soon as the rest of the chain produces it, running the
+	// DNSNameResolver status update in the background instead of
+	// wg.Wait()ing on it first. Background updates are bounded by
+	// asyncQueue; incompatible with failOnUpdateError, since a response
+	// that's already been written can't be turned into a SERVFAIL.
+	asyncStatusUpdate bool
+	asyncQueue        *asyncUpdateQueue
+
+	// logSkippedQueries enables a debug-level log line explaining why a
+	// query was passed through without recording any resolution, for
+	// diagnosing "why isn't my DNSNameResolver updating" support cases.
+	// Off by default since it's a per-query log line on a plugin that
+	// otherwise stays quiet on the hot path.
+	logSkippedQueries bool
+
+	// logUpdateDecisions enables a debug-level log line in updateStatus
+	// capturing the rationale behind each status write: whether the
+	// object was matched via a wildcard or an exact tracked name, and
+	// whether qname already had a resolved-name entry being merged into
+	// or a new one being appended. For diagnosing "why didn't my status
+	// update look the way I expected" support cases. Off by default for
+	// the same reason logSkippedQueries is: a per-update log line on a
+	// plugin that otherwise stays quiet on the hot path.
+	logUpdateDecisions bool
+
+	// warmupPeriod, when non-zero, delays DNSNameResolver status writes
+	// for this long after startup (see the warmup directive): ServeDNS
+	// still serves answers and computes what each match's update would
+	// be, but the write itself is buffered in pendingWarmupUpdates,
+	// coalesced per qname, and only applied once warmupDeadline passes.
+	// This absorbs the startup write churn that comes from serving
+	// queries against a controller cache that's still syncing (or
+	// answers arriving in the few seconds right after it finishes),
+	// where an update recorded now is often immediately corrected by the
+	// next one. Zero (disabled) by default.
+	warmupPeriod   time.Duration
+	warmupDeadline time.Time
+
+	// warmupMu guards pendingWarmupUpdates independently of h.mu, since
+	// buffering or flushing a warmup update never touches
+	// h.objects/h.byName/h.wildcards.
+	warmupMu             sync.Mutex
+	pendingWarmupUpdates map[string]*warmupUpdate
+
+	// schedulerStateNamespace and schedulerStateConfigMapName, when both
+	// non-empty, name the ConfigMap the resolver's scheduling snapshot is
+	// persisted to and restored from across restarts (see
+	// persistSchedulerState in setup.go and persistence.go). Empty by
+	// default, which disables persistence entirely.
+	schedulerStateNamespace     string
+	schedulerStateConfigMapName string
+
+	// clientCIDRs, when non-empty, restricts tracking to queries whose
+	// client address falls within one of these ranges; queries from
+	// elsewhere are passed through untracked. Empty (the default) tracks
+	// queries from every client.
+	clientCIDRs []*net.IPNet
+
+	// requireRecursionDesired, when true, restricts tracking to queries
+	// with the RD (recursion desired) bit set; a query without it is
+	// passed through untracked. Internal health/monitoring probes
+	// commonly issue non-RD queries, which would otherwise pollute a
+	// DNSNameResolver object's status with resolutions no client
+	// actually depends on. Off by default, which tracks every query
+	// regardless of RD, for compatibility with existing deployments.
+	requireRecursionDesired bool
+
+	// requireAuthoritative, when true, restricts tracking to responses
+	// with the AA (authoritative answer) bit set; a response without it,
+	// e.g. one CoreDNS served straight out of its recursive cache rather
+	// than from a zone it's authoritative for, is passed through
+	// untracked. Security-conscious deployments that only trust answers
+	// this server itself is authoritative for use this to keep a
+	// possibly-stale or upstream-controlled cache entry from ever
+	// reaching a DNSNameResolver object's status. Only checked against
+	// live query traffic in ServeDNS: the proactive Resolver's own
+	// re-queries always go to this same CoreDNS instance, not an
+	// arbitrary upstream, so they carry no equivalent trust question. Off
+	// by default, which tracks every response regardless of AA.
+	requireAuthoritative bool
+
+	// tracingEnabled, when set, makes ServeDNS build a span tree (see
+	// span in tracing.go) covering the chain call and the status-update
+	// fan-out, with a child span per namespace update and per
+	// updateStatus call, carrying qname/namespace/rcode attributes. Off
+	// by default: span construction is cheap but not free, and most
+	// deployments have nothing consuming the exported spans.
+	tracingEnabled bool
+
+	// wildcardSubdomainTracking, when true (the default), records a
+	// wildcard object's status under the actual subdomain queried (e.g.
+	// "foo.example.com." for the object "*.example.com."), so status
+	// reflects every distinct subdomain seen. When false, every match
+	// against that wildcard object is instead recorded under the
+	// wildcard's own name, so the object's status stays a single entry.
+	wildcardSubdomainTracking bool
+
+	// disableWildcards, when set, makes addOrUpdateObject reject wildcard
+	// DNSNameResolver objects instead of tracking them, and makes
+	// matchingObjects skip the wildcard lookup entirely. For deployments
+	// that only use regular (non-wildcard) objects, this cuts out the
+	// wildcard machinery as a source of overhead and complexity rather
+	// than just leaving it permanently unmatched. Off by default.
+	disableWildcards bool
+
+	// wildcardGroupRefresh, when true, ties a wildcard object's single
+	// proactive refresh cycle to the shortest TTL observed among the
+	// subdomains matched against it in live traffic (via
+	// Resolver.ObserveTTL), instead of leaving it solely dependent on
+	// the wildcard's own literal-pattern lookup (e.g. "*.example.com."),
+	// which many zones never answer. Off by default, since it does
+	// nothing for deployments where wildcardSubdomainTracking observes
+	// few enough distinct subdomains that the default proactive refresh
+	// is already sufficient.
+	wildcardGroupRefresh bool
+
+	// failureThreshold is how many consecutive update failures an object
+	// must accumulate, while at least one sibling namespace sharing the
+	// same DNS name keeps succeeding, before markDegraded actually
+	// upserts a Degraded condition for it. An individual object can
+	// override this via the failureThresholdAnnotation annotation.
+	// Defaults to 1, i.e. degrade on the first observed failure, which
+	// is the behavior before this directive existed.
+	failureThreshold int
+
+	// failureCounters is the consecutive-failure bookkeeping
+	// updateAllAndRecordOutcome and markDegraded use to enforce
+	// failureThreshold.
+	failureCounters *failureCounters
+
+	// trackPTR, when true, resolves the PTR (reverse) name of every
+	// currently-resolved address and stamps them onto the DNSNameResolver
+	// object as the ptrNamesAnnotation annotation, for firewall systems
+	// that key on reverse DNS rather than the forward name this plugin
+	// otherwise tracks. Off by default, since it doubles the number of
+	// upstream queries per update for enrichment most deployments don't
+	// need.
+	trackPTR bool
+
+	// dedupeResolvedAddresses, when true, collapses a resolved address
+	// into an already-stored one that normalizes to the same address via
+	// normalizeIP (currently just IPv4-mapped IPv6 vs. its plain IPv4
+	// form) instead of storing both, so a name that's observed resolving
+	// to the same endpoint under both forms doesn't produce two
+	// DNSNameResolverResolvedAddress entries for it. Off by default,
+	// which stores every observed address exactly as seen.
+	dedupeResolvedAddresses bool
+
+	// ipFilters, when non-empty, are applied in order to the ipTTLs map
+	// extracted from each response before it's recorded in status,
+	// letting a firewall integration exclude or otherwise transform
+	// addresses this plugin would otherwise track verbatim (see
+	// ipfilter.go for the built-in exclude-list and private-filter
+	// hooks, selected via the ipFilter directive). Empty by default,
+	// which records every resolved address unmodified.
+	ipFilters []ipFilterFunc
+
+	// ttlRoundingSeconds, when non-zero, rounds every resolved address's
+	// TTL to the nearest multiple of this many seconds before it's
+	// stored. Upstreams that return slightly-varying TTLs for the same
+	// name from one lookup to the next (e.g. 29, 30, 31, from caching
+	// skew) would otherwise store a different value on every lookup;
+	// rounding makes near-identical TTLs collapse to the same stored
+	// value, so a serverSideApply patch of unchanged data becomes an
+	// actual no-op instead of a fresh write. 0 (the default) stores TTLs
+	// exactly as observed.
+	ttlRoundingSeconds uint32
+
+	// zeroTTLPolicy selects how a TTL-0 resolved address is handled
+	// before it's stored (see the zeroTTLPolicy directive and the
+	// zeroTTLPolicy* constants). zeroTTLPolicyStore (the empty default)
+	// stores it exactly as observed.
+	zeroTTLPolicy string
+
+	// zeroTTLMinimum is the TTL a TTL-0 address is raised to under
+	// zeroTTLPolicyFloor or zeroTTLPolicyStoreVolatile. Meaningless (and
+	// unused) under zeroTTLPolicyStore or zeroTTLPolicySkip.
+	zeroTTLMinimum uint32
+
+	// maxAddressAge, when non-zero, hard-caps how long an address can stay
+	// continuously resolved for a tracked name regardless of how many
+	// times its TTL refreshes: once addressAges reports it's been seen for
+	// at least this long, applyMaxAddressAge resets its tracked
+	// first-seen time and forces an immediate re-lookup (see the
+	// maxAddressAge directive). Zero (the default) applies no maximum age.
+	maxAddressAge time.Duration
+
+	// addressAges tracks, per DNS name and address, when that address was
+	// first observed, so applyMaxAddressAge can measure its age
+	// independent of how often it's been refreshed. Always allocated,
+	// even when maxAddressAge is disabled, the same as h.history and
+	// h.successRatios.
+	addressAges *addressAgeTracker
+
+	// processingBudget, when non-zero (see the processingBudget
+	// directive), bounds how long ServeDNS's own overhead — the chain
+	// call plus spawning the status update, not the update itself — is
+	// expected to take. Exceeding it increments budgetExceededTotal so
+	// operators can catch this plugin eating into a CoreDNS latency SLA.
+	// It's purely observational: nothing is aborted or shortened because
+	// of it, and in async mode the check never delays the client, since
+	// it only measures up to the point the update is handed to
+	// h.asyncQueue, not the update itself. Zero (the default) disables
+	// the check entirely.
+	processingBudget time.Duration
+
+	// familyOrder, when set to familyOrderV4First or familyOrderV6First,
+	// sorts a DNSNameResolver object's ResolvedAddresses by family in the
+	// given preference before they're written, for downstream firewalls
+	// that want a stable preferred ordering when a name resolves to both
+	// families. Addresses within the same family keep their existing
+	// relative order. Empty (the default) applies no family ordering.
+	familyOrder string
+
+	// managedBySelector, when non-nil, restricts tracking to
+	// DNSNameResolver objects whose labels satisfy it (see the
+	// managedBySelector directive), so a coexisting controller managing
+	// overlapping objects can't have its objects' status clobbered by
+	// this plugin. managedBySelectorRaw holds the original directive
+	// argument for Config's introspection, since labels.Selector isn't
+	// comparable via reflect.DeepEqual. nil (the default) tracks every
+	// object regardless of labels.
+	managedBySelector    labels.Selector
+	managedBySelectorRaw string
+
+	// failureRcodes, when non-empty, lists the rcodes (see the
+	// failureRcodes directive) that count against a DNS name's success
+	// ratio (see successRatios). A response with any other non-success
+	// rcode is logged and otherwise ignored rather than recorded as a
+	// failure, so an upstream returning e.g. NOTIMP for a query type it
+	// doesn't support can't drag down a name's success ratio. Empty (the
+	// default) treats every non-success rcode as a failure.
+	failureRcodes map[int]bool
+
+	// rcodeMessages overrides the human-readable text used for a given
+	// rcode wherever this plugin surfaces one (see the rcodeMessages
+	// directive and rcodeMessage), for operators whose downstream
+	// tooling expects something other than dns.RcodeToString's enum-style
+	// names (e.g. "NXDOMAIN"). An rcode missing from this map falls back
+	// to dns.RcodeToString. nil (the default) uses dns.RcodeToString for
+	// every rcode.
+	rcodeMessages map[int]string
+
+	// apiVersion records which DNSNameResolver API version this instance
+	// was configured for (see the apiVersion directive and
+	// supportedAPIVersion). It's currently informational only, surfaced
+	// through Config() for introspection, since this build only ever
+	// vendors and reconciles against supportedAPIVersion; it exists so a
+	// build that adds a second vendored version has somewhere to plug in
+	// per-version client/informer selection without another Corefile or
+	// PluginConfig change.
+	apiVersion string
+
+	// instanceAnnotationKey, when non-empty (see the instanceAnnotation
+	// directive), makes updateStatus stamp the annotation it names with
+	// this plugin instance's identity (see instanceID) on every object it
+	// updates. Useful in multi-zone or multi-instance deployments to tell
+	// which instance last touched a given object. Empty (the default)
+	// records no such annotation.
+	instanceAnnotationKey string
+
+	// maxStatusBytes, when non-zero (see the maxStatusBytes directive),
+	// caps how large a DNSNameResolver object's serialized status is
+	// allowed to grow: once a wildcard object with
+	// wildcardSubdomainTracking on (see that field) accumulates enough
+	// distinct subdomain entries to cross this limit, updateStatus evicts
+	// resolved-name entries least-recently seen (see
+	// trimResolvedNamesToFit) until it fits again, preserving the entry
+	// it's currently writing and the object's own wildcard base entry
+	// preferentially. 0 (the default) disables trimming: statusBytes
+	// still reports the size, but nothing acts on it.
+	maxStatusBytes int
+
+	// nodataCountsAsFailure, when set (see the nodataCountsAsFailure
+	// directive), makes runUpdates record a NODATA response (NOERROR
+	// with zero A/AAAA records) as a success-ratio failure instead of a
+	// success, for operators who treat "resolves to nothing" as a
+	// resolution problem worth tracking. It doesn't change how the empty
+	// answer itself is stored: NODATA still clears stale addresses for
+	// the queried family either way. Off by default, matching the
+	// pre-existing behavior of counting any NOERROR as a success.
+	nodataCountsAsFailure bool
+
+	// exportPath configures runExporter (see the exportPath directive):
+	// when non-empty, a background goroutine periodically (every
+	// --export-interval) writes a JSON snapshot of every watched
+	// DNSNameResolver object's resolved names and addresses to
+	// exportPath, for offline/non-Kubernetes firewall tooling that can't
+	// watch the apiserver directly. Empty by default, which disables the
+	// exporter entirely.
+	exportPath string
+
+	mu        sync.RWMutex
+	objects   map[string]*object            // keyed by "namespace/name"
+	byName    map[string]map[string]*object // exact DNS name -> namespace -> object
+	wildcards map[string]map[string]*object // wildcard DNS name -> namespace -> object
+}
+
+// New returns an OCPDNSNameResolver plugin with its defaults applied and
+// its internal object caches and Resolver ready to use. It is exported so
+// binaries other than this repo's own CoreDNS build can embed the plugin
+// without going through Corefile parsing. Next and client must still be
+// set by the caller before it is usable, and its Resolver must be started
+// (see setup.go) for proactive re-resolution to run.
+func New() *OCPDNSNameResolver {
+	h := &OCPDNSNameResolver{
+		objects:                   make(map[string]*object),
+		byName:                    make(map[string]map[string]*object),
+		wildcards:                 make(map[string]map[string]*object),
+		updateTimeout:             defaultUpdateTimeout,
+		stopCh:                    make(chan struct{}),
+		applyMode:                 applyModeUpdateStatus,
+		addressAges:               newAddressAgeTracker(),
+		history:                   newResolutionHistory(),
+		successRatios:             newSuccessRatioTracker(),
+		wildcardSubdomainTracking: true,
+		asyncQueue:                newAsyncUpdateQueue(asyncStatusUpdateQueueSize),
+		objectLocks:               newObjectLocks(),
+		apiVersion:                supportedAPIVersion,
+		failureThreshold:          1,
+		failureCounters:           newFailureCounters(),
+		pendingWarmupUpdates:      make(map[string]*warmupUpdate),
+	}
+	h.resolver = NewResolver(lookupDNSNameFromCoreDNS, h.resolvedFromScheduler)
+	return h
+}
+
+// resolvedFromScheduler is the Resolver's onResolved callback: it applies
+// a proactive, out-of-band lookup result the same way ServeDNS applies
+// one observed from live traffic.
+func (h *OCPDNSNameResolver) resolvedFromScheduler(dnsName string, isWildcard bool, ipTTLs map[string]ipTTL) {
+	h.mu.RLock()
+	index := h.byName
+	if isWildcard {
+		index = h.wildcards
+	}
+	byNamespace := index[dnsName]
+	objs := make([]*object, 0, len(byNamespace))
+	for _, o := range byNamespace {
+		objs = append(objs, o)
+	}
+	h.mu.RUnlock()
+	if len(objs) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.updateTimeout)
+	defer cancel()
+	for _, o := range objs {
+		// The proactive lookup always queries both A and AAAA (see
+		// sendDNSLookupRequest), so ipTTLs is a complete picture of both
+		// families and can fully replace whatever was stored before.
+		h.updateStatus(ctx, o, dnsName, ipTTLs, "", nil)
+	}
+}
+
+// observeWildcardGroupTTL feeds ipTTLs' shortest TTL into the Resolver's
+// schedule for every wildcard object among matches, so wildcardGroupRefresh
+// can bring that wildcard's next proactive refresh forward when a live
+// query under it observes a shorter TTL than what's currently scheduled.
+// matches routinely repeats the same wildcard object across namespaces
+// that reference the same DNS name, and h.resolver.ObserveTTL is already
+// idempotent for repeated calls with the same dnsName, so no
+// deduplication is needed here.
+func (h *OCPDNSNameResolver) observeWildcardGroupTTL(matches []*object, ipTTLs map[string]ipTTL) {
+	ttl := minTTLSeconds(ipTTLs)
+	for _, o := range matches {
+		if o.isWildcard {
+			h.resolver.ObserveTTL(o.dnsName, ttl)
+		}
+	}
+}
+
+// ServeDNS implements the plugin.Handler interface.
+func (h *OCPDNSNameResolver) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (rcode int, err error) {
+	var root *span
+	if h.tracingEnabled {
+		root = newSpan("ServeDNS")
+		defer func() {
+			root.SetAttribute("rcode", h.rcodeMessage(rcode))
+			root.End()
+			exportSpan(root)
+		}()
+	}
+
+	state := request.Request{W: w, Req: r}
+
+	start := time.Now()
+	chainSpan := root.child("chain")
+	nw := nonwriter.New(w)
+	rcode, err = plugin.NextOrFailure(h.Name(), h.Next, ctx, nw, r)
+	chainSpan.End()
+	if err != nil || nw.Msg == nil {
+		return rcode, err
+	}
+
+	if !h.clientAllowed(state.IP()) {
+		if h.logSkippedQueries {
+			clog.Debugf("dnsnameresolver: passed through qtype %s: client %s is outside the configured clientCIDRs", dns.TypeToString[state.QType()], state.IP())
+		}
+		return rcode, w.WriteMsg(nw.Msg)
+	}
+
+	if h.requireRecursionDesired && !r.RecursionDesired {
+		if h.logSkippedQueries {
+			clog.Debugf("dnsnameresolver: passed through qtype %s: query from %s did not have RD set", dns.TypeToString[state.QType()], state.IP())
+		}
+		return rcode, w.WriteMsg(nw.Msg)
+	}
+
+	if h.requireAuthoritative && !nw.Msg.Authoritative {
+		if h.logSkippedQueries {
+			clog.Debugf("dnsnameresolver: passed through qtype %s: response for %s did not have the AA bit set", dns.TypeToString[state.QType()], state.IP())
+		}
+		return rcode, w.WriteMsg(nw.Msg)
+	}
+
+	qname := strings.ToLower(state.QName())
+
+	if len(h.zones) > 0 && plugin.Zones(h.zones).Matches(qname) == "" {
+		if h.logSkippedQueries {
+			clog.Debugf("dnsnameresolver: passed through qtype %s: %s is outside the configured zones", dns.TypeToString[state.QType()], qname)
+		}
+		return rcode, w.WriteMsg(nw.Msg)
+	}
+
+	matches := h.matchingObjects(qname)
+	triedSearchSuffix := false
+	if len(matches) == 0 {
+		// Pods commonly issue queries with a cluster search domain
+		// appended (e.g. "www.example.com.svc.cluster.local." for the
+		// name "www.example.com."). If the raw qname didn't match
+		// anything, retry against it with a configured search suffix
+		// stripped, and record the result under that stripped name
+		// rather than the expanded one the object doesn't know about.
+		if stripped, ok := h.stripSearchSuffix(qname); ok {
+			triedSearchSuffix = true
+			if m := h.matchingObjects(stripped); len(m) > 0 {
+				qname, matches = stripped, m
+			}
+		}
+	}
+	root.SetAttribute("qname", qname)
+	if len(matches) == 0 && h.logSkippedQueries {
+		clog.Debugf("dnsnameresolver: passed through qtype %s: %s", dns.TypeToString[state.QType()], skippedQueryReason(qname, triedSearchSuffix))
+	}
+	if len(matches) > 0 {
+		fanoutSpan := root.child("statusUpdateFanout")
+		if h.asyncStatusUpdate {
+			if !h.asyncQueue.tryRun(func() {
+				h.runUpdates(matches, qname, nw.Msg, fanoutSpan)
+				fanoutSpan.End()
+			}) {
+				asyncStatusUpdatesDroppedTotal.Inc()
+				clog.Warningf("dnsnameresolver: dropped status update for %q: async queue full", qname)
+				fanoutSpan.End()
+			}
+		} else {
+			failed := h.runUpdates(matches, qname, nw.Msg, fanoutSpan)
+			fanoutSpan.End()
+			if failed {
+				clog.Errorf("dnsnameresolver: all DNSNameResolver status updates failed for %q, returning SERVFAIL", qname)
+				return dns.RcodeServerFailure, nil
+			}
+		}
+
+		// Checked here, right after the chain call and either the async
+		// dispatch or the synchronous update itself, so the overhead
+		// this plugin adds to the request is what's measured, not the
+		// time it takes to write the response back to the client. In
+		// async mode this runs immediately after h.asyncQueue.tryRun
+		// returns, before the spawned update goroutine has necessarily
+		// finished, so a slow update never delays this check or the
+		// client it's guarding.
+		if h.processingBudget > 0 {
+			if elapsed := time.Since(start); elapsed > h.processingBudget {
+				budgetExceededTotal.Inc()
+			}
+		}
+	}
+
+	return rcode, w.WriteMsg(nw.Msg)
+}
+
+// runUpdates updates every match's DNSNameResolver status from msg, plus
+// any SRV-followed targets, and reports whether failOnUpdateError is set
+// and the primary qname's own update failed completely. The update context is derived from
+// context.Background(), not the DNS request's own context, so a request
+// that CoreDNS cancels quickly (or whose client disconnects) can't cut a
+// status update short mid-write and leave it half-applied; h.updateTimeout
+// is the only thing that bounds how long these updates run. The returned
+// catastrophic-failure bool is only actionable by the synchronous caller,
+// which can still turn it into a SERVFAIL before writing the response.
+// SRV-target updates get their own, separate failure flag: an unrelated
+// glue-record enrichment update failing outright shouldn't turn an
+// otherwise-successful primary-qname update into a SERVFAIL.
+func (h *OCPDNSNameResolver) runUpdates(matches []*object, qname string, msg *dns.Msg, parent *span) bool {
+	updateCtx, cancel := context.WithTimeout(context.Background(), h.updateTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var catastrophicFailure atomic.Bool
+	var srvCatastrophicFailure atomic.Bool
+	family := queryFamily(msg)
+	if ipTTLs := filterIPTTLsByFamily(extractIPTTLs(msg, h.answerLimit, h.followSVCB), family); len(ipTTLs) > 0 || msg.Rcode == dns.RcodeSuccess {
+		ipTTLs = h.applyZeroTTLPolicy(ipTTLs, qname)
+		h.applyMaxAddressAge(qname, ipTTLs, time.Now())
+		if h.ttlRoundingSeconds > 0 {
+			ipTTLs = roundIPTTLs(ipTTLs, h.ttlRoundingSeconds)
+		}
+		for _, filter := range h.ipFilters {
+			ipTTLs = filter(ipTTLs)
+		}
+		// A successful NOERROR response with no A/AAAA records
+		// (NODATA) is still worth recording: it lets updateStatus
+		// tell "resolves to nothing" apart from "never resolved".
+		if h.inWarmup() {
+			h.bufferWarmupUpdate(matches, qname, ipTTLs, family)
+		} else {
+			h.updateAllAndRecordOutcome(updateCtx, &wg, matches, qname, ipTTLs, family, &catastrophicFailure, parent)
+		}
+		if h.wildcardGroupRefresh && len(ipTTLs) > 0 {
+			h.observeWildcardGroupTTL(matches, ipTTLs)
+		}
+		h.history.record(qname, msg.Rcode, ipsOf(ipTTLs))
+		// NODATA (NOERROR with zero addresses) counts as a success ratio
+		// success by default, since the name resolved without error; the
+		// nodataCountsAsFailure directive lets an operator who treats an
+		// empty answer as a resolution problem count it as a failure
+		// instead, without changing how the empty answer itself is
+		// stored above.
+		nodata := len(ipTTLs) == 0
+		h.successRatios.record(qname, msg.Rcode == dns.RcodeSuccess && !(nodata && h.nodataCountsAsFailure))
+	} else if h.rcodeCountsAsFailure(msg.Rcode) {
+		h.history.record(qname, msg.Rcode, nil)
+		h.successRatios.record(qname, false)
+	} else {
+		clog.Debugf("dnsnameresolver: ignoring rcode %s for %q: not in failureRcodes", h.rcodeMessage(msg.Rcode), qname)
+	}
+
+	if h.followSRV {
+		for _, target := range extractSRVTargets(msg) {
+			targetIPTTLs := extractIPTTLsForName(msg, target, h.answerLimit)
+			if len(targetIPTTLs) == 0 {
+				var err error
+				targetIPTTLs, _, err = h.resolver.Lookup(target)
+				if err != nil || len(targetIPTTLs) == 0 {
+					continue
+				}
+			}
+			// The glue records carrying an SRV target's addresses can
+			// mix families in a single message, unlike the qname's own
+			// question, so there's no single family to restrict to.
+			if h.inWarmup() {
+				h.bufferWarmupUpdate(matches, target, targetIPTTLs, "")
+			} else {
+				h.updateAllAndRecordOutcome(updateCtx, &wg, matches, target, targetIPTTLs, "", &srvCatastrophicFailure, parent)
+			}
+		}
+	}
+	wg.Wait()
+
+	return h.failOnUpdateError && catastrophicFailure.Load()
+}
+
+// Name implements the plugin.Handler interface.
+func (h *OCPDNSNameResolver) Name() string { return "dnsnameresolver" }
+
+// ResolutionHistory returns the recent ResolutionRecords observed for
+// dnsName, oldest first, up to --resolution-history-size entries. It's
+// empty whenever the history is disabled (the default) or dnsName has no
+// recorded observations yet. This plugin has no debug HTTP endpoint of
+// its own; embedders that want one can call this directly.
+func (h *OCPDNSNameResolver) ResolutionHistory(dnsName string) []ResolutionRecord {
+	return h.history.history(dnsName)
+}
+
+// ResolutionSuccessRatio returns dnsName's rolling ratio of successful
+// resolutions to total observed, over its most recent
+// --success-ratio-window-size observations, and whether any observations
+// have been recorded yet. The same ratio is exported per-name as the
+// ocp_dnsnameresolver_success_ratio metric; this plugin has no debug HTTP
+// endpoint of its own, so embedders that want one can call this directly.
+func (h *OCPDNSNameResolver) ResolutionSuccessRatio(dnsName string) (float64, bool) {
+	return h.successRatios.successRatio(dnsName)
+}
+
+// clientAllowed reports whether a query from ip should be tracked, per
+// the clientCIDRs directive. With no clientCIDRs configured (the
+// default), every client is allowed. An ip that fails to parse (which
+// shouldn't happen for a real client address) is treated as
+// disallowed, since it can't be matched against any configured range.
+func (h *OCPDNSNameResolver) clientAllowed(ip string) bool {
+	if len(h.clientCIDRs) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, cidr := range h.clientCIDRs {
+		if cidr.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingObjects returns the tracked objects that qname should update:
+// every object with an exact name match, plus every object registered
+// under the most specific tracked wildcard covering qname, across all
+// namespaces that registered one. The same
+// DNS name (regular or wildcard) can legitimately be tracked by more
+// than one namespace's DNSNameResolver object; matches are deduplicated
+// by object identity so, when qname is itself a literal wildcard name
+// (e.g. "*.example.com."), an object registered under both the exact and
+// wildcard indices is never returned, and therefore never updated,
+// twice.
+func (h *OCPDNSNameResolver) matchingObjects(qname string) []*object {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	seen := make(map[*object]struct{}, 2)
+	var matches []*object
+	add := func(byNamespace map[string]*object) {
+		for _, o := range byNamespace {
+			if _, ok := seen[o]; ok {
+				continue
+			}
+			seen[o] = struct{}{}
+			matches = append(matches, o)
+		}
+	}
+
+	if byNamespace, ok := h.byName[qname]; ok {
+		add(byNamespace)
+	}
+	if !h.disableWildcards {
+		// Most-specific wildcard wins: qname's ancestor wildcard names are
+		// checked from most to least specific, and only the first (i.e.
+		// most specific) one actually tracked stops the search, so a name
+		// covered by both "*.sub.example.com." and "*.example.com."
+		// updates only the former.
+		for _, wc := range getWildcardCandidates(qname) {
+			if byNamespace, ok := h.wildcards[wc]; ok {
+				add(byNamespace)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// stripSearchSuffix strips a single configured `searchSuffixes` entry
+// from qname, if qname ends with one on a label boundary and something
+// remains before it. It reports the stripped name and whether a suffix
+// matched.
+func (h *OCPDNSNameResolver) stripSearchSuffix(qname string) (string, bool) {
+	for _, suffix := range h.searchSuffixes {
+		if len(qname) <= len(suffix) || !strings.HasSuffix(qname, suffix) {
+			continue
+		}
+		if qname[len(qname)-len(suffix)-1] != '.' {
+			continue
+		}
+		return qname[:len(qname)-len(suffix)], true
+	}
+	return "", false
+}
+
+// skippedQueryReason describes why ServeDNS is about to pass qname
+// through untouched, for the logSkippedQueries debug log line. Matching
+// is purely name-based (see matchingObjects), so "no tracked object"
+// covering both the regular and wildcard indices, even after search
+// suffix stripping, is the only real skip condition; there's no
+// qtype-based skip to report, since a query of any type against a
+// tracked name still triggers an update.
+func skippedQueryReason(qname string, triedSearchSuffix bool) string {
+	if triedSearchSuffix {
+		return fmt.Sprintf("no DNSNameResolver object tracks %q, including after stripping configured search suffixes", qname)
+	}
+	return fmt.Sprintf("no DNSNameResolver object tracks %q", qname)
+}
+
+// objectManaged reports whether a DNSNameResolver object with the given
+// labels satisfies --managedBySelector (see the managedBySelector
+// directive in setup.go), so this plugin only tracks and updates objects
+// a coexisting controller has marked as belonging to it. A nil selector
+// (the default) matches every object.
+func (h *OCPDNSNameResolver) objectManaged(objLabels map[string]string) bool {
+	if h.managedBySelector == nil {
+		return true
+	}
+	return h.managedBySelector.Matches(labels.Set(objLabels))
+}
+
+// rcodeMessage returns the human-readable text ServeDNS and runUpdates
+// use for rcode, honoring the rcodeMessages directive's overrides and
+// falling back to dns.RcodeToString for any rcode it doesn't cover
+// (including when h.rcodeMessages itself is unset).
+func (h *OCPDNSNameResolver) rcodeMessage(rcode int) string {
+	if msg, ok := h.rcodeMessages[rcode]; ok {
+		return msg
+	}
+	return dns.RcodeToString[rcode]
+}
+
+// rcodeCountsAsFailure reports whether rcode should count against a DNS
+// name's success ratio (see the failureRcodes directive). rcode is assumed
+// to already be known non-success by the caller.
+func (h *OCPDNSNameResolver) rcodeCountsAsFailure(rcode int) bool {
+	if len(h.failureRcodes) == 0 {
+		return true
+	}
+	return h.failureRcodes[rcode]
+}
+
+func (h *OCPDNSNameResolver) addOrUpdateObject(namespace, name, dnsName string, isWildcard bool) {
+	if isWildcard && h.disableWildcards {
+		clog.Warningf("dnsnameresolver: rejecting wildcard DNSNameResolver object %s/%s: disableWildcards is set", namespace, name)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := namespace + "/" + name
+	o := newObject(namespace, name, dnsName, isWildcard)
+	h.objects[key] = o
+
+	index := h.byName
+	if isWildcard {
+		index = h.wildcards
+	}
+	if index[dnsName] == nil {
+		index[dnsName] = make(map[string]*object)
+	}
+	if existing, ok := index[dnsName][namespace]; ok && existing.name != name {
+		duplicateObjectsTotal.WithLabelValues(namespace).Inc()
+		clog.Warningf("dnsnameresolver: namespace %q has more than one DNSNameResolver object for %q (%q and %q); only %q will be tracked", namespace, dnsName, existing.name, name, name)
+	}
+	index[dnsName][namespace] = o
+
+	if h.resolver != nil {
+		h.resolver.Add(namespace, dnsName, isWildcard)
+	}
+}
+
+func (h *OCPDNSNameResolver) removeObject(namespace, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := namespace + "/" + name
+	o, ok := h.objects[key]
+	if !ok {
+		return
+	}
+	delete(h.objects, key)
+
+	index := h.byName
+	if o.isWildcard {
+		index = h.wildcards
+	}
+	if byNamespace, ok := index[o.dnsName]; ok {
+		delete(byNamespace, namespace)
+		if len(byNamespace) == 0 {
+			delete(index, o.dnsName)
+		}
+	}
+
+	if h.resolver != nil {
+		h.resolver.Delete(namespace, o.dnsName, o.isWildcard)
+	}
+}
+
+// hasObject reports whether namespace/name is already tracked, i.e.
+// whether this reconcile is an update to an object this plugin has
+// already adopted rather than its first sighting of it.
+func (h *OCPDNSNameResolver) hasObject(namespace, name string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.objects[namespace+"/"+name]
+	return ok
+}
+
+// trackedSpec returns the dnsName and isWildcard this plugin last cached
+// for namespace/name, and whether it was tracked at all. Reconcile uses
+// it to tell a spec change (see specDriftTotal) apart from ordinary
+// status churn on an otherwise-unchanged object.
+func (h *OCPDNSNameResolver) trackedSpec(namespace, name string) (dnsName string, isWildcard, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	o, ok := h.objects[namespace+"/"+name]
+	if !ok {
+		return "", false, false
+	}
+	return o.dnsName, o.isWildcard, true
+}
+
+// statusLooksTampered reports whether resolverObj's status entry for
+// dnsName was cleared by something other than this plugin. The plugin
+// itself always pairs an empty ResolvedAddresses list with the
+// NoAddresses condition set True (see setNoAddressesCondition), so a
+// populated entry with empty addresses and that condition anything but
+// True didn't come from a normal resolution cycle; the most likely
+// explanation is a manual edit removing the addresses. An entry that
+// isn't present at all isn't treated as tampering here: that's this
+// plugin's own steady state before the first successful lookup ever
+// lands, not evidence of an edit.
+func statusLooksTampered(resolverObj *networkv1alpha1.DNSNameResolver, dnsName string) bool {
+	for i := range resolverObj.Status.ResolvedNames {
+		entry := &resolverObj.Status.ResolvedNames[i]
+		if entry.DNSName != networkv1alpha1.DNSName(dnsName) {
+			continue
+		}
+		if len(entry.ResolvedAddresses) != 0 {
+			return false
+		}
+		condition := meta.FindStatusCondition(entry.Conditions, noAddressesConditionType)
+		return condition == nil || condition.Status != metav1.ConditionTrue
+	}
+	return false
+}
+
+// extractIPTTLs pulls the resolved A/AAAA addresses and their TTLs out of
+// a DNS response. limit caps how many distinct addresses are recorded, to
+// guard memory against responses with pathologically large answer
+// sections; a limit of 0 means unlimited. When followSVCB is set (see the
+// followSVCB directive), any ipv4hint/ipv6hint addresses carried by
+// HTTPS/SVCB records in the same answer section are folded in alongside
+// the A/AAAA addresses, still subject to the same limit.
+func extractIPTTLs(msg *dns.Msg, limit int, followSVCB bool) map[string]ipTTL {
+	ipTTLs := make(map[string]ipTTL)
+	for _, rr := range msg.Answer {
+		if limit > 0 && len(ipTTLs) >= limit {
+			break
+		}
+		switch a := rr.(type) {
+		case *dns.A:
+			ipTTLs[a.A.String()] = ipTTL{ip: a.A.String(), ttl: a.Hdr.Ttl}
+		case *dns.AAAA:
+			ipTTLs[a.AAAA.String()] = ipTTL{ip: a.AAAA.String(), ttl: a.Hdr.Ttl}
+		case *dns.HTTPS:
+			if followSVCB {
+				addSVCBHints(ipTTLs, a.SVCB, limit)
+			}
+		case *dns.SVCB:
+			if followSVCB {
+				addSVCBHints(ipTTLs, *a, limit)
+			}
+		}
+	}
+	return ipTTLs
+}
+
+// addSVCBHints extracts svcb's ipv4hint/ipv6hint addresses into ipTTLs,
+// stamped with svcb's own TTL, stopping once limit distinct addresses are
+// recorded (a limit of 0 means unlimited). Used by extractIPTTLs for both
+// HTTPS and bare SVCB records, which share the same SVCBKeyValue layout.
+func addSVCBHints(ipTTLs map[string]ipTTL, svcb dns.SVCB, limit int) {
+	for _, kv := range svcb.Value {
+		var hints []net.IP
+		switch h := kv.(type) {
+		case *dns.SVCBIPv4Hint:
+			hints = h.Hint
+		case *dns.SVCBIPv6Hint:
+			hints = h.Hint
+		default:
+			continue
+		}
+		for _, ip := range hints {
+			if limit > 0 && len(ipTTLs) >= limit {
+				return
+			}
+			ipTTLs[ip.String()] = ipTTL{ip: ip.String(), ttl: svcb.Hdr.Ttl}
+		}
+	}
+}
+
+// applyZeroTTLPolicy adjusts ipTTLs' TTL-0 ("don't cache") entries
+// according to h.zeroTTLPolicy (see the zeroTTLPolicy* constants) before
+// they're stored: zeroTTLPolicyStore leaves ipTTLs untouched,
+// zeroTTLPolicySkip drops the TTL-0 entries, and zeroTTLPolicyFloor and
+// zeroTTLPolicyStoreVolatile both raise them to h.zeroTTLMinimum, with
+// storeVolatile additionally bringing qname's next proactive lookup
+// forward to now so it's re-resolved on the very next scheduler tick.
+func (h *OCPDNSNameResolver) applyZeroTTLPolicy(ipTTLs map[string]ipTTL, qname string) map[string]ipTTL {
+	if h.zeroTTLPolicy == zeroTTLPolicyStore || h.zeroTTLPolicy == "" {
+		return ipTTLs
+	}
+	sawZeroTTL := false
+	adjusted := make(map[string]ipTTL, len(ipTTLs))
+	for ip, it := range ipTTLs {
+		if it.ttl != 0 {
+			adjusted[ip] = it
+			continue
+		}
+		sawZeroTTL = true
+		if h.zeroTTLPolicy == zeroTTLPolicySkip {
+			continue
+		}
+		it.ttl = h.zeroTTLMinimum
+		adjusted[ip] = it
+	}
+	if sawZeroTTL && h.zeroTTLPolicy == zeroTTLPolicyStoreVolatile {
+		h.resolver.ScheduleNow(qname)
+	}
+	return adjusted
+}
+
+// applyMaxAddressAge enforces the maxAddressAge directive: once an address
+// in ipTTLs has been continuously resolved for qname for at least
+// h.maxAddressAge, its tracked first-seen time is reset and qname's next
+// proactive lookup is brought forward to now, so a compliance policy
+// requiring periodic re-validation can't be defeated by an address that
+// keeps refreshing its TTL forever. A no-op while h.maxAddressAge is zero
+// (the default).
+func (h *OCPDNSNameResolver) applyMaxAddressAge(qname string, ipTTLs map[string]ipTTL, now time.Time) {
+	if h.maxAddressAge <= 0 {
+		return
+	}
+	for ip := range ipTTLs {
+		firstSeen := h.addressAges.observe(qname, ip, now)
+		if now.Sub(firstSeen) >= h.maxAddressAge {
+			h.addressAges.reset(qname, ip)
+			h.resolver.ScheduleNow(qname)
+		}
+	}
+}
+
+// roundIPTTLs returns a copy of ipTTLs with every entry's ttl rounded to
+// the nearest multiple of granularity. A ttl of 0 (meaning "don't cache")
+// is left alone, and a positive ttl never rounds down to 0, since that
+// would silently turn a cacheable address into an uncacheable one.
+func roundIPTTLs(ipTTLs map[string]ipTTL, granularity uint32) map[string]ipTTL {
+	rounded := make(map[string]ipTTL, len(ipTTLs))
+	for k, v := range ipTTLs {
+		v.ttl = roundTTL(v.ttl, granularity)
+		rounded[k] = v
+	}
+	return rounded
+}
+
+// roundTTL rounds ttl to the nearest multiple of granularity, per
+// roundIPTTLs' rules around a 0 or would-be-0 result.
+func roundTTL(ttl, granularity uint32) uint32 {
+	if ttl == 0 {
+		return 0
+	}
+	r := ((ttl + granularity/2) / granularity) * granularity
+	if r == 0 {
+		r = granularity
+	}
+	return r
+}
+
+// queryFamily returns "A" or "AAAA" when msg's question asks for exactly
+// that record type, so the caller can prune stale addresses of just that
+// family instead of replacing the full resolved-address list. It returns
+// "" for anything else (multi-question messages, other qtypes, or a
+// proactive lookup's combined result), telling the caller to fall back to
+// a full replace since it can't otherwise tell which family, if either,
+// went stale.
+func queryFamily(msg *dns.Msg) string {
+	if len(msg.Question) != 1 {
+		return ""
+	}
+	switch msg.Question[0].Qtype {
+	case dns.TypeA:
+		return "A"
+	case dns.TypeAAAA:
+		return "AAAA"
+	default:
+		return ""
+	}
+}
+
+// filterIPTTLsByFamily drops any entry of ipTTLs whose address family
+// doesn't match family ("A" or "AAAA"), so a response with a stray
+// record of the other family smuggled into its answer section — whether
+// from a misbehaving upstream or a malformed reply — doesn't get
+// recorded as an answer for a family the query never asked about. A
+// stray record no longer discards the rest of a legitimate answer the
+// way an early return from the extraction loop would; it's simply
+// excluded on its own. family being "" (a multi-question message, or a
+// proactive lookup's combined A+AAAA result) is a no-op: there's no
+// single family to filter against.
+func filterIPTTLsByFamily(ipTTLs map[string]ipTTL, family string) map[string]ipTTL {
+	if family != "A" && family != "AAAA" {
+		return ipTTLs
+	}
+	wantIPv4 := family == "A"
+	for ip := range ipTTLs {
+		if isIPv4(ip) != wantIPv4 {
+			delete(ipTTLs, ip)
+		}
+	}
+	return ipTTLs
+}
+
+// extractSRVTargets returns the lowercased, unique set of target
+// hostnames carried by the SRV records in msg's answer section.
+func extractSRVTargets(msg *dns.Msg) []string {
+	seen := make(map[string]struct{})
+	var targets []string
+	for _, rr := range msg.Answer {
+		srv, ok := rr.(*dns.SRV)
+		if !ok {
+			continue
+		}
+		target := strings.ToLower(srv.Target)
+		if _, ok := seen[target]; ok {
+			continue
+		}
+		seen[target] = struct{}{}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// extractIPTTLsForName is extractIPTTLs restricted to records owned by
+// name, used to pick the glue addresses for a SRV target out of the same
+// message before falling back to an active lookup.
+func extractIPTTLsForName(msg *dns.Msg, name string, limit int) map[string]ipTTL {
+	ipTTLs := make(map[string]ipTTL)
+	for _, rr := range append(append([]dns.RR{}, msg.Answer...), msg.Extra...) {
+		if limit > 0 && len(ipTTLs) >= limit {
+			break
+		}
+		if !strings.EqualFold(rr.Header().Name, name) {
+			continue
+		}
+		switch a := rr.(type) {
+		case *dns.A:
+			ipTTLs[a.A.String()] = ipTTL{ip: a.A.String(), ttl: a.Hdr.Ttl}
+		case *dns.AAAA:
+			ipTTLs[a.AAAA.String()] = ipTTL{ip: a.AAAA.String(), ttl: a.Hdr.Ttl}
+		}
+	}
+	return ipTTLs
+}
+
+// updateAllAndRecordOutcome updates qname's status on every object in
+// objs concurrently, then records the combined result across all of them
+// as a single ocp_dnsnameresolver_update_outcome_total{dnsname,outcome}
+// observation. This is the case a single per-object updatesTotal counter
+// can't capture: several namespaces track the same DNS name, and one of
+// their objects failing to update while the others succeed is a
+// partial, not total, failure. When that happens, the failed objects are
+// offered to markDegraded, which upserts a Degraded condition on their
+// status once they've accumulated failureThreshold (or its per-object
+// annotation override) consecutive failures, so operators can tell their
+// replicas have diverged without a single transient failure flipping the
+// condition on its own. A succeeding object that had previously
+// accumulated failures is offered to clearDegraded, so a replica that
+// recovers doesn't stay marked Degraded forever. wg is the caller's
+// WaitGroup; it's Add'd
+// before this returns and Done when the outcome has been recorded.
+// catastrophicFailure is set when every object in objs failed to
+// update, for callers that want to react to a total failure (see
+// failOnUpdateError). family restricts which family of previously
+// resolved addresses ipTTLs is allowed to prune; see queryFamily.
+func (h *OCPDNSNameResolver) updateAllAndRecordOutcome(ctx context.Context, wg *sync.WaitGroup, objs []*object, qname string, ipTTLs map[string]ipTTL, family string, catastrophicFailure *atomic.Bool, parent *span) {
+	results := make([]error, len(objs))
+	targets := make([]string, len(objs))
+	var innerWG sync.WaitGroup
+	for i, o := range objs {
+		targets[i] = h.statusNameFor(o, qname)
+		innerWG.Add(1)
+		go func(i int, o *object) {
+			defer innerWG.Done()
+			nsSpan := parent.child("namespaceUpdate")
+			nsSpan.SetAttribute("namespace", o.namespace)
+			nsSpan.SetAttribute("qname", targets[i])
+			defer nsSpan.End()
+			results[i] = h.updateStatus(ctx, o, targets[i], ipTTLs, family, nsSpan)
+		}(i, o)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		innerWG.Wait()
+
+		succeeded, failed := 0, 0
+		for _, err := range results {
+			if err != nil {
+				failed++
+			} else {
+				succeeded++
+			}
+		}
+
+		outcome := "success"
+		switch {
+		case failed > 0 && succeeded > 0:
+			outcome = "partial"
+		case failed > 0:
+			outcome = "failure"
+			catastrophicFailure.Store(true)
+		}
+		// Labeled on each matched object's own registered dnsName, not
+		// qname: qname is the raw client-queried name, which under a
+		// tracked wildcard can be an unbounded number of distinct
+		// subdomains a client controls, while dnsName is bounded by what
+		// this plugin actually tracks (see updateOutcomeTotal).
+		recordedNames := make(map[string]struct{}, 1)
+		for _, o := range objs {
+			if _, ok := recordedNames[o.dnsName]; ok {
+				continue
+			}
+			recordedNames[o.dnsName] = struct{}{}
+			updateOutcomeTotal.WithLabelValues(o.dnsName, outcome).Inc()
+		}
+
+		for i, err := range results {
+			if err == nil && h.failureCounters.recordSuccess(objs[i].namespace+"/"+objs[i].name) {
+				h.clearDegraded(ctx, objs[i], targets[i])
+			}
+		}
+
+		if outcome != "partial" {
+			return
+		}
+		for i, err := range results {
+			if err != nil {
+				h.markDegraded(ctx, objs[i], targets[i])
+			}
+		}
+	}()
+}
+
+// warmupUpdate is one qname's worth of intended status update, buffered
+// while inWarmup() and applied by flushWarmupUpdates once warmupDeadline
+// passes. A later ServeDNS call for the same qname during warmup
+// overwrites the previous entry rather than queuing alongside it, so
+// only the most recently observed answer for a name survives to the
+// eventual write.
+type warmupUpdate struct {
+	objs   []*object
+	qname  string
+	ipTTLs map[string]ipTTL
+	family string
+}
+
+// startWarmup arms warmupDeadline and schedules flushWarmupUpdates to run
+// once it passes. Called from OnStartup only when warmupPeriod is
+// non-zero; a zero warmupDeadline (the default) means inWarmup always
+// reports false.
+func (h *OCPDNSNameResolver) startWarmup() {
+	h.warmupDeadline = time.Now().Add(h.warmupPeriod)
+	time.AfterFunc(h.warmupPeriod, h.flushWarmupUpdates)
+}
+
+// inWarmup reports whether status updates should currently be buffered
+// rather than applied immediately.
+func (h *OCPDNSNameResolver) inWarmup() bool {
+	return !h.warmupDeadline.IsZero() && time.Now().Before(h.warmupDeadline)
+}
+
+// bufferWarmupUpdate records qname's intended update for flushWarmupUpdates
+// to apply later, overwriting any update already buffered for the same
+// qname.
+func (h *OCPDNSNameResolver) bufferWarmupUpdate(objs []*object, qname string, ipTTLs map[string]ipTTL, family string) {
+	h.warmupMu.Lock()
+	defer h.warmupMu.Unlock()
+	h.pendingWarmupUpdates[qname] = &warmupUpdate{objs: objs, qname: qname, ipTTLs: ipTTLs, family: family}
+	warmupUpdatesDeferredTotal.Inc()
+}
+
+// flushWarmupUpdates applies every update buffered during warmup, one
+// updateAllAndRecordOutcome call per distinct qname, then clears
+// pendingWarmupUpdates so any update arriving after this point (inWarmup
+// now reports false) is applied immediately as usual.
+func (h *OCPDNSNameResolver) flushWarmupUpdates() {
+	h.warmupMu.Lock()
+	pending := h.pendingWarmupUpdates
+	h.pendingWarmupUpdates = make(map[string]*warmupUpdate)
+	h.warmupMu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.updateTimeout)
+	defer cancel()
+	root := newSpan("warmupFlush")
+	defer root.End()
+
+	var wg sync.WaitGroup
+	var catastrophicFailure atomic.Bool
+	for _, u := range pending {
+		h.updateAllAndRecordOutcome(ctx, &wg, u.objs, u.qname, u.ipTTLs, u.family, &catastrophicFailure, root)
+	}
+	wg.Wait()
+}
+
+// statusNameFor returns the DNS name o's status entry should be recorded
+// under for a query matching qname: qname itself, unless o is a wildcard
+// object and wildcardSubdomainTracking is disabled, in which case every
+// match is folded into a single entry under the wildcard's own name.
+func (h *OCPDNSNameResolver) statusNameFor(o *object, qname string) string {
+	if o.isWildcard && !h.wildcardSubdomainTracking {
+		return o.dnsName
+	}
+	return qname
+}
+
+// degradedConditionType is the Type of the condition markDegraded
+// upserts, so it (and any future reader) can find it by type rather than
+// assuming it's the only, or the first, condition on the entry.
+const degradedConditionType = "Degraded"
+
+// markDegraded upserts a Degraded condition on qname's resolved-name
+// entry in o's status, to surface that this namespace's replica failed
+// to update while at least one sibling namespace sharing the same DNS
+// name succeeded — but only once o has accumulated failureThreshold (or
+// its per-object failureThresholdAnnotation override) consecutive
+// failures, so a single transient failure doesn't flip the condition on
+// its own. It's addressed by type via meta.SetStatusCondition, not by
+// position, so it can't collide with or duplicate a NoAddresses
+// condition (or any other) already present on the same entry.
+func (h *OCPDNSNameResolver) markDegraded(ctx context.Context, o *object, qname string) {
+	lock := h.objectLocks.forObject(o.namespace, o.name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var resolverObj networkv1alpha1.DNSNameResolver
+	if err := h.client.Get(ctx, types.NamespacedName{Namespace: o.namespace, Name: o.name}, &resolverObj); err != nil {
+		return
+	}
+
+	threshold := effectiveFailureThreshold(resolverObj.Annotations, h.failureThreshold)
+	if h.failureCounters.recordFailure(o.namespace+"/"+o.name) < threshold {
+		return
+	}
+
+	newResolverObj := resolverObj.DeepCopy()
+	condition := metav1.Condition{
+		Type:    degradedConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  "PartialUpdateFailure",
+		Message: "this namespace's DNSNameResolver failed to update while at least one sibling namespace sharing this DNS name succeeded",
+	}
+	for i := range newResolverObj.Status.ResolvedNames {
+		if newResolverObj.Status.ResolvedNames[i].DNSName == networkv1alpha1.DNSName(qname) {
+			meta.SetStatusCondition(&newResolverObj.Status.ResolvedNames[i].Conditions, condition)
+			break
+		}
+	}
+
+	_ = h.client.Status().Update(ctx, newResolverObj)
+}
+
+// clearDegraded clears a previously-set Degraded condition on qname's
+// resolved-name entry in o's status, once o's update succeeds again
+// after a run of failures (see the recordSuccess call in
+// updateAllAndRecordOutcome). It's a no-op, without writing, when the
+// entry has no True Degraded condition to clear, so a recovering object
+// that never actually crossed failureThreshold doesn't cost an extra
+// apiserver write on every success.
+func (h *OCPDNSNameResolver) clearDegraded(ctx context.Context, o *object, qname string) {
+	lock := h.objectLocks.forObject(o.namespace, o.name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var resolverObj networkv1alpha1.DNSNameResolver
+	if err := h.client.Get(ctx, types.NamespacedName{Namespace: o.namespace, Name: o.name}, &resolverObj); err != nil {
+		return
+	}
+
+	newResolverObj := resolverObj.DeepCopy()
+	changed := false
+	for i := range newResolverObj.Status.ResolvedNames {
+		entry := &newResolverObj.Status.ResolvedNames[i]
+		if entry.DNSName != networkv1alpha1.DNSName(qname) {
+			continue
+		}
+		if !meta.IsStatusConditionTrue(entry.Conditions, degradedConditionType) {
+			return
+		}
+		meta.SetStatusCondition(&entry.Conditions, metav1.Condition{
+			Type:    degradedConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  "UpdateSucceeded",
+			Message: "this namespace's DNSNameResolver update succeeded after previously failing while at least one sibling namespace sharing this DNS name succeeded",
+		})
+		changed = true
+		break
+	}
+	if !changed {
+		return
+	}
+
+	_ = h.client.Status().Update(ctx, newResolverObj)
+}
+
+// noAddressesConditionType distinguishes "resolves successfully but to
+// zero addresses" (this condition, True) from "never resolved" (the
+// condition absent) and "resolution itself is failing" (Degraded). It's
+// kept separate from Degraded since a NODATA answer isn't an update
+// failure.
+const noAddressesConditionType = "NoAddresses"
+
+// setNoAddressesCondition upserts the NoAddresses condition on entry,
+// only touching LastTransitionTime when the status actually changes.
+// Reason and message are kept in sync independent of that check, so a
+// reason/message change that doesn't flip status (there isn't one today,
+// but the check doesn't assume there won't be) still lands instead of
+// silently sticking to whatever was recorded on the last status flip.
+func setNoAddressesCondition(entry *networkv1alpha1.DNSNameResolverResolvedName, noAddresses bool) {
+	status := metav1.ConditionFalse
+	if noAddresses {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&entry.Conditions, metav1.Condition{
+		Type:    noAddressesConditionType,
+		Status:  status,
+		Reason:  "ResolutionResult",
+		Message: "the tracked DNS name currently resolves successfully but to zero addresses",
+	})
+}
+
+// isIPv4 reports whether ip (as stored in a ResolvedAddress) is an IPv4
+// address, so mergeResolvedAddresses can tell which family a stored
+// address belongs to.
+func isIPv4(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.To4() != nil
+}
+
+// normalizeIP returns ip's canonical form for cross-family
+// deduplication: an IPv4-mapped IPv6 address (e.g. "::ffff:10.0.0.1")
+// collapses to its plain IPv4 form, since it represents the same
+// endpoint as (and would otherwise duplicate) that IPv4 address. Any
+// other address, or a string that doesn't parse as an IP at all, is
+// returned unchanged.
+func normalizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.String()
+	}
+	return ip
+}
+
+// mergeResolvedAddresses combines existing (the addresses currently
+// stored) with a fresh lookup result ipTTLs. When family is "A" or
+// "AAAA", existing addresses of that family are dropped unless they
+// reappear in ipTTLs, so stale addresses of a family that disappeared get
+// pruned, while addresses of the other family (populated by a separate
+// query) are left untouched. When family is "" the caller can't tell
+// which family, if either, went stale, so ipTTLs fully replaces existing.
+// familyOrder, if set to familyOrderV4First or familyOrderV6First, sorts
+// the result by family in that preference; see sortResolvedAddresses.
+func mergeResolvedAddresses(existing []networkv1alpha1.DNSNameResolverResolvedAddress, ipTTLs map[string]ipTTL, family string, now metav1.Time, familyOrder string, dedupe bool) []networkv1alpha1.DNSNameResolverResolvedAddress {
+	addresses := make([]networkv1alpha1.DNSNameResolverResolvedAddress, 0, len(existing)+len(ipTTLs))
+	var seen map[string]int
+	if dedupe {
+		seen = make(map[string]int, len(existing)+len(ipTTLs))
+	}
+	if family == "A" || family == "AAAA" {
+		wantIPv4 := family == "A"
+		for _, addr := range existing {
+			if isIPv4(addr.IP) != wantIPv4 {
+				if dedupe {
+					addr.IP = normalizeIP(addr.IP)
+					seen[addr.IP] = len(addresses)
+				}
+				addresses = append(addresses, addr)
+			}
+		}
+	}
+	for _, it := range ipTTLs {
+		ip := it.ip
+		if dedupe {
+			ip = normalizeIP(ip)
+			if idx, ok := seen[ip]; ok {
+				addresses[idx].TTLSeconds = int32(it.ttl)
+				addresses[idx].LastLookupTime = &now
+				continue
+			}
+			seen[ip] = len(addresses)
+		}
+		addresses = append(addresses, networkv1alpha1.DNSNameResolverResolvedAddress{
+			IP:             ip,
+			TTLSeconds:     int32(it.ttl),
+			LastLookupTime: &now,
+		})
+	}
+	sortResolvedAddresses(addresses, familyOrder)
+	return addresses
+}
+
+// sortResolvedAddresses stably reorders addresses so the family named by
+// familyOrder (familyOrderV4First or familyOrderV6First) sorts first,
+// leaving addresses within the same family in their existing relative
+// order. An unrecognized or empty familyOrder leaves addresses untouched,
+// which is the only sorting mergeResolvedAddresses' result gets today.
+func sortResolvedAddresses(addresses []networkv1alpha1.DNSNameResolverResolvedAddress, familyOrder string) {
+	var preferIPv4 bool
+	switch familyOrder {
+	case familyOrderV4First:
+		preferIPv4 = true
+	case familyOrderV6First:
+		preferIPv4 = false
+	default:
+		return
+	}
+	sort.SliceStable(addresses, func(i, j int) bool {
+		return isIPv4(addresses[i].IP) == preferIPv4 && isIPv4(addresses[j].IP) != preferIPv4
+	})
+}
+
+// entryLastLookupTime returns the most recent LastLookupTime across
+// entry's ResolvedAddresses, or the zero time if it has none, so
+// trimResolvedNamesToFit can rank a resolved-name entry by how recently
+// it was actually seen rather than by its position in the slice.
+func entryLastLookupTime(entry networkv1alpha1.DNSNameResolverResolvedName) time.Time {
+	var latest time.Time
+	for _, addr := range entry.ResolvedAddresses {
+		if addr.LastLookupTime != nil && addr.LastLookupTime.After(latest) {
+			latest = addr.LastLookupTime.Time
+		}
+	}
+	return latest
+}
+
+// trimResolvedNamesToFit evicts obj's resolved-name entries,
+// least-recently-seen first (see entryLastLookupTime), until obj's
+// serialized status fits within maxBytes. keepName (the entry the caller
+// just wrote) and wildcardBase (a wildcard object's own base name, if
+// any) are never evicted, so an update can't evict the very entry it
+// just wrote, and a wildcard object's base entry outlives the individual
+// subdomains wildcardSubdomainTracking recorded under it. If eviction
+// down to just the preserved entries still doesn't fit, it gives up
+// rather than evicting those too.
+func trimResolvedNamesToFit(obj *networkv1alpha1.DNSNameResolver, keepName, wildcardBase string, maxBytes int) {
+	for {
+		statusJSON, err := json.Marshal(obj.Status)
+		if err != nil || len(statusJSON) <= maxBytes {
+			return
+		}
+
+		victim := -1
+		var oldest time.Time
+		for i, entry := range obj.Status.ResolvedNames {
+			name := string(entry.DNSName)
+			if name == keepName || (wildcardBase != "" && name == wildcardBase) {
+				continue
+			}
+			if t := entryLastLookupTime(entry); victim == -1 || t.Before(oldest) {
+				victim, oldest = i, t
+			}
+		}
+		if victim == -1 {
+			return
+		}
+		obj.Status.ResolvedNames = append(obj.Status.ResolvedNames[:victim], obj.Status.ResolvedNames[victim+1:]...)
+	}
+}
+
+// updateDecisionRationale describes, for the logUpdateDecisions debug log
+// line, why updateStatus is about to write what it's about to write:
+// whether the object being updated was matched through a wildcard rather
+// than an exact tracked name, and whether the query name already had a
+// resolved-name entry being merged into versus a new one being appended.
+func updateDecisionRationale(matchedWildcard, foundResolvedName bool) string {
+	match := "matched exact tracked name"
+	if matchedWildcard {
+		match = "matched wildcard"
+	}
+	entry := "appending new resolved-name entry"
+	if foundResolvedName {
+		entry = "merging into existing resolved-name entry"
+	}
+	return match + ", " + entry
+}
+
+// updateStatus records the freshly resolved addresses for qname into o's
+// DNSNameResolver object status. family restricts pruning of stale
+// addresses to the family ipTTLs was resolved for; see queryFamily and
+// mergeResolvedAddresses.
+func (h *OCPDNSNameResolver) updateStatus(ctx context.Context, o *object, qname string, ipTTLs map[string]ipTTL, family string, parent *span) error {
+	start := time.Now()
+	defer func() { observeWithExemplar(ctx, updateDuration, time.Since(start).Seconds()) }()
+
+	updateSpan := parent.child("updateStatus")
+	updateSpan.SetAttribute("namespace", o.namespace)
+	updateSpan.SetAttribute("name", o.name)
+	defer updateSpan.End()
+
+	if l := h.limiters.forNamespace(o.namespace); l != nil {
+		if err := l.Wait(ctx); err != nil {
+			updatesTotal.WithLabelValues("error").Inc()
+			return err
+		}
+	}
+
+	newResolverObj, err := h.writeResolvedStatus(ctx, o, qname, ipTTLs, family)
+	if err != nil || newResolverObj == nil {
+		return err
+	}
+
+	// Instance-annotation and PTR enrichment run after writeResolvedStatus
+	// has already released the per-object lock: recordInstanceAnnotation
+	// is a ResourceVersion-free merge patch that doesn't need it, and
+	// recordPTRAnnotations' sequential PTR lookups are blocking network
+	// round trips that would otherwise stall an unrelated concurrent
+	// update to the same object for as long as this enrichment pass takes.
+	if h.instanceAnnotationKey != "" {
+		if err := h.recordInstanceAnnotation(ctx, newResolverObj); err != nil {
+			clog.Warningf("dnsnameresolver: failed to record instance annotation on %s/%s: %v", o.namespace, o.name, err)
+		}
+	}
+	if h.trackPTR {
+		if err := h.recordPTRAnnotations(ctx, newResolverObj); err != nil {
+			clog.Warningf("dnsnameresolver: failed to record PTR annotations on %s/%s: %v", o.namespace, o.name, err)
+		}
+	}
+
+	return nil
+}
+
+// writeResolvedStatus performs the locked Get/DeepCopy/write sequence of
+// a status update: it serializes per object via h.objectLocks, since two
+// goroutines updating the same object concurrently (e.g. an A and an
+// AAAA answer for the same name arriving close together) would otherwise
+// both Get the same ResourceVersion and race to write it back, costing
+// one of them a conflict error or a silently lost update. Returns the
+// written object on success, or (nil, nil) when the update was a benign
+// no-op — the object was deleted concurrently — that's already been
+// counted against updatesTotal.
+func (h *OCPDNSNameResolver) writeResolvedStatus(ctx context.Context, o *object, qname string, ipTTLs map[string]ipTTL, family string) (*networkv1alpha1.DNSNameResolver, error) {
+	lock := h.objectLocks.forObject(o.namespace, o.name)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var resolverObj networkv1alpha1.DNSNameResolver
+	if err := h.client.Get(ctx, types.NamespacedName{Namespace: o.namespace, Name: o.name}, &resolverObj); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The object was deleted between the reconciler's Get (which
+			// added it to h.objects) and this update; there's nothing left
+			// to update, so this isn't a failure worth counting as one.
+			updatesTotal.WithLabelValues("skipped").Inc()
+			return nil, nil
+		}
+		updatesTotal.WithLabelValues("error").Inc()
+		return nil, err
+	}
+
+	newResolverObj := resolverObj.DeepCopy()
+	now := metav1.Now()
+
+	// A plain linear scan by exact DNSName equality: it doesn't assume
+	// the matching entry sits at any particular index, or that a
+	// wildcard-backed entry sorts before or after a regular one, so it
+	// can't skip a later match once an earlier, different entry has been
+	// looked at.
+	found := false
+	for i := range newResolverObj.Status.ResolvedNames {
+		if newResolverObj.Status.ResolvedNames[i].DNSName == networkv1alpha1.DNSName(qname) {
+			addresses := mergeResolvedAddresses(newResolverObj.Status.ResolvedNames[i].ResolvedAddresses, ipTTLs, family, now, h.familyOrder, h.dedupeResolvedAddresses)
+			newResolverObj.Status.ResolvedNames[i].ResolvedAddresses = addresses
+			setNoAddressesCondition(&newResolverObj.Status.ResolvedNames[i], len(addresses) == 0)
+			found = true
+			break
+		}
+	}
+	if !found {
+		addresses := mergeResolvedAddresses(nil, ipTTLs, family, now, h.familyOrder, h.dedupeResolvedAddresses)
+		entry := networkv1alpha1.DNSNameResolverResolvedName{
+			DNSName:           networkv1alpha1.DNSName(qname),
+			ResolvedAddresses: addresses,
+		}
+		setNoAddressesCondition(&entry, len(addresses) == 0)
+		newResolverObj.Status.ResolvedNames = append(newResolverObj.Status.ResolvedNames, entry)
+	}
+
+	if h.logUpdateDecisions {
+		clog.Debugf("dnsnameresolver: updating %s/%s for %q: %s", o.namespace, o.name, qname, updateDecisionRationale(o.isWildcard, found))
+	}
+
+	if h.maxStatusBytes > 0 {
+		wildcardBase := ""
+		if o.isWildcard {
+			wildcardBase = o.dnsName
+		}
+		trimResolvedNamesToFit(newResolverObj, qname, wildcardBase, h.maxStatusBytes)
+	}
+
+	if statusJSON, err := json.Marshal(newResolverObj.Status); err == nil {
+		statusBytes.WithLabelValues(o.namespace, o.name).Set(float64(len(statusJSON)))
+	}
+
+	if err := h.writeStatus(ctx, newResolverObj); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The object was deleted between the Get above and this write;
+			// same benign no-op as the Get case.
+			updatesTotal.WithLabelValues("skipped").Inc()
+			return nil, nil
+		}
+		updatesTotal.WithLabelValues("error").Inc()
+		return nil, err
+	}
+
+	updatesTotal.WithLabelValues("success").Inc()
+	return newResolverObj, nil
+}
+
+// annotationPatch is the merge-patch body recordInstanceAnnotation sends.
+type annotationPatch struct {
+	Metadata struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+// recordInstanceAnnotation stamps obj with which plugin instance last
+// updated it (see the instanceAnnotation directive), as a merge patch
+// touching only metadata.annotations. A merge patch doesn't require a
+// matching ResourceVersion, so this can't conflict with (or be reverted
+// by) a concurrent status write to the same object.
+func (h *OCPDNSNameResolver) recordInstanceAnnotation(ctx context.Context, obj *networkv1alpha1.DNSNameResolver) error {
+	var p annotationPatch
+	p.Metadata.Annotations = map[string]string{h.instanceAnnotationKey: instanceID()}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return h.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
+}
+
+// instanceID identifies this plugin instance for the instanceAnnotation
+// directive: POD_NAME (set by the Kubernetes Downward API in a typical
+// Deployment/DaemonSet) if set, falling back to os.Hostname(), which is
+// the pod name too when POD_NAME isn't explicitly configured.
+func instanceID() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return host
+}
+
+// writeStatus persists obj's status using the configured applyMode.
+func (h *OCPDNSNameResolver) writeStatus(ctx context.Context, obj *networkv1alpha1.DNSNameResolver) error {
+	if h.applyMode != applyModeServerSideApply {
+		return h.client.Status().Update(ctx, obj)
+	}
+
+	// A server-side apply patch is serialized as JSON and needs its own
+	// APIVersion/Kind, which a typed Get response doesn't carry.
+	gvk, err := apiutil.GVKForObject(obj, h.client.Scheme())
+	if err != nil {
+		return err
+	}
+	applyObj := &networkv1alpha1.DNSNameResolver{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: obj.Namespace,
+			Name:      obj.Name,
+		},
+		Status: obj.Status,
+	}
+	applyObj.SetGroupVersionKind(gvk)
+	return h.client.Status().Patch(ctx, applyObj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
@@ -0,0 +1,3144 @@
+package dnsnameresolver
+
+import (
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	dto "github.com/prometheus/client_model/go"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestExtractIPTTLs(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.AAAA{Hdr: dns.RR_Header{Name: "example.com.", Ttl: 60}, AAAA: net.ParseIP("::1")},
+		&dns.CNAME{Hdr: dns.RR_Header{Name: "example.com."}, Target: "other.example.com."},
+	}
+
+	got := extractIPTTLs(msg, 0, false)
+	if len(got) != 2 {
+		t.Fatalf("extractIPTTLs() returned %d entries, want 2", len(got))
+	}
+	if got["10.0.0.1"].ttl != 30 {
+		t.Errorf("unexpected TTL for 10.0.0.1: %d", got["10.0.0.1"].ttl)
+	}
+	if got["::1"].ttl != 60 {
+		t.Errorf("unexpected TTL for ::1: %d", got["::1"].ttl)
+	}
+}
+
+func TestExtractIPTTLsAnswerLimit(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.2")},
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.3")},
+	}
+
+	if got := extractIPTTLs(msg, 2, false); len(got) != 2 {
+		t.Fatalf("extractIPTTLs() with limit 2 returned %d entries, want 2", len(got))
+	}
+	if got := extractIPTTLs(msg, 0, false); len(got) != 3 {
+		t.Fatalf("extractIPTTLs() with limit 0 returned %d entries, want 3 (unlimited)", len(got))
+	}
+}
+
+// TestExtractIPTTLsFollowSVCBAddsHints verifies that, with followSVCB
+// set, ipv4hint/ipv6hint addresses from an HTTPS record are folded in
+// alongside a plain A record for the same name.
+func TestExtractIPTTLsFollowSVCBAddsHints(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.HTTPS{SVCB: dns.SVCB{
+			Hdr:      dns.RR_Header{Name: "example.com.", Ttl: 300},
+			Priority: 1,
+			Target:   ".",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBIPv4Hint{Hint: []net.IP{net.ParseIP("10.0.0.2")}},
+				&dns.SVCBIPv6Hint{Hint: []net.IP{net.ParseIP("::2")}},
+			},
+		}},
+	}
+
+	got := extractIPTTLs(msg, 0, true)
+	if len(got) != 3 {
+		t.Fatalf("extractIPTTLs() with followSVCB returned %d entries, want 3: %+v", len(got), got)
+	}
+	if got["10.0.0.2"].ttl != 300 {
+		t.Errorf("unexpected TTL for ipv4hint 10.0.0.2: %d, want the HTTPS record's own TTL (300)", got["10.0.0.2"].ttl)
+	}
+	if got["::2"].ttl != 300 {
+		t.Errorf("unexpected TTL for ipv6hint ::2: %d, want the HTTPS record's own TTL (300)", got["::2"].ttl)
+	}
+}
+
+// TestExtractIPTTLsIgnoresSVCBWhenDisabled verifies that, without
+// followSVCB set, HTTPS/SVCB records are ignored entirely.
+func TestExtractIPTTLsIgnoresSVCBWhenDisabled(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.HTTPS{SVCB: dns.SVCB{
+			Hdr:      dns.RR_Header{Name: "example.com.", Ttl: 300},
+			Priority: 1,
+			Target:   ".",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBIPv4Hint{Hint: []net.IP{net.ParseIP("10.0.0.2")}},
+			},
+		}},
+	}
+
+	if got := extractIPTTLs(msg, 0, false); len(got) != 1 {
+		t.Fatalf("extractIPTTLs() with followSVCB disabled returned %d entries, want 1 (the A record only)", len(got))
+	}
+}
+
+// TestExtractIPTTLsFollowSVCBRespectsAnswerLimit verifies that hints
+// pulled from an HTTPS/SVCB record still count against the same limit as
+// A/AAAA addresses.
+func TestExtractIPTTLsFollowSVCBRespectsAnswerLimit(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.HTTPS{SVCB: dns.SVCB{
+			Hdr:      dns.RR_Header{Name: "example.com.", Ttl: 300},
+			Priority: 1,
+			Target:   ".",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBIPv4Hint{Hint: []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3")}},
+			},
+		}},
+	}
+
+	if got := extractIPTTLs(msg, 2, true); len(got) != 2 {
+		t.Fatalf("extractIPTTLs() with limit 2 and followSVCB returned %d entries, want 2", len(got))
+	}
+}
+
+// TestRoundTTL verifies that slightly-varying upstream TTLs (e.g. 29, 30,
+// 31 from caching skew) all round to the same stored value, which is what
+// lets a serverSideApply patch of otherwise-unchanged data become a true
+// no-op instead of a fresh write.
+func TestRoundTTL(t *testing.T) {
+	tests := []struct {
+		ttl, granularity, want uint32
+	}{
+		{29, 5, 30},
+		{30, 5, 30},
+		{31, 5, 30},
+		{32, 5, 30},
+		{33, 5, 35},
+		{0, 5, 0},
+		{2, 5, 5},
+	}
+	for _, tt := range tests {
+		if got := roundTTL(tt.ttl, tt.granularity); got != tt.want {
+			t.Errorf("roundTTL(%d, %d) = %d, want %d", tt.ttl, tt.granularity, got, tt.want)
+		}
+	}
+}
+
+// TestRoundIPTTLsReducesDistinctValues verifies that rounding collapses a
+// set of near-identical TTLs, observed across successive lookups, down to
+// a single stored value.
+func TestRoundIPTTLsReducesDistinctValues(t *testing.T) {
+	lookups := []map[string]ipTTL{
+		{"10.0.0.1": {ip: "10.0.0.1", ttl: 29}},
+		{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}},
+		{"10.0.0.1": {ip: "10.0.0.1", ttl: 31}},
+	}
+
+	distinctUnrounded := map[uint32]bool{}
+	distinctRounded := map[uint32]bool{}
+	for _, ipTTLs := range lookups {
+		distinctUnrounded[ipTTLs["10.0.0.1"].ttl] = true
+		rounded := roundIPTTLs(ipTTLs, 5)
+		distinctRounded[rounded["10.0.0.1"].ttl] = true
+	}
+
+	if len(distinctUnrounded) != 3 {
+		t.Fatalf("distinct unrounded TTLs = %d, want 3 (test setup should vary the TTL)", len(distinctUnrounded))
+	}
+	if len(distinctRounded) != 1 {
+		t.Errorf("distinct rounded TTLs = %d, want 1: %v", len(distinctRounded), distinctRounded)
+	}
+}
+
+// TestApplyZeroTTLPolicyStoreLeavesTTLsUntouched verifies that the
+// default zeroTTLPolicyStore mode is a no-op.
+func TestApplyZeroTTLPolicyStoreLeavesTTLsUntouched(t *testing.T) {
+	h := New()
+	ipTTLs := map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 0}}
+
+	got := h.applyZeroTTLPolicy(ipTTLs, "foo.example.com.")
+	if got["10.0.0.1"].ttl != 0 {
+		t.Errorf("ttl = %d, want 0 unchanged under zeroTTLPolicyStore", got["10.0.0.1"].ttl)
+	}
+}
+
+// TestApplyZeroTTLPolicySkipDropsZeroTTLEntries verifies that
+// zeroTTLPolicySkip drops TTL-0 entries but leaves others alone.
+func TestApplyZeroTTLPolicySkipDropsZeroTTLEntries(t *testing.T) {
+	h := New()
+	h.zeroTTLPolicy = zeroTTLPolicySkip
+	ipTTLs := map[string]ipTTL{
+		"10.0.0.1": {ip: "10.0.0.1", ttl: 0},
+		"10.0.0.2": {ip: "10.0.0.2", ttl: 30},
+	}
+
+	got := h.applyZeroTTLPolicy(ipTTLs, "foo.example.com.")
+	if _, ok := got["10.0.0.1"]; ok {
+		t.Error("expected the TTL-0 entry to be dropped under zeroTTLPolicySkip")
+	}
+	if _, ok := got["10.0.0.2"]; !ok {
+		t.Error("expected the non-zero-TTL entry to survive zeroTTLPolicySkip")
+	}
+}
+
+// TestApplyZeroTTLPolicyFloorRaisesZeroTTL verifies that
+// zeroTTLPolicyFloor raises a TTL-0 entry to zeroTTLMinimum without
+// touching entries that already have a non-zero TTL.
+func TestApplyZeroTTLPolicyFloorRaisesZeroTTL(t *testing.T) {
+	h := New()
+	h.zeroTTLPolicy = zeroTTLPolicyFloor
+	h.zeroTTLMinimum = 30
+	ipTTLs := map[string]ipTTL{
+		"10.0.0.1": {ip: "10.0.0.1", ttl: 0},
+		"10.0.0.2": {ip: "10.0.0.2", ttl: 60},
+	}
+
+	got := h.applyZeroTTLPolicy(ipTTLs, "foo.example.com.")
+	if got["10.0.0.1"].ttl != 30 {
+		t.Errorf("ttl = %d, want 30 (floored)", got["10.0.0.1"].ttl)
+	}
+	if got["10.0.0.2"].ttl != 60 {
+		t.Errorf("ttl = %d, want 60 unchanged", got["10.0.0.2"].ttl)
+	}
+}
+
+// TestApplyZeroTTLPolicyStoreVolatileFloorsAndReschedules verifies that
+// zeroTTLPolicyStoreVolatile both floors the TTL like zeroTTLPolicyFloor
+// and brings the tracked name's next proactive lookup forward to now.
+func TestApplyZeroTTLPolicyStoreVolatileFloorsAndReschedules(t *testing.T) {
+	h := New()
+	h.zeroTTLPolicy = zeroTTLPolicyStoreVolatile
+	h.zeroTTLMinimum = 30
+	// Restore a far-future nextLookupTime before Add so Add takes the
+	// "resuming from a snapshot" branch instead of spawning a background
+	// lookup goroutine that would race with this test's own reads.
+	h.resolver.Restore(SchedulerSnapshot{
+		"foo.example.com.": {NextLookupTime: time.Now().Add(time.Hour)},
+	})
+	h.resolver.Add("ns1", "foo.example.com.", false)
+
+	ipTTLs := map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 0}}
+	got := h.applyZeroTTLPolicy(ipTTLs, "foo.example.com.")
+	if got["10.0.0.1"].ttl != 30 {
+		t.Errorf("ttl = %d, want 30 (floored)", got["10.0.0.1"].ttl)
+	}
+
+	h.resolver.mu.Lock()
+	next := h.resolver.dnsNames["foo.example.com."].nextLookupTime
+	h.resolver.mu.Unlock()
+	if next.After(time.Now()) {
+		t.Errorf("nextLookupTime = %v, want it brought forward to now by storeVolatile", next)
+	}
+}
+
+// TestApplyMaxAddressAgeDisabledByDefault verifies applyMaxAddressAge is a
+// no-op while maxAddressAge is unset, regardless of how long an address
+// has been tracked.
+func TestApplyMaxAddressAgeDisabledByDefault(t *testing.T) {
+	h := New()
+	h.addressAges.firstSeen["foo.example.com."] = map[string]time.Time{
+		"10.0.0.1": time.Now().Add(-24 * time.Hour),
+	}
+	ipTTLs := map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}
+
+	h.applyMaxAddressAge("foo.example.com.", ipTTLs, time.Now())
+
+	seen := h.addressAges.observe("foo.example.com.", "10.0.0.1", time.Now())
+	if !seen.Before(time.Now().Add(-23 * time.Hour)) {
+		t.Errorf("first-seen time was reset even though maxAddressAge is disabled")
+	}
+}
+
+// TestApplyMaxAddressAgeUnderThresholdLeavesTrackingUntouched verifies an
+// address younger than maxAddressAge keeps its original first-seen time
+// and doesn't trigger a rescheduled lookup.
+func TestApplyMaxAddressAgeUnderThresholdLeavesTrackingUntouched(t *testing.T) {
+	h := New()
+	h.maxAddressAge = time.Hour
+	now := time.Now()
+	firstSeen := now.Add(-10 * time.Minute)
+	h.addressAges.firstSeen["foo.example.com."] = map[string]time.Time{"10.0.0.1": firstSeen}
+	h.resolver.Restore(SchedulerSnapshot{
+		"foo.example.com.": {NextLookupTime: now.Add(time.Hour)},
+	})
+	h.resolver.Add("ns1", "foo.example.com.", false)
+
+	h.applyMaxAddressAge("foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, now)
+
+	if got := h.addressAges.observe("foo.example.com.", "10.0.0.1", now); !got.Equal(firstSeen) {
+		t.Errorf("first-seen time = %v, want unchanged %v", got, firstSeen)
+	}
+	h.resolver.mu.Lock()
+	next := h.resolver.dnsNames["foo.example.com."].nextLookupTime
+	h.resolver.mu.Unlock()
+	if !next.After(now) {
+		t.Errorf("nextLookupTime = %v, want left untouched in the future", next)
+	}
+}
+
+// TestApplyMaxAddressAgeOverThresholdResetsAndReschedules verifies an
+// address that's been tracked for at least maxAddressAge has its
+// first-seen time reset and the tracked name's next lookup brought
+// forward to now.
+func TestApplyMaxAddressAgeOverThresholdResetsAndReschedules(t *testing.T) {
+	h := New()
+	h.maxAddressAge = time.Hour
+	now := time.Now()
+	h.addressAges.firstSeen["foo.example.com."] = map[string]time.Time{
+		"10.0.0.1": now.Add(-2 * time.Hour),
+	}
+	h.resolver.Restore(SchedulerSnapshot{
+		"foo.example.com.": {NextLookupTime: now.Add(time.Hour)},
+	})
+	h.resolver.Add("ns1", "foo.example.com.", false)
+
+	h.applyMaxAddressAge("foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, now)
+
+	if got := h.addressAges.observe("foo.example.com.", "10.0.0.1", now); !got.Equal(now) {
+		t.Errorf("first-seen time = %v, want reset to %v", got, now)
+	}
+	h.resolver.mu.Lock()
+	next := h.resolver.dnsNames["foo.example.com."].nextLookupTime
+	h.resolver.mu.Unlock()
+	if next.After(time.Now()) {
+		t.Errorf("nextLookupTime = %v, want brought forward to now once maxAddressAge was exceeded", next)
+	}
+}
+
+func TestExtractSRVTargets(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.SRV{Hdr: dns.RR_Header{Name: "_svc._tcp.example.com."}, Target: "Host1.Example.com."},
+		&dns.SRV{Hdr: dns.RR_Header{Name: "_svc._tcp.example.com."}, Target: "host1.example.com."},
+		&dns.SRV{Hdr: dns.RR_Header{Name: "_svc._tcp.example.com."}, Target: "host2.example.com."},
+	}
+
+	got := extractSRVTargets(msg)
+	if len(got) != 2 {
+		t.Fatalf("extractSRVTargets() returned %d targets, want 2 (deduped, case-insensitive): %v", len(got), got)
+	}
+}
+
+func TestExtractIPTTLsForName(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.Extra = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "host1.example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.A{Hdr: dns.RR_Header{Name: "other.example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.2")},
+	}
+
+	got := extractIPTTLsForName(msg, "host1.example.com.", 0)
+	if len(got) != 1 {
+		t.Fatalf("extractIPTTLsForName() returned %d entries, want 1", len(got))
+	}
+	if _, ok := got["10.0.0.1"]; !ok {
+		t.Errorf("expected 10.0.0.1 in result, got %v", got)
+	}
+}
+
+// TestSRVTargetResolutionRecorded verifies that a SRV target's glue
+// addresses, once extracted, are recorded into the matched object's
+// status the same way an A/AAAA answer for the tracked name itself is.
+func TestSRVTargetResolutionRecorded(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "ns1"
+	resolverObj.Name = "obj1"
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := New()
+	h.client = fakeClient
+	h.followSRV = true
+	h.addOrUpdateObject("ns1", "obj1", "_svc._tcp.example.com.", false)
+
+	msg := new(dns.Msg)
+	msg.Answer = []dns.RR{
+		&dns.SRV{Hdr: dns.RR_Header{Name: "_svc._tcp.example.com."}, Target: "host1.example.com."},
+	}
+	msg.Extra = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: "host1.example.com.", Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+	}
+
+	matches := h.matchingObjects("_svc._tcp.example.com.")
+	if len(matches) != 1 {
+		t.Fatalf("matchingObjects() returned %d matches, want 1", len(matches))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	h.updateStatus(ctx, matches[0], "host1.example.com.", extractIPTTLsForName(msg, "host1.example.com.", 0), "", nil)
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 || got.Status.ResolvedNames[0].DNSName != "host1.example.com." {
+		t.Fatalf("expected the SRV target's resolution to be recorded, got %+v", got.Status.ResolvedNames)
+	}
+}
+
+func TestMatchingObjects(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		objects:   make(map[string]*object),
+		byName:    make(map[string]map[string]*object),
+		wildcards: make(map[string]map[string]*object),
+	}
+	h.addOrUpdateObject("ns1", "exact", "foo.example.com.", false)
+	h.addOrUpdateObject("ns1", "wild", "*.example.com.", true)
+
+	matches := h.matchingObjects("foo.example.com.")
+	if len(matches) != 2 {
+		t.Fatalf("matchingObjects() returned %d matches, want 2", len(matches))
+	}
+
+	matches = h.matchingObjects("bar.example.com.")
+	if len(matches) != 1 {
+		t.Fatalf("matchingObjects() returned %d matches, want 1", len(matches))
+	}
+}
+
+// TestMatchingObjectsExactWildcardName verifies that when a regular
+// object and a wildcard object are both registered under the literal
+// wildcard string "*.example.com.", a query for that literal name
+// returns each object exactly once rather than duplicating either.
+func TestMatchingObjectsExactWildcardName(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		objects:   make(map[string]*object),
+		byName:    make(map[string]map[string]*object),
+		wildcards: make(map[string]map[string]*object),
+	}
+	h.addOrUpdateObject("ns1", "literal", "*.example.com.", false)
+	h.addOrUpdateObject("ns1", "wild", "*.example.com.", true)
+
+	matches := h.matchingObjects("*.example.com.")
+	if len(matches) != 2 {
+		t.Fatalf("matchingObjects() returned %d matches, want 2 distinct objects", len(matches))
+	}
+	if matches[0] == matches[1] {
+		t.Fatalf("matchingObjects() returned the same object twice")
+	}
+}
+
+// TestMatchingObjectsMostSpecificWildcardWins verifies that when both
+// "*.sub.example.com." and "*.example.com." are tracked, a query for a
+// name under the narrower wildcard updates only that object, not the
+// broader one too.
+func TestMatchingObjectsMostSpecificWildcardWins(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		objects:   make(map[string]*object),
+		byName:    make(map[string]map[string]*object),
+		wildcards: make(map[string]map[string]*object),
+	}
+	h.addOrUpdateObject("ns1", "broad", "*.example.com.", true)
+	h.addOrUpdateObject("ns1", "narrow", "*.sub.example.com.", true)
+
+	matches := h.matchingObjects("foo.sub.example.com.")
+	if len(matches) != 1 {
+		t.Fatalf("matchingObjects() returned %d matches, want 1 (the most specific wildcard only)", len(matches))
+	}
+	if matches[0].name != "narrow" {
+		t.Errorf("matchingObjects() matched object %q, want %q", matches[0].name, "narrow")
+	}
+}
+
+// TestMatchingObjectsFallsBackToBroaderWildcard verifies that a name only
+// covered by the broader wildcard still matches it when the narrower
+// wildcard doesn't apply.
+func TestMatchingObjectsFallsBackToBroaderWildcard(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		objects:   make(map[string]*object),
+		byName:    make(map[string]map[string]*object),
+		wildcards: make(map[string]map[string]*object),
+	}
+	h.addOrUpdateObject("ns1", "broad", "*.example.com.", true)
+	h.addOrUpdateObject("ns1", "narrow", "*.sub.example.com.", true)
+
+	matches := h.matchingObjects("other.example.com.")
+	if len(matches) != 1 {
+		t.Fatalf("matchingObjects() returned %d matches, want 1", len(matches))
+	}
+	if matches[0].name != "broad" {
+		t.Errorf("matchingObjects() matched object %q, want %q", matches[0].name, "broad")
+	}
+}
+
+// TestAddOrUpdateObjectDisableWildcardsRejectsWildcard verifies that with
+// disableWildcards set, a wildcard object is never added to the wildcard
+// index at all.
+func TestAddOrUpdateObjectDisableWildcardsRejectsWildcard(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		objects:          make(map[string]*object),
+		byName:           make(map[string]map[string]*object),
+		wildcards:        make(map[string]map[string]*object),
+		disableWildcards: true,
+	}
+	h.addOrUpdateObject("ns1", "wild", "*.example.com.", true)
+
+	if len(h.wildcards) != 0 {
+		t.Fatalf("wildcards index after addOrUpdateObject() with disableWildcards = %v, want empty", h.wildcards)
+	}
+	if matches := h.matchingObjects("foo.example.com."); len(matches) != 0 {
+		t.Fatalf("matchingObjects() = %v, want no matches for a rejected wildcard object", matches)
+	}
+}
+
+// TestMatchingObjectsDisableWildcardsSkipsWildcardLookup verifies that
+// with disableWildcards set, a query for a name a wildcard object would
+// otherwise cover doesn't match it, even if it was already tracked before
+// disableWildcards took effect (e.g. across a Corefile reload).
+func TestMatchingObjectsDisableWildcardsSkipsWildcardLookup(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		objects:   make(map[string]*object),
+		byName:    make(map[string]map[string]*object),
+		wildcards: make(map[string]map[string]*object),
+	}
+	h.addOrUpdateObject("ns1", "wild", "*.example.com.", true)
+	h.disableWildcards = true
+
+	if matches := h.matchingObjects("foo.example.com."); len(matches) != 0 {
+		t.Fatalf("matchingObjects() = %v, want no matches once disableWildcards is set", matches)
+	}
+}
+
+// TestAddOrUpdateObjectDetectsDuplicate verifies that a second object in
+// the same namespace tracking the same DNS name increments
+// duplicate_objects_total instead of silently clobbering the first
+// object's fast-lookup entry.
+func TestAddOrUpdateObjectDetectsDuplicate(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		objects:   make(map[string]*object),
+		byName:    make(map[string]map[string]*object),
+		wildcards: make(map[string]map[string]*object),
+	}
+
+	readDuplicates := func() float64 {
+		var m dto.Metric
+		if err := duplicateObjectsTotal.WithLabelValues("ns1").Write(&m); err != nil {
+			t.Fatalf("failed to read duplicate_objects_total: %v", err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	before := readDuplicates()
+
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	if got := readDuplicates(); got != before {
+		t.Fatalf("duplicate_objects_total after the first object = %v, want unchanged at %v", got, before)
+	}
+
+	h.addOrUpdateObject("ns1", "obj2", "foo.example.com.", false)
+	if got := readDuplicates(); got != before+1 {
+		t.Fatalf("duplicate_objects_total after a duplicate object = %v, want %v", got, before+1)
+	}
+
+	matches := h.matchingObjects("foo.example.com.")
+	if len(matches) != 1 || matches[0].name != "obj2" {
+		t.Fatalf("matchingObjects() = %v, want only the most recently reconciled object (obj2)", matches)
+	}
+}
+
+// TestUpdateStatusApplyModes verifies that updateStatus writes the same
+// resolved-name content in both the default updateStatus mode and the
+// serverSideApply mode, differing only in how it's persisted.
+func TestUpdateStatusApplyModes(t *testing.T) {
+	newResolverObj := func() *networkv1alpha1.DNSNameResolver {
+		o := &networkv1alpha1.DNSNameResolver{}
+		o.Namespace = "ns1"
+		o.Name = "obj1"
+		return o
+	}
+
+	t.Run("updateStatus", func(t *testing.T) {
+		resolverObj := newResolverObj()
+		fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+		h := &OCPDNSNameResolver{client: fakeClient, updateTimeout: time.Second, applyMode: applyModeUpdateStatus}
+		o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+		if err := h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil); err != nil {
+			t.Fatalf("updateStatus() error = %v", err)
+		}
+
+		var got networkv1alpha1.DNSNameResolver
+		if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(resolverObj), &got); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if len(got.Status.ResolvedNames) != 1 || len(got.Status.ResolvedNames[0].ResolvedAddresses) != 1 {
+			t.Fatalf("status after updateStatus mode = %+v, want one resolved name with one address", got.Status)
+		}
+	})
+
+	t.Run("serverSideApply", func(t *testing.T) {
+		resolverObj := newResolverObj()
+		fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+		var gotPatch client.Patch
+		var gotObj client.Object
+		patchClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, subResourceName string, c client.Client, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				gotPatch, gotObj = patch, obj
+				// The fake client's server-side apply merge behavior
+				// isn't representative of a real apiserver's; assert on
+				// the shape of the request instead of round-tripping it.
+				return nil
+			},
+		})
+
+		h := &OCPDNSNameResolver{client: patchClient, updateTimeout: time.Second, applyMode: applyModeServerSideApply}
+		o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+		if err := h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil); err != nil {
+			t.Fatalf("updateStatus() error = %v", err)
+		}
+
+		if gotPatch != client.Apply {
+			t.Fatalf("Status().Patch() patch = %v, want client.Apply", gotPatch)
+		}
+		applyObj, ok := gotObj.(*networkv1alpha1.DNSNameResolver)
+		if !ok {
+			t.Fatalf("Status().Patch() object type = %T, want *networkv1alpha1.DNSNameResolver", gotObj)
+		}
+		if len(applyObj.Status.ResolvedNames) != 1 || len(applyObj.Status.ResolvedNames[0].ResolvedAddresses) != 1 {
+			t.Fatalf("apply object status = %+v, want one resolved name with one address", applyObj.Status)
+		}
+	})
+}
+
+// TestUpdateStatusRecordsStatusBytes verifies the ocp_dnsnameresolver_status_bytes
+// gauge reflects the serialized size of the status the plugin just wrote.
+func TestUpdateStatusRecordsStatusBytes(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "ns1"
+	resolverObj.Name = "obj1"
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := &OCPDNSNameResolver{client: fakeClient, updateTimeout: time.Second}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil)
+
+	metric := statusBytes.WithLabelValues("ns1", "obj1")
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatalf("failed to read metric: %v", err)
+	}
+	if got := m.GetGauge().GetValue(); got <= 0 {
+		t.Errorf("status_bytes gauge = %v, want a positive size", got)
+	}
+}
+
+// TestSetNoAddressesConditionRefreshesReasonWithoutStatusChange verifies
+// that a reason/message mismatch is corrected even when status itself
+// doesn't change, without bumping LastTransitionTime for that correction.
+func TestSetNoAddressesConditionRefreshesReasonWithoutStatusChange(t *testing.T) {
+	staleTime := metav1.NewTime(time.Now().Add(-time.Hour))
+	entry := &networkv1alpha1.DNSNameResolverResolvedName{
+		Conditions: []metav1.Condition{{
+			Type:               noAddressesConditionType,
+			Status:             metav1.ConditionFalse,
+			Reason:             "SomeStaleReason",
+			Message:            "some stale message",
+			LastTransitionTime: staleTime,
+		}},
+	}
+
+	setNoAddressesCondition(entry, false)
+
+	if len(entry.Conditions) != 1 {
+		t.Fatalf("Conditions = %+v, want exactly one NoAddresses condition", entry.Conditions)
+	}
+	got := entry.Conditions[0]
+	if got.Reason != "ResolutionResult" || got.Message != "the tracked DNS name currently resolves successfully but to zero addresses" {
+		t.Errorf("Reason/Message = %q/%q, want the current reason/message even though status didn't change", got.Reason, got.Message)
+	}
+	if !got.LastTransitionTime.Equal(&staleTime) {
+		t.Errorf("LastTransitionTime = %v, want unchanged at %v since status itself didn't change", got.LastTransitionTime, staleTime)
+	}
+}
+
+// TestSetNoAddressesConditionFindsConditionByTypeNotPosition verifies
+// that setNoAddressesCondition locates its NoAddresses condition by Type
+// even when a Degraded condition already occupies index 0, instead of
+// assuming its own condition is always first (or only).
+func TestSetNoAddressesConditionFindsConditionByTypeNotPosition(t *testing.T) {
+	entry := &networkv1alpha1.DNSNameResolverResolvedName{
+		Conditions: []metav1.Condition{
+			{Type: degradedConditionType, Status: metav1.ConditionTrue, Reason: "PartialUpdateFailure", Message: "degraded"},
+			{Type: noAddressesConditionType, Status: metav1.ConditionFalse, Reason: "ResolutionResult", Message: "old message"},
+		},
+	}
+
+	setNoAddressesCondition(entry, true)
+
+	if len(entry.Conditions) != 2 {
+		t.Fatalf("Conditions = %+v, want the pre-existing Degraded condition left alone, not duplicated", entry.Conditions)
+	}
+	if entry.Conditions[0].Type != degradedConditionType {
+		t.Errorf("Conditions[0].Type = %q, want the Degraded condition untouched at its original position", entry.Conditions[0].Type)
+	}
+	noAddresses := meta.FindStatusCondition(entry.Conditions, noAddressesConditionType)
+	if noAddresses == nil || noAddresses.Status != metav1.ConditionTrue {
+		t.Errorf("NoAddresses condition = %+v, want status True", noAddresses)
+	}
+}
+
+// TestUpdateStatusNoAddressesConditionTransitions verifies that
+// updateStatus sets NoAddresses=True on a NODATA-style update (no
+// resolved addresses) and clears it back to False once addresses are
+// resolved again.
+func TestUpdateStatusNoAddressesConditionTransitions(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "ns1"
+	resolverObj.Name = "obj1"
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := &OCPDNSNameResolver{client: fakeClient, updateTimeout: time.Second}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	noAddressesStatus := func() metav1.ConditionStatus {
+		var got networkv1alpha1.DNSNameResolver
+		if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(resolverObj), &got); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		for _, rn := range got.Status.ResolvedNames {
+			if rn.DNSName != "foo.example.com." {
+				continue
+			}
+			for _, c := range rn.Conditions {
+				if c.Type == noAddressesConditionType {
+					return c.Status
+				}
+			}
+		}
+		return ""
+	}
+
+	if err := h.updateStatus(context.Background(), o, "foo.example.com.", nil, "", nil); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+	if got := noAddressesStatus(); got != metav1.ConditionTrue {
+		t.Fatalf("NoAddresses status after a NODATA update = %q, want %q", got, metav1.ConditionTrue)
+	}
+
+	if err := h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+	if got := noAddressesStatus(); got != metav1.ConditionFalse {
+		t.Fatalf("NoAddresses status after resolving to an address = %q, want %q", got, metav1.ConditionFalse)
+	}
+}
+
+// TestUpdateStatusRespectsUpdateTimeout verifies that a slow apiserver
+// doesn't block updateStatus (and therefore ServeDNS) past updateTimeout.
+func TestUpdateStatusRespectsUpdateTimeout(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "ns1"
+	resolverObj.Name = "obj1"
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	slowClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		Get: func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			select {
+			case <-time.After(50 * time.Millisecond):
+				return fakeClient.Get(ctx, key, obj, opts...)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+
+	h := &OCPDNSNameResolver{client: slowClient, updateTimeout: 5 * time.Millisecond}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), h.updateTimeout)
+	defer cancel()
+	h.updateStatus(ctx, o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil)
+	elapsed := time.Since(start)
+
+	if elapsed > 40*time.Millisecond {
+		t.Fatalf("updateStatus() took %v, want it to abandon the update well before the slow client's 50ms delay", elapsed)
+	}
+}
+
+// TestUpdateStatusObjectDeletedMidUpdateIsBenign verifies that a
+// DNSNameResolver object deleted between updateStatus's Get and its write
+// back is treated as a benign no-op (nothing left to update) rather than an
+// error, since NotFound here just means another actor won the race, not
+// that this plugin failed to do anything.
+func TestUpdateStatusObjectDeletedMidUpdateIsBenign(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "ns1"
+	resolverObj.Name = "obj1"
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	deletedClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, subResourceName string, c client.Client, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			// Simulate the object being deleted after updateStatus's Get
+			// already succeeded, but before its write lands.
+			return apierrors.NewNotFound(schema.GroupResource{Group: "network.openshift.io", Resource: "dnsnameresolvers"}, obj.GetName())
+		},
+	})
+
+	h := &OCPDNSNameResolver{client: deletedClient, updateTimeout: time.Second, objectLocks: newObjectLocks()}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	if err := h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil); err != nil {
+		t.Fatalf("updateStatus() error = %v, want a deleted-mid-update object treated as a no-op rather than an error", err)
+	}
+}
+
+// TestUpdateStatusMissingObjectIsBenign verifies the same no-op treatment
+// when the object is already gone by the time updateStatus's own Get runs.
+func TestUpdateStatusMissingObjectIsBenign(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().Build()
+	h := &OCPDNSNameResolver{client: fakeClient, updateTimeout: time.Second, objectLocks: newObjectLocks()}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	if err := h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil); err != nil {
+		t.Fatalf("updateStatus() error = %v, want a missing object treated as a no-op rather than an error", err)
+	}
+}
+
+// TestTrimResolvedNamesToFitEvictsOldestFirst verifies that
+// trimResolvedNamesToFit evicts entries in ascending order of their most
+// recent LastLookupTime, stopping as soon as the status fits.
+func TestTrimResolvedNamesToFitEvictsOldestFirst(t *testing.T) {
+	addrAt := func(t time.Time) networkv1alpha1.DNSNameResolverResolvedAddress {
+		lt := metav1.NewTime(t)
+		return networkv1alpha1.DNSNameResolverResolvedAddress{IP: "10.0.0.1", TTLSeconds: 30, LastLookupTime: &lt}
+	}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	obj := &networkv1alpha1.DNSNameResolver{
+		Status: networkv1alpha1.DNSNameResolverStatus{
+			ResolvedNames: []networkv1alpha1.DNSNameResolverResolvedName{
+				{DNSName: "oldest.example.com.", ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{addrAt(base)}},
+				{DNSName: "middle.example.com.", ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{addrAt(base.Add(time.Hour))}},
+				{DNSName: "newest.example.com.", ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{addrAt(base.Add(2 * time.Hour))}},
+			},
+		},
+	}
+
+	full, err := json.Marshal(obj.Status)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	// Leave room for exactly one entry to be evicted.
+	perEntry := len(full) / 3
+	maxBytes := len(full) - perEntry
+
+	trimResolvedNamesToFit(obj, "", "", maxBytes)
+
+	if len(obj.Status.ResolvedNames) != 2 {
+		t.Fatalf("ResolvedNames after trim = %+v, want exactly one entry evicted", obj.Status.ResolvedNames)
+	}
+	for _, entry := range obj.Status.ResolvedNames {
+		if entry.DNSName == "oldest.example.com." {
+			t.Fatalf("ResolvedNames after trim = %+v, want the oldest entry evicted first", obj.Status.ResolvedNames)
+		}
+	}
+}
+
+// TestTrimResolvedNamesToFitPreservesKeptAndWildcardBase verifies that
+// trimResolvedNamesToFit never evicts the entry it's told to keep or the
+// wildcard base entry, even when they're the oldest.
+func TestTrimResolvedNamesToFitPreservesKeptAndWildcardBase(t *testing.T) {
+	stale := metav1.NewTime(time.Now().Add(-time.Hour))
+	obj := &networkv1alpha1.DNSNameResolver{
+		Status: networkv1alpha1.DNSNameResolverStatus{
+			ResolvedNames: []networkv1alpha1.DNSNameResolverResolvedName{
+				{DNSName: "*.example.com.", ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "10.0.0.1", LastLookupTime: &stale}}},
+				{DNSName: "kept.example.com.", ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "10.0.0.2", LastLookupTime: &stale}}},
+			},
+		},
+	}
+
+	// A maxBytes far smaller than either entry alone: trimming can't
+	// possibly satisfy it, but must still stop once only the two
+	// preserved entries remain rather than evicting either of them.
+	trimResolvedNamesToFit(obj, "kept.example.com.", "*.example.com.", 1)
+
+	if len(obj.Status.ResolvedNames) != 2 {
+		t.Fatalf("ResolvedNames after trim = %+v, want both preserved entries left untouched", obj.Status.ResolvedNames)
+	}
+}
+
+// TestUpdateStatusEvictsOldestEntryWhenOverMaxStatusBytes verifies that
+// updateStatus, with maxStatusBytes configured, evicts the
+// least-recently-seen resolved-name entry once the status grows past the
+// limit, rather than growing the object without bound.
+func TestUpdateStatusEvictsOldestEntryWhenOverMaxStatusBytes(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	stale := metav1.NewTime(time.Now().Add(-time.Hour))
+	resolverObj.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "old.example.com.", ResolvedAddresses: []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "10.0.0.9", TTLSeconds: 30, LastLookupTime: &stale}}},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	existingJSON, err := json.Marshal(resolverObj.Status)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	h := &OCPDNSNameResolver{
+		client:         fakeClient,
+		updateTimeout:  time.Second,
+		objectLocks:    newObjectLocks(),
+		maxStatusBytes: len(existingJSON),
+	}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	if err := h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "A", nil); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(resolverObj), &got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	for _, entry := range got.Status.ResolvedNames {
+		if entry.DNSName == "old.example.com." {
+			t.Fatalf("ResolvedNames = %+v, want the older, unrelated entry evicted to make room", got.Status.ResolvedNames)
+		}
+	}
+	found := false
+	for _, entry := range got.Status.ResolvedNames {
+		if entry.DNSName == "foo.example.com." {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("ResolvedNames = %+v, want the entry just written preserved", got.Status.ResolvedNames)
+	}
+}
+
+// TestUpdateStatusRecordsInstanceAnnotationWhenConfigured verifies that
+// updateStatus stamps the configured instanceAnnotation key with this
+// process's identity (POD_NAME here) on a successful update.
+func TestUpdateStatusRecordsInstanceAnnotationWhenConfigured(t *testing.T) {
+	t.Setenv("POD_NAME", "coredns-abc123")
+
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := &OCPDNSNameResolver{
+		client:                fakeClient,
+		updateTimeout:         time.Second,
+		objectLocks:           newObjectLocks(),
+		instanceAnnotationKey: "network.openshift.io/updated-by",
+	}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	if err := h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "A", nil); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(resolverObj), &got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Annotations["network.openshift.io/updated-by"] != "coredns-abc123" {
+		t.Fatalf("annotation %q = %q, want %q", "network.openshift.io/updated-by", got.Annotations["network.openshift.io/updated-by"], "coredns-abc123")
+	}
+}
+
+// TestUpdateStatusOmitsInstanceAnnotationWhenNotConfigured verifies that
+// updateStatus doesn't touch annotations at all when instanceAnnotation
+// isn't set.
+func TestUpdateStatusOmitsInstanceAnnotationWhenNotConfigured(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := &OCPDNSNameResolver{client: fakeClient, updateTimeout: time.Second, objectLocks: newObjectLocks()}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	if err := h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "A", nil); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(resolverObj), &got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got.Annotations) != 0 {
+		t.Fatalf("Annotations = %v, want none when instanceAnnotation isn't configured", got.Annotations)
+	}
+}
+
+// TestUpdateStatusSerializesConcurrentUpdatesToSameObject verifies that two
+// concurrent updateStatus calls against the same object (as ServeDNS would
+// produce for an A and an AAAA answer to the same query arriving close
+// together) never have their Get/DeepCopy/write sequences overlap, and both
+// succeed rather than one losing a race against the other's write.
+func TestUpdateStatusSerializesConcurrentUpdatesToSameObject(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "ns1"
+	resolverObj.Name = "obj1"
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	var inFlight int32
+	var sawOverlap atomic.Bool
+	slowClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		Get: func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if atomic.AddInt32(&inFlight, 1) > 1 {
+				sawOverlap.Store(true)
+			}
+			defer atomic.AddInt32(&inFlight, -1)
+			time.Sleep(10 * time.Millisecond)
+			return fakeClient.Get(ctx, key, obj, opts...)
+		},
+	})
+
+	h := &OCPDNSNameResolver{client: slowClient, updateTimeout: time.Second, objectLocks: newObjectLocks()}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errs[0] = h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "A", nil)
+	}()
+	go func() {
+		defer wg.Done()
+		errs[1] = h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"::1": {ip: "::1", ttl: 30}}, "AAAA", nil)
+	}()
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("updateStatus() call %d error = %v, want both concurrent updates to the same object to succeed", i, err)
+		}
+	}
+	if sawOverlap.Load() {
+		t.Fatal("two updateStatus() calls to the same object overlapped inside client.Get, want the per-object lock to serialize them")
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(resolverObj), &got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 || len(got.Status.ResolvedNames[0].ResolvedAddresses) != 2 {
+		t.Fatalf("ResolvedNames after two concurrent updates = %+v, want both the A and AAAA address merged", got.Status.ResolvedNames)
+	}
+}
+
+// blockingExchanger is a dnsExchanger whose ExchangeContext signals
+// started (once) and then waits on release before answering with a PTR
+// record, so a test can observe that an updateStatus call has reached
+// its PTR lookup without the lookup itself ever completing.
+type blockingExchanger struct {
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingExchanger) Exchange(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	return b.ExchangeContext(context.Background(), m, address)
+}
+
+func (b *blockingExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	b.once.Do(func() { close(b.started) })
+	<-b.release
+	resp := new(dns.Msg)
+	resp.SetReply(m)
+	resp.Answer = append(resp.Answer, &dns.PTR{
+		Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypePTR, Class: dns.ClassINET},
+		Ptr: "host.example.com.",
+	})
+	return resp, time.Millisecond, nil
+}
+
+// TestUpdateStatusPTRLookupDoesNotBlockConcurrentUpdate verifies that a
+// slow PTR lookup triggered by trackPTR doesn't hold the per-object lock
+// updateStatus itself needs: a second updateStatus call for the same
+// object must be able to write its own update while the first call's PTR
+// lookup is still in flight, rather than queuing behind it.
+func TestUpdateStatusPTRLookupDoesNotBlockConcurrentUpdate(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	oldPodIPs, oldExchanger := getRandomCoreDNSPodIPs, newDNSExchanger
+	defer func() { getRandomCoreDNSPodIPs, newDNSExchanger = oldPodIPs, oldExchanger }()
+	getRandomCoreDNSPodIPs = func() []string { return []string{"127.0.0.1:53"} }
+
+	exchanger := &blockingExchanger{started: make(chan struct{}), release: make(chan struct{})}
+	newDNSExchanger = func() dnsExchanger { return exchanger }
+
+	h := &OCPDNSNameResolver{client: fakeClient, updateTimeout: time.Second, objectLocks: newObjectLocks(), trackPTR: true}
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	go h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil)
+
+	select {
+	case <-exchanger.started:
+	case <-time.After(time.Second):
+		t.Fatal("first updateStatus() never reached its PTR lookup")
+	}
+
+	go h.updateStatus(context.Background(), o, "foo.example.com.", map[string]ipTTL{"10.0.0.2": {ip: "10.0.0.2", ttl: 30}}, "", nil)
+
+	deadline := time.After(time.Second)
+	for {
+		var got networkv1alpha1.DNSNameResolver
+		if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(resolverObj), &got); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if len(got.Status.ResolvedNames) == 1 && len(got.Status.ResolvedNames[0].ResolvedAddresses) == 2 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("second updateStatus() never wrote its update while the first call's PTR lookup was still in flight")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	close(exchanger.release)
+}
+
+// TestUpdateAllAndRecordOutcomePartialMarksDegraded verifies that when
+// the same wildcard DNS name is tracked by two namespaces and one
+// namespace's update fails while the other succeeds, the failing
+// namespace's object is marked Degraded rather than the failure being
+// silently absorbed as if nothing had happened for that name.
+func TestUpdateAllAndRecordOutcomePartialMarksDegraded(t *testing.T) {
+	good := &networkv1alpha1.DNSNameResolver{}
+	good.Namespace, good.Name = "ns1", "good"
+	good.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "*.example.com."},
+	}
+
+	bad := &networkv1alpha1.DNSNameResolver{}
+	bad.Namespace, bad.Name = "ns2", "bad"
+	bad.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "*.example.com."},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithObjects(good, bad).
+		WithStatusSubresource(good, bad).
+		Build()
+	failNextNS2Update := true
+	failingClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, subResourceName string, c client.Client, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			if obj.GetNamespace() == "ns2" && failNextNS2Update {
+				failNextNS2Update = false
+				return errors.New("injected failure")
+			}
+			return fakeClient.Status().Update(ctx, obj, opts...)
+		},
+	})
+
+	h := &OCPDNSNameResolver{client: failingClient, updateTimeout: time.Second}
+	objs := []*object{
+		newObject("ns1", "good", "*.example.com.", true),
+		newObject("ns2", "bad", "*.example.com.", true),
+	}
+
+	var wg sync.WaitGroup
+	var catastrophicFailure atomic.Bool
+	ipTTLs := map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}
+	h.updateAllAndRecordOutcome(context.Background(), &wg, objs, "*.example.com.", ipTTLs, "", &catastrophicFailure, nil)
+	wg.Wait()
+
+	if catastrophicFailure.Load() {
+		t.Errorf("catastrophicFailure = true, want false for a partial (not total) failure")
+	}
+
+	metric := updateOutcomeTotal.WithLabelValues("*.example.com.", "partial")
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatalf("failed to read metric: %v", err)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Fatalf("update_outcome_total{outcome=partial} = %v, want 1", got)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns2", Name: "bad"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames[0].Conditions) != 1 || got.Status.ResolvedNames[0].Conditions[0].Type != "Degraded" {
+		t.Fatalf("expected ns2/bad to have a Degraded condition, got %+v", got.Status.ResolvedNames[0].Conditions)
+	}
+
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "good"}, &good); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(good.Status.ResolvedNames[0].Conditions) != 0 {
+		t.Fatalf("expected ns1/good to have no conditions, got %+v", good.Status.ResolvedNames[0].Conditions)
+	}
+}
+
+// TestUpdateAllAndRecordOutcomeRecoveryClearsDegraded verifies that once
+// an object has been marked Degraded by a partial-failure round, a later
+// round in which it succeeds again clears the condition back to False
+// instead of leaving it permanently Degraded.
+func TestUpdateAllAndRecordOutcomeRecoveryClearsDegraded(t *testing.T) {
+	good := &networkv1alpha1.DNSNameResolver{}
+	good.Namespace, good.Name = "ns1", "good"
+	good.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "*.example.com."},
+	}
+
+	recovering := &networkv1alpha1.DNSNameResolver{}
+	recovering.Namespace, recovering.Name = "ns2", "recovering"
+	recovering.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "*.example.com."},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithObjects(good, recovering).
+		WithStatusSubresource(good, recovering).
+		Build()
+	failNextNS2Update := true
+	failingClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, subResourceName string, c client.Client, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			if obj.GetNamespace() == "ns2" && failNextNS2Update {
+				failNextNS2Update = false
+				return errors.New("injected failure")
+			}
+			return fakeClient.Status().Update(ctx, obj, opts...)
+		},
+	})
+
+	h := &OCPDNSNameResolver{client: failingClient, updateTimeout: time.Second, failureCounters: newFailureCounters()}
+	objs := []*object{
+		newObject("ns1", "good", "*.example.com.", true),
+		newObject("ns2", "recovering", "*.example.com.", true),
+	}
+	ipTTLs := map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}
+
+	var wg sync.WaitGroup
+	var catastrophicFailure atomic.Bool
+	h.updateAllAndRecordOutcome(context.Background(), &wg, objs, "*.example.com.", ipTTLs, "", &catastrophicFailure, nil)
+	wg.Wait()
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns2", Name: "recovering"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if !meta.IsStatusConditionTrue(got.Status.ResolvedNames[0].Conditions, degradedConditionType) {
+		t.Fatalf("expected ns2/recovering to be Degraded after the first round, got %+v", got.Status.ResolvedNames[0].Conditions)
+	}
+
+	// The injected failure only fires once; this second round succeeds
+	// for every object.
+	var wg2 sync.WaitGroup
+	var catastrophicFailure2 atomic.Bool
+	h.updateAllAndRecordOutcome(context.Background(), &wg2, objs, "*.example.com.", ipTTLs, "", &catastrophicFailure2, nil)
+	wg2.Wait()
+
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns2", Name: "recovering"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if meta.IsStatusConditionTrue(got.Status.ResolvedNames[0].Conditions, degradedConditionType) {
+		t.Errorf("expected ns2/recovering's Degraded condition to clear after recovering, got %+v", got.Status.ResolvedNames[0].Conditions)
+	}
+}
+
+// TestUpdateAllAndRecordOutcomeLabelsByRegisteredNameNotQname verifies
+// that updateOutcomeTotal is labeled on a wildcard object's own
+// registered dnsName, not the raw client-queried qname: two different
+// subdomains matched by the same wildcard object must add to the same
+// time series rather than each creating their own, which would let a
+// client grow this metric's cardinality without bound just by querying
+// distinct subdomains under a tracked wildcard.
+func TestUpdateAllAndRecordOutcomeLabelsByRegisteredNameNotQname(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := &OCPDNSNameResolver{client: fakeClient, updateTimeout: time.Second}
+	objs := []*object{newObject("ns1", "obj1", "*.example.com.", true)}
+	ipTTLs := map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}
+
+	before := readCounter(t, updateOutcomeTotal.WithLabelValues("*.example.com.", "success"))
+
+	for _, qname := range []string{"foo.example.com.", "bar.example.com."} {
+		var wg sync.WaitGroup
+		var catastrophicFailure atomic.Bool
+		h.updateAllAndRecordOutcome(context.Background(), &wg, objs, qname, ipTTLs, "", &catastrophicFailure, nil)
+		wg.Wait()
+	}
+
+	if after := readCounter(t, updateOutcomeTotal.WithLabelValues("*.example.com.", "success")); after != before+2 {
+		t.Errorf("update_outcome_total{dnsname=\"*.example.com.\", outcome=success} = %v, want %v (both queried subdomains recorded under the wildcard's own name)", after, before+2)
+	}
+	if got := readCounter(t, updateOutcomeTotal.WithLabelValues("foo.example.com.", "success")); got != 0 {
+		t.Errorf("update_outcome_total{dnsname=%q} = %v, want 0 (no per-subdomain series)", "foo.example.com.", got)
+	}
+	if got := readCounter(t, updateOutcomeTotal.WithLabelValues("bar.example.com.", "success")); got != 0 {
+		t.Errorf("update_outcome_total{dnsname=%q} = %v, want 0 (no per-subdomain series)", "bar.example.com.", got)
+	}
+}
+
+// TestMarkDegradedUpsertsByTypeWithPreexistingConditions verifies that
+// markDegraded finds and updates its Degraded condition by Type, not by
+// position: it must neither clobber an unrelated condition that already
+// occupies index 0, nor append a duplicate Degraded condition on a
+// second call.
+func TestMarkDegradedUpsertsByTypeWithPreexistingConditions(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	resolverObj.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{
+			DNSName: "foo.example.com.",
+			Conditions: []metav1.Condition{
+				{Type: noAddressesConditionType, Status: metav1.ConditionTrue, Reason: "ResolutionResult", Message: "no addresses"},
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := &OCPDNSNameResolver{client: fakeClient}
+
+	h.markDegraded(context.Background(), newObject("ns1", "obj1", "foo.example.com.", false), "foo.example.com.")
+	h.markDegraded(context.Background(), newObject("ns1", "obj1", "foo.example.com.", false), "foo.example.com.")
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+
+	conditions := got.Status.ResolvedNames[0].Conditions
+	if len(conditions) != 2 {
+		t.Fatalf("Conditions = %+v, want exactly two: the pre-existing NoAddresses condition and one (not duplicated) Degraded condition", conditions)
+	}
+	if conditions[0].Type != noAddressesConditionType {
+		t.Errorf("Conditions[0].Type = %q, want the pre-existing NoAddresses condition left in place", conditions[0].Type)
+	}
+	degraded := meta.FindStatusCondition(conditions, degradedConditionType)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue {
+		t.Errorf("Degraded condition = %+v, want status True", degraded)
+	}
+}
+
+// TestMarkDegradedWaitsForFailureThreshold verifies that markDegraded
+// only upserts a Degraded condition once an object has accumulated
+// failureThreshold consecutive failures, not on the first one.
+func TestMarkDegradedWaitsForFailureThreshold(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	resolverObj.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "foo.example.com."},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := New()
+	h.client = fakeClient
+	h.failureThreshold = 2
+
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	h.markDegraded(context.Background(), o, "foo.example.com.")
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames[0].Conditions) != 0 {
+		t.Fatalf("after 1 of 2 failures, Conditions = %+v, want none yet", got.Status.ResolvedNames[0].Conditions)
+	}
+
+	h.markDegraded(context.Background(), o, "foo.example.com.")
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	degraded := meta.FindStatusCondition(got.Status.ResolvedNames[0].Conditions, degradedConditionType)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue {
+		t.Fatalf("after 2 of 2 failures, Degraded condition = %+v, want status True", degraded)
+	}
+}
+
+// TestMarkDegradedAnnotationOverridesFailureThreshold verifies that a
+// DNSNameResolver object's own failureThresholdAnnotation overrides the
+// plugin-wide failureThreshold for that object.
+func TestMarkDegradedAnnotationOverridesFailureThreshold(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	resolverObj.Annotations = map[string]string{failureThresholdAnnotation: "1"}
+	resolverObj.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "foo.example.com."},
+	}
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := New()
+	h.client = fakeClient
+	h.failureThreshold = 5
+
+	// The object's own annotation overrides the plugin-wide threshold of
+	// 5 down to 1, so a single failure is enough to degrade it.
+	h.markDegraded(context.Background(), newObject("ns1", "obj1", "foo.example.com.", false), "foo.example.com.")
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	degraded := meta.FindStatusCondition(got.Status.ResolvedNames[0].Conditions, degradedConditionType)
+	if degraded == nil || degraded.Status != metav1.ConditionTrue {
+		t.Fatalf("Degraded condition = %+v, want status True after 1 failure with the annotation override", degraded)
+	}
+}
+
+// TestEffectiveFailureThresholdRejectsInvalidAnnotation verifies that an
+// annotation value that isn't a positive integer is ignored in favor of
+// the plugin-wide default, rather than disabling degraded reporting or
+// panicking.
+func TestEffectiveFailureThresholdRejectsInvalidAnnotation(t *testing.T) {
+	for _, raw := range []string{"not-a-number", "0", "-1"} {
+		annotations := map[string]string{failureThresholdAnnotation: raw}
+		if got := effectiveFailureThreshold(annotations, 3); got != 3 {
+			t.Errorf("effectiveFailureThreshold(%q, 3) = %d, want 3 (fall back to the default)", raw, got)
+		}
+	}
+}
+
+// aAnswerHandler is a plugin.Handler that answers every query with a
+// single A record, simulating the rest of the chain having already
+// resolved it.
+type aAnswerHandler struct{ qname string }
+
+func (h aAnswerHandler) Name() string { return "aanswer" }
+
+func (h aAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// srvAnswerHandler answers with a SRV record for qname pointing at
+// target, plus target's own glue A record in Extra, the shape followSRV
+// extracts target addresses from without a separate lookup.
+type srvAnswerHandler struct{ qname, target string }
+
+func (h srvAnswerHandler) Name() string { return "srvanswer" }
+
+func (h srvAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{
+		&dns.SRV{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeSRV, Class: dns.ClassINET}, Target: h.target},
+	}
+	m.Extra = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: h.target, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// TestRunUpdatesCountsConfiguredFailureRcode verifies that a response
+// carrying a rcode listed in failureRcodes counts against its DNS name's
+// success ratio, even though it has no answer records for updateStatus to
+// act on.
+func TestRunUpdatesCountsConfiguredFailureRcode(t *testing.T) {
+	old := successRatioWindowSize
+	defer func() { successRatioWindowSize = old }()
+	successRatioWindowSize = 20
+
+	h := &OCPDNSNameResolver{
+		history:       newResolutionHistory(),
+		successRatios: newSuccessRatioTracker(),
+		updateTimeout: time.Second,
+		failureRcodes: map[int]bool{dns.RcodeServerFailure: true},
+	}
+	msg := new(dns.Msg)
+	msg.Rcode = dns.RcodeServerFailure
+
+	h.runUpdates(nil, "foo.example.com.", msg, nil)
+
+	ratio, ok := h.ResolutionSuccessRatio("foo.example.com.")
+	if !ok {
+		t.Fatal("ResolutionSuccessRatio() ok = false, want a recorded failure for a rcode listed in failureRcodes")
+	}
+	if ratio != 0 {
+		t.Errorf("ResolutionSuccessRatio() = %v, want 0 (the only observation was a failure)", ratio)
+	}
+}
+
+// TestRunUpdatesIgnoresUnconfiguredRcode verifies that a response carrying
+// a rcode not listed in failureRcodes is logged and otherwise ignored,
+// rather than dragging down its DNS name's success ratio.
+func TestRunUpdatesIgnoresUnconfiguredRcode(t *testing.T) {
+	old := successRatioWindowSize
+	defer func() { successRatioWindowSize = old }()
+	successRatioWindowSize = 20
+
+	h := &OCPDNSNameResolver{
+		history:       newResolutionHistory(),
+		successRatios: newSuccessRatioTracker(),
+		updateTimeout: time.Second,
+		failureRcodes: map[int]bool{dns.RcodeServerFailure: true},
+	}
+	msg := new(dns.Msg)
+	msg.Rcode = dns.RcodeNotImplemented
+
+	h.runUpdates(nil, "foo.example.com.", msg, nil)
+
+	if _, ok := h.ResolutionSuccessRatio("foo.example.com."); ok {
+		t.Fatal("ResolutionSuccessRatio() ok = true, want a rcode outside failureRcodes to be ignored rather than recorded")
+	}
+}
+
+// TestRcodeMessageUsesConfiguredOverride verifies that rcodeMessage
+// returns the rcodeMessages override for a rcode it covers.
+func TestRcodeMessageUsesConfiguredOverride(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		rcodeMessages: map[int]string{dns.RcodeServerFailure: "upstream-failure"},
+	}
+	if got := h.rcodeMessage(dns.RcodeServerFailure); got != "upstream-failure" {
+		t.Errorf("rcodeMessage(RcodeServerFailure) = %q, want %q", got, "upstream-failure")
+	}
+}
+
+// TestRcodeMessageFallsBackToRcodeToString verifies that rcodeMessage
+// falls back to dns.RcodeToString for a rcode rcodeMessages doesn't
+// cover, and when rcodeMessages is unset entirely.
+func TestRcodeMessageFallsBackToRcodeToString(t *testing.T) {
+	h := &OCPDNSNameResolver{
+		rcodeMessages: map[int]string{dns.RcodeServerFailure: "upstream-failure"},
+	}
+	if got, want := h.rcodeMessage(dns.RcodeRefused), dns.RcodeToString[dns.RcodeRefused]; got != want {
+		t.Errorf("rcodeMessage(RcodeRefused) = %q, want %q", got, want)
+	}
+
+	unset := &OCPDNSNameResolver{}
+	if got, want := unset.rcodeMessage(dns.RcodeNameError), dns.RcodeToString[dns.RcodeNameError]; got != want {
+		t.Errorf("rcodeMessage(RcodeNameError) with no rcodeMessages = %q, want %q", got, want)
+	}
+}
+
+// TestRunUpdatesNodataCountsAsSuccessByDefault verifies that a NODATA
+// response (NOERROR with zero A/AAAA records) counts as a success-ratio
+// success when nodataCountsAsFailure isn't set.
+func TestRunUpdatesNodataCountsAsSuccessByDefault(t *testing.T) {
+	old := successRatioWindowSize
+	defer func() { successRatioWindowSize = old }()
+	successRatioWindowSize = 20
+
+	h := &OCPDNSNameResolver{
+		history:       newResolutionHistory(),
+		successRatios: newSuccessRatioTracker(),
+		updateTimeout: time.Second,
+	}
+	msg := new(dns.Msg)
+	msg.Rcode = dns.RcodeSuccess
+
+	h.runUpdates(nil, "foo.example.com.", msg, nil)
+
+	ratio, ok := h.ResolutionSuccessRatio("foo.example.com.")
+	if !ok || ratio != 1 {
+		t.Fatalf("ResolutionSuccessRatio() = %v, %v, want 1, true for a NODATA response with nodataCountsAsFailure unset", ratio, ok)
+	}
+}
+
+// TestRunUpdatesNodataCountsAsFailureWhenConfigured verifies that a
+// NODATA response counts as a success-ratio failure when
+// nodataCountsAsFailure is set.
+func TestRunUpdatesNodataCountsAsFailureWhenConfigured(t *testing.T) {
+	old := successRatioWindowSize
+	defer func() { successRatioWindowSize = old }()
+	successRatioWindowSize = 20
+
+	h := &OCPDNSNameResolver{
+		history:               newResolutionHistory(),
+		successRatios:         newSuccessRatioTracker(),
+		updateTimeout:         time.Second,
+		nodataCountsAsFailure: true,
+	}
+	msg := new(dns.Msg)
+	msg.Rcode = dns.RcodeSuccess
+
+	h.runUpdates(nil, "foo.example.com.", msg, nil)
+
+	ratio, ok := h.ResolutionSuccessRatio("foo.example.com.")
+	if !ok || ratio != 0 {
+		t.Fatalf("ResolutionSuccessRatio() = %v, %v, want 0, true for a NODATA response with nodataCountsAsFailure set", ratio, ok)
+	}
+}
+
+// TestServeDNSFailOnUpdateErrorDisabled verifies that, by default, a
+// total status-update failure still returns the DNS response the rest
+// of the chain produced.
+func TestServeDNSFailOnUpdateErrorDisabled(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	failingClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, subResourceName string, c client.Client, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			return errors.New("injected failure")
+		},
+	})
+
+	h := New()
+	h.client = failingClient
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want %v (failOnUpdateError disabled)", rcode, dns.RcodeSuccess)
+	}
+}
+
+// TestServeDNSSyncUpdateSurvivesCancelledRequestContext verifies that a
+// synchronous status update still completes even when the DNS request's
+// own context is already cancelled by the time ServeDNS runs it, since
+// the update runs against its own context.Background()-derived timeout
+// rather than the request's.
+func TestServeDNSSyncUpdateSurvivesCancelledRequestContext(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(ctx, &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Fatalf("ServeDNS() rcode = %v, want %v", rcode, dns.RcodeSuccess)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKeyFromObject(resolverObj), &got); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 || len(got.Status.ResolvedNames[0].ResolvedAddresses) == 0 {
+		t.Fatalf("ResolvedNames = %+v, want the status update to have completed despite the cancelled request context", got.Status.ResolvedNames)
+	}
+}
+
+// TestServeDNSFailOnUpdateErrorEnabled verifies that, with
+// failOnUpdateError set, a total status-update failure is turned into a
+// SERVFAIL instead of the otherwise-valid DNS response.
+func TestServeDNSFailOnUpdateErrorEnabled(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	failingClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, subResourceName string, c client.Client, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			return errors.New("injected failure")
+		},
+	})
+
+	h := New()
+	h.client = failingClient
+	h.failOnUpdateError = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeServerFailure {
+		t.Errorf("ServeDNS() rcode = %v, want %v (failOnUpdateError enabled, total failure)", rcode, dns.RcodeServerFailure)
+	}
+}
+
+// TestServeDNSFailOnUpdateErrorIgnoresSRVTargetFailure verifies that,
+// with followSRV and failOnUpdateError both enabled, a totally-failed
+// status write for a SRV target's glue-record enrichment doesn't turn an
+// otherwise-successful primary-qname update into a SERVFAIL: only the
+// primary qname's own outcome drives failOnUpdateError.
+func TestServeDNSFailOnUpdateErrorIgnoresSRVTargetFailure(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	// The primary qname ("_svc._tcp.example.com.") and the SRV target
+	// ("host1.example.com.") are recorded as separate entries on the same
+	// object; failing only the write that would introduce the target's
+	// entry simulates a transient failure isolated to the SRV-target
+	// enrichment update.
+	failingClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, subResourceName string, c client.Client, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			resolver, ok := obj.(*networkv1alpha1.DNSNameResolver)
+			if ok {
+				for _, entry := range resolver.Status.ResolvedNames {
+					if entry.DNSName == "host1.example.com." {
+						return errors.New("injected SRV-target failure")
+					}
+				}
+			}
+			return c.SubResource(subResourceName).Update(ctx, obj, opts...)
+		},
+	})
+
+	h := New()
+	h.client = failingClient
+	h.followSRV = true
+	h.failOnUpdateError = true
+	h.addOrUpdateObject("ns1", "obj1", "_svc._tcp.example.com.", false)
+
+	h.Next = srvAnswerHandler{qname: "_svc._tcp.example.com.", target: "host1.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("_svc._tcp.example.com.", dns.TypeSRV)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want %v (SRV-target failure alone must not trigger failOnUpdateError)", rcode, dns.RcodeSuccess)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	found := false
+	for _, entry := range got.Status.ResolvedNames {
+		if entry.DNSName == "_svc._tcp.example.com." {
+			found = true
+		}
+		if entry.DNSName == "host1.example.com." {
+			t.Errorf("Status.ResolvedNames = %+v, want the failed SRV-target entry absent", got.Status.ResolvedNames)
+		}
+	}
+	if !found {
+		t.Errorf("Status.ResolvedNames = %+v, want the primary qname's entry recorded", got.Status.ResolvedNames)
+	}
+}
+
+// TestServeDNSClientCIDRsInRangeTracksQuery verifies that a query from a
+// client within a configured clientCIDRs range is tracked normally.
+func TestServeDNSClientCIDRsInRangeTracksQuery(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	_, cidr, err := net.ParseCIDR("10.240.0.0/16")
+	if err != nil {
+		t.Fatalf("net.ParseCIDR() error = %v", err)
+	}
+	h := New()
+	h.client = fakeClient
+	h.clientCIDRs = []*net.IPNet{cidr}
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	// test.ResponseWriter's default remote address, 10.240.0.1, falls
+	// within 10.240.0.0/16.
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("expected an in-range client's query to be tracked, got status %+v", got.Status)
+	}
+}
+
+// TestServeDNSClientCIDRsOutOfRangeSkipsTracking verifies that a query
+// from a client outside every configured clientCIDRs range is passed
+// through without any status update.
+func TestServeDNSClientCIDRsOutOfRangeSkipsTracking(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	_, cidr, err := net.ParseCIDR("10.128.0.0/14")
+	if err != nil {
+		t.Fatalf("net.ParseCIDR() error = %v", err)
+	}
+	h := New()
+	h.client = fakeClient
+	h.clientCIDRs = []*net.IPNet{cidr}
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{RemoteIP: "203.0.113.5"}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want %v (the response still passes through)", rcode, dns.RcodeSuccess)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 0 {
+		t.Fatalf("expected an out-of-range client's query to be untracked, got status %+v", got.Status)
+	}
+}
+
+// TestServeDNSRequireRecursionDesiredTracksRDQuery verifies that with
+// requireRecursionDesired on, a query with RD set is still tracked
+// normally.
+func TestServeDNSRequireRecursionDesiredTracksRDQuery(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.requireRecursionDesired = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	r.RecursionDesired = true
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("expected an RD query to be tracked, got status %+v", got.Status)
+	}
+}
+
+// TestServeDNSRequireRecursionDesiredSkipsNonRDQuery verifies that with
+// requireRecursionDesired on, a query without RD set (as internal
+// health/monitoring probes commonly issue) is passed through without
+// any status update.
+func TestServeDNSRequireRecursionDesiredSkipsNonRDQuery(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.requireRecursionDesired = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	r.RecursionDesired = false
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want %v (the response still passes through)", rcode, dns.RcodeSuccess)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 0 {
+		t.Fatalf("expected a non-RD query to be untracked, got status %+v", got.Status)
+	}
+}
+
+// TestClientAllowedNoCIDRsConfigured verifies that clientAllowed permits
+// every client when clientCIDRs is empty, the default.
+func TestClientAllowedNoCIDRsConfigured(t *testing.T) {
+	h := &OCPDNSNameResolver{}
+	if !h.clientAllowed("203.0.113.5") {
+		t.Error("clientAllowed() with no clientCIDRs configured = false, want true")
+	}
+}
+
+func TestStripSearchSuffix(t *testing.T) {
+	h := &OCPDNSNameResolver{searchSuffixes: []string{"svc.cluster.local.", "cluster.local."}}
+
+	stripped, ok := h.stripSearchSuffix("www.example.com.svc.cluster.local.")
+	if !ok || stripped != "www.example.com." {
+		t.Fatalf("stripSearchSuffix() = (%q, %v), want (\"www.example.com.\", true)", stripped, ok)
+	}
+
+	if _, ok := h.stripSearchSuffix("www.example.com."); ok {
+		t.Errorf("stripSearchSuffix() matched a qname with no configured suffix")
+	}
+
+	// "fakecluster.local." ends with the configured "cluster.local."
+	// suffix as a substring, but not on a label boundary, so it must not
+	// be stripped.
+	if _, ok := h.stripSearchSuffix("fakecluster.local."); ok {
+		t.Errorf("stripSearchSuffix() matched a suffix that wasn't on a label boundary")
+	}
+}
+
+// TestSkippedQueryReason verifies the debug reason logSkippedQueries logs
+// distinguishes a plain miss from one that also tried search-suffix
+// stripping, so support cases can tell the two apart.
+func TestSkippedQueryReason(t *testing.T) {
+	if got := skippedQueryReason("foo.example.com.", false); got != `no DNSNameResolver object tracks "foo.example.com."` {
+		t.Errorf("skippedQueryReason(triedSearchSuffix=false) = %q, want no mention of search suffixes", got)
+	}
+
+	got := skippedQueryReason("foo.example.com.", true)
+	if want := `no DNSNameResolver object tracks "foo.example.com.", including after stripping configured search suffixes`; got != want {
+		t.Errorf("skippedQueryReason(triedSearchSuffix=true) = %q, want %q", got, want)
+	}
+}
+
+// TestServeDNSLogSkippedQueriesDoesNotAffectResponse verifies that
+// enabling logSkippedQueries is purely observational: an unmatched query
+// still passes through with the chain's original response untouched.
+func TestServeDNSLogSkippedQueriesDoesNotAffectResponse(t *testing.T) {
+	h := New()
+	h.logSkippedQueries = true
+	h.Next = aAnswerHandler{qname: "untracked.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("untracked.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want %v", rcode, dns.RcodeSuccess)
+	}
+}
+
+// TestUpdateDecisionRationale verifies the debug rationale
+// logUpdateDecisions logs distinguishes all four combinations of match
+// kind and merge-vs-append, so support cases can tell them apart.
+func TestUpdateDecisionRationale(t *testing.T) {
+	cases := []struct {
+		matchedWildcard, foundResolvedName bool
+		want                               string
+	}{
+		{false, false, "matched exact tracked name, appending new resolved-name entry"},
+		{false, true, "matched exact tracked name, merging into existing resolved-name entry"},
+		{true, false, "matched wildcard, appending new resolved-name entry"},
+		{true, true, "matched wildcard, merging into existing resolved-name entry"},
+	}
+	for _, c := range cases {
+		if got := updateDecisionRationale(c.matchedWildcard, c.foundResolvedName); got != c.want {
+			t.Errorf("updateDecisionRationale(%v, %v) = %q, want %q", c.matchedWildcard, c.foundResolvedName, got, c.want)
+		}
+	}
+}
+
+// TestServeDNSLogUpdateDecisionsDoesNotAffectResponse verifies that
+// enabling logUpdateDecisions is purely observational: a matched query
+// still updates status and passes through the chain's original response
+// untouched.
+func TestServeDNSLogUpdateDecisionsDoesNotAffectResponse(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	resolverObj.Spec.Name = "foo.example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	h := New()
+	h.client = fakeClient
+	h.logUpdateDecisions = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want %v", rcode, dns.RcodeSuccess)
+	}
+}
+
+// TestServeDNSMatchesSearchDomainExpandedQName verifies that a query for
+// a search-domain-expanded name (as a Pod using cluster search domains
+// would issue) still updates the DNSNameResolver object tracking the
+// unexpanded name, and records the resolution under that name.
+func TestServeDNSMatchesSearchDomainExpandedQName(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.searchSuffixes = []string{"svc.cluster.local."}
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com.svc.cluster.local."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.svc.cluster.local.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 || got.Status.ResolvedNames[0].DNSName != "foo.example.com." {
+		t.Fatalf("expected the resolution to be recorded under the unexpanded name, got %+v", got.Status.ResolvedNames)
+	}
+}
+
+// TestServeDNSSkipsSearchSuffixWhenRawQNameMatches verifies that the raw
+// qname is preferred over search-suffix stripping when it already
+// matches a tracked object, so a literal search-domain name that also
+// happens to be tracked isn't silently rewritten.
+func TestServeDNSSkipsSearchSuffixWhenRawQNameMatches(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.searchSuffixes = []string{"svc.cluster.local."}
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.svc.cluster.local.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com.svc.cluster.local."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.svc.cluster.local.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 || got.Status.ResolvedNames[0].DNSName != "foo.example.com.svc.cluster.local." {
+		t.Fatalf("expected the resolution to be recorded under the literal raw qname, got %+v", got.Status.ResolvedNames)
+	}
+}
+
+// TestUpdateStatusFindsEntryRegardlessOfPosition guards against a
+// break-condition regression where updateStatus's search for the entry
+// to update would stop, or take a shortcut, based on index or on
+// wildcard-ness rather than an exact DNSName match: it puts the target
+// entry at index 1, behind an unrelated decoy entry, and asserts the
+// decoy is left untouched while the real entry is updated.
+func TestUpdateStatusFindsEntryRegardlessOfPosition(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	resolverObj.Status.ResolvedNames = []networkv1alpha1.DNSNameResolverResolvedName{
+		{DNSName: "decoy.example.com."},
+		{DNSName: "foo.example.com."},
+	}
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	o := newObject("ns1", "obj1", "foo.example.com.", false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.updateStatus(ctx, o, "foo.example.com.", map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", nil); err != nil {
+		t.Fatalf("updateStatus() error = %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 2 {
+		t.Fatalf("expected exactly the decoy and target entries, got %+v", got.Status.ResolvedNames)
+	}
+	if got.Status.ResolvedNames[0].DNSName != "decoy.example.com." || len(got.Status.ResolvedNames[0].ResolvedAddresses) != 0 {
+		t.Fatalf("decoy entry at index 0 was modified: %+v", got.Status.ResolvedNames[0])
+	}
+	if got.Status.ResolvedNames[1].DNSName != "foo.example.com." || len(got.Status.ResolvedNames[1].ResolvedAddresses) != 1 {
+		t.Fatalf("expected the target entry at index 1 to be updated, got %+v", got.Status.ResolvedNames[1])
+	}
+}
+
+// TestServeDNSWildcardSubdomainTrackingOn verifies that, with the
+// default wildcardSubdomainTracking enabled, each distinct subdomain
+// matching a wildcard object gets its own resolved-name entry.
+func TestServeDNSWildcardSubdomainTrackingOn(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.addOrUpdateObject("ns1", "obj1", "*.example.com.", true)
+
+	for _, qname := range []string{"foo.example.com.", "bar.example.com."} {
+		h.Next = aAnswerHandler{qname: qname}
+		r := new(dns.Msg)
+		r.SetQuestion(qname, dns.TypeA)
+		if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+			t.Fatalf("ServeDNS() returned error: %v", err)
+		}
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 2 {
+		t.Fatalf("expected a separate entry per subdomain, got %+v", got.Status.ResolvedNames)
+	}
+}
+
+// TestServeDNSWildcardSubdomainTrackingOff verifies that, with
+// wildcardSubdomainTracking disabled, every subdomain matching a
+// wildcard object folds into a single entry under the wildcard's own
+// name instead of accumulating one per subdomain.
+func TestServeDNSWildcardSubdomainTrackingOff(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.wildcardSubdomainTracking = false
+	h.addOrUpdateObject("ns1", "obj1", "*.example.com.", true)
+
+	for _, qname := range []string{"foo.example.com.", "bar.example.com."} {
+		h.Next = aAnswerHandler{qname: qname}
+		r := new(dns.Msg)
+		r.SetQuestion(qname, dns.TypeA)
+		if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+			t.Fatalf("ServeDNS() returned error: %v", err)
+		}
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 || got.Status.ResolvedNames[0].DNSName != "*.example.com." {
+		t.Fatalf("expected a single entry under the wildcard's own name, got %+v", got.Status.ResolvedNames)
+	}
+}
+
+// TestServeDNSWildcardGroupRefreshBringsRefreshForward verifies that, with
+// wildcardGroupRefresh enabled, a live query matching a wildcard object
+// feeds the answer's TTL into the resolver's schedule for that wildcard,
+// bringing its own proactive refresh forward.
+func TestServeDNSWildcardGroupRefreshBringsRefreshForward(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.wildcardGroupRefresh = true
+	h.resolver = NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return nil, 0, nil
+	}, nil)
+
+	farFuture := time.Now().Add(time.Hour)
+	d := &dnsNameDetails{dnsName: "*.example.com.", isWildcard: true, nextLookupTime: farFuture}
+	h.resolver.dnsNames["*.example.com."] = d
+	h.resolver.nextLookups = append(h.resolver.nextLookups, d)
+	heap.Init(&h.resolver.nextLookups)
+
+	h.addOrUpdateObject("ns1", "obj1", "*.example.com.", true)
+
+	qname := "foo.example.com."
+	h.Next = aAnswerHandler{qname: qname}
+	r := new(dns.Msg)
+	r.SetQuestion(qname, dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	if got := h.resolver.dnsNames["*.example.com."].nextLookupTime; !got.Before(farFuture) {
+		t.Errorf("nextLookupTime = %v, want brought forward of %v by the observed TTL", got, farFuture)
+	}
+}
+
+// aaaaAnswerHandler is a plugin.Handler that answers every query with a
+// single AAAA record, simulating the rest of the chain having already
+// resolved it.
+type aaaaAnswerHandler struct{ qname string }
+
+func (h aaaaAnswerHandler) Name() string { return "aaaaanswer" }
+
+func (h aaaaAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{
+		&dns.AAAA{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 30}, AAAA: net.ParseIP("::1")},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// TestMergeResolvedAddressesPrunesOnlyMatchingFamily verifies that a
+// family-specific update drops stale addresses of that same family while
+// leaving addresses of the other family untouched.
+func TestMergeResolvedAddressesPrunesOnlyMatchingFamily(t *testing.T) {
+	now := metav1.Now()
+	existing := []networkv1alpha1.DNSNameResolverResolvedAddress{
+		{IP: "10.0.0.1"},
+		{IP: "10.0.0.2"},
+		{IP: "::1"},
+	}
+
+	got := mergeResolvedAddresses(existing, map[string]ipTTL{"10.0.0.3": {ip: "10.0.0.3", ttl: 30}}, "A", now, "", false)
+
+	var v4, v6 []string
+	for _, addr := range got {
+		if isIPv4(addr.IP) {
+			v4 = append(v4, addr.IP)
+		} else {
+			v6 = append(v6, addr.IP)
+		}
+	}
+	if len(v4) != 1 || v4[0] != "10.0.0.3" {
+		t.Fatalf("A addresses after merge = %v, want only the fresh 10.0.0.3", v4)
+	}
+	if len(v6) != 1 || v6[0] != "::1" {
+		t.Fatalf("AAAA addresses after an A-only merge = %v, want the stale AAAA entry left untouched", v6)
+	}
+}
+
+// TestMergeResolvedAddressesFullReplaceWithoutFamily verifies that an
+// unrestricted merge (family == "") still fully replaces the existing
+// addresses, matching a proactive resolver lookup covering both families.
+func TestMergeResolvedAddressesFullReplaceWithoutFamily(t *testing.T) {
+	now := metav1.Now()
+	existing := []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "10.0.0.1"}, {IP: "::1"}}
+
+	got := mergeResolvedAddresses(existing, map[string]ipTTL{"10.0.0.2": {ip: "10.0.0.2", ttl: 30}}, "", now, "", false)
+
+	if len(got) != 1 || got[0].IP != "10.0.0.2" {
+		t.Fatalf("merge with family=\"\" = %v, want a full replace with only 10.0.0.2", got)
+	}
+}
+
+// TestMergeResolvedAddressesFamilyOrderV4First verifies that with
+// familyOrder set to v4first, IPv4 addresses sort ahead of IPv6 ones
+// regardless of which order they were resolved or already stored in.
+func TestMergeResolvedAddressesFamilyOrderV4First(t *testing.T) {
+	now := metav1.Now()
+	existing := []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "::1"}, {IP: "::2"}}
+
+	got := mergeResolvedAddresses(existing, map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", now, familyOrderV4First, false)
+
+	if len(got) != 3 || !isIPv4(got[0].IP) {
+		t.Fatalf("mergeResolvedAddresses() with familyOrder=v4first = %v, want the IPv4 address first", got)
+	}
+}
+
+// TestMergeResolvedAddressesFamilyOrderV6First verifies that with
+// familyOrder set to v6first, IPv6 addresses sort ahead of IPv4 ones.
+func TestMergeResolvedAddressesFamilyOrderV6First(t *testing.T) {
+	now := metav1.Now()
+	existing := []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}}
+
+	got := mergeResolvedAddresses(existing, map[string]ipTTL{"::1": {ip: "::1", ttl: 30}}, "", now, familyOrderV6First, false)
+
+	if len(got) != 3 || isIPv4(got[0].IP) {
+		t.Fatalf("mergeResolvedAddresses() with familyOrder=v6first = %v, want the IPv6 address first", got)
+	}
+}
+
+// TestMergeResolvedAddressesNoFamilyOrderLeavesOrderUnspecified verifies
+// that an empty familyOrder (the default) doesn't reorder addresses,
+// preserving mergeResolvedAddresses' existing behavior.
+func TestMergeResolvedAddressesNoFamilyOrderLeavesOrderUnspecified(t *testing.T) {
+	now := metav1.Now()
+	existing := []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "::1"}}
+
+	got := mergeResolvedAddresses(existing, map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, "", now, "", false)
+
+	if len(got) != 2 || got[0].IP != "::1" {
+		t.Fatalf("mergeResolvedAddresses() with no familyOrder = %v, want existing order preserved (::1 first)", got)
+	}
+}
+
+// TestMergeResolvedAddressesDedupeCollapsesIPv4MappedAddress verifies
+// that with dedupe enabled, a freshly-observed IPv4-mapped IPv6 address
+// collapses into an already-stored plain-IPv4 entry for the same
+// endpoint instead of appending a second entry, and refreshes that
+// entry's TTL and LastLookupTime from the fresh observation.
+func TestMergeResolvedAddressesDedupeCollapsesIPv4MappedAddress(t *testing.T) {
+	earlier := metav1.NewTime(metav1.Now().Add(-time.Minute))
+	now := metav1.Now()
+	existing := []networkv1alpha1.DNSNameResolverResolvedAddress{
+		{IP: "10.0.0.1", TTLSeconds: 30, LastLookupTime: &earlier},
+	}
+
+	got := mergeResolvedAddresses(existing, map[string]ipTTL{"::ffff:10.0.0.1": {ip: "::ffff:10.0.0.1", ttl: 60}}, "", now, "", true)
+
+	if len(got) != 1 {
+		t.Fatalf("mergeResolvedAddresses() with dedupe = %v, want a single collapsed entry", got)
+	}
+	if got[0].IP != "10.0.0.1" {
+		t.Fatalf("mergeResolvedAddresses() with dedupe kept IP %q, want the plain IPv4 form 10.0.0.1", got[0].IP)
+	}
+	if got[0].TTLSeconds != 60 {
+		t.Fatalf("mergeResolvedAddresses() with dedupe kept TTLSeconds %d, want the fresh observation's 60", got[0].TTLSeconds)
+	}
+	if got[0].LastLookupTime == nil || !got[0].LastLookupTime.Equal(&now) {
+		t.Fatalf("mergeResolvedAddresses() with dedupe kept LastLookupTime %v, want the fresh observation's", got[0].LastLookupTime)
+	}
+}
+
+// TestMergeResolvedAddressesWithoutDedupeKeepsBothForms verifies that
+// dedupe defaults to off, preserving mergeResolvedAddresses' existing
+// behavior of storing an IPv4-mapped IPv6 address as its own entry
+// alongside an already-stored plain-IPv4 entry for the same endpoint.
+func TestMergeResolvedAddressesWithoutDedupeKeepsBothForms(t *testing.T) {
+	now := metav1.Now()
+	existing := []networkv1alpha1.DNSNameResolverResolvedAddress{{IP: "10.0.0.1"}}
+
+	got := mergeResolvedAddresses(existing, map[string]ipTTL{"::ffff:10.0.0.1": {ip: "::ffff:10.0.0.1", ttl: 60}}, "", now, "", false)
+
+	if len(got) != 2 {
+		t.Fatalf("mergeResolvedAddresses() without dedupe = %v, want both the existing and fresh entries kept", got)
+	}
+}
+
+// TestServeDNSAOnlyAnswerPreservesAAAAAddresses verifies that a
+// successful A-only query prunes stale A addresses (family-specific
+// pruning) without wiping the AAAA addresses a prior AAAA query recorded.
+func TestServeDNSAOnlyAnswerPreservesAAAAAddresses(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+
+	h.Next = aaaaAnswerHandler{qname: "foo.example.com."}
+	aaaaReq := new(dns.Msg)
+	aaaaReq.SetQuestion("foo.example.com.", dns.TypeAAAA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, aaaaReq); err != nil {
+		t.Fatalf("ServeDNS() AAAA query returned error: %v", err)
+	}
+
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+	aReq := new(dns.Msg)
+	aReq.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, aReq); err != nil {
+		t.Fatalf("ServeDNS() A query returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames = %+v, want a single entry", got.Status.ResolvedNames)
+	}
+	addrs := got.Status.ResolvedNames[0].ResolvedAddresses
+	if len(addrs) != 2 {
+		t.Fatalf("ResolvedAddresses after an A-only follow-up = %v, want the AAAA address preserved alongside the new A address", addrs)
+	}
+}
+
+// httpsAnswerHandler is a plugin.Handler that answers a query with a
+// single HTTPS record carrying ipv4hint/ipv6hint SVCB parameters,
+// simulating an upstream serving HTTPS/SVCB records for an HTTP/3-era
+// destination.
+type httpsAnswerHandler struct{ qname string }
+
+func (h httpsAnswerHandler) Name() string { return "httpsanswer" }
+
+func (h httpsAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{
+		&dns.HTTPS{SVCB: dns.SVCB{
+			Hdr:      dns.RR_Header{Name: h.qname, Rrtype: dns.TypeHTTPS, Class: dns.ClassINET, Ttl: 300},
+			Priority: 1,
+			Target:   ".",
+			Value: []dns.SVCBKeyValue{
+				&dns.SVCBIPv4Hint{Hint: []net.IP{net.ParseIP("10.0.0.9")}},
+				&dns.SVCBIPv6Hint{Hint: []net.IP{net.ParseIP("::9")}},
+			},
+		}},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// TestServeDNSFollowSVCBRecordsHintedAddresses verifies that, with
+// followSVCB set, an HTTPS answer's ipv4hint/ipv6hint addresses land in
+// the matching object's status the same way A/AAAA addresses do.
+func TestServeDNSFollowSVCBRecordsHintedAddresses(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.followSVCB = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = httpsAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeHTTPS)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames = %+v, want a single entry", got.Status.ResolvedNames)
+	}
+	addrs := got.Status.ResolvedNames[0].ResolvedAddresses
+	if len(addrs) != 2 {
+		t.Fatalf("ResolvedAddresses = %v, want the HTTPS record's ipv4hint and ipv6hint addresses recorded", addrs)
+	}
+}
+
+// TestServeDNSFollowSVCBDisabledIgnoresHints verifies that, without
+// followSVCB set, an HTTPS answer's hinted addresses are not recorded.
+func TestServeDNSFollowSVCBDisabledIgnoresHints(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = httpsAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeHTTPS)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames = %+v, want a single entry", got.Status.ResolvedNames)
+	}
+	if addrs := got.Status.ResolvedNames[0].ResolvedAddresses; len(addrs) != 0 {
+		t.Fatalf("ResolvedAddresses = %v, want none recorded with followSVCB disabled", addrs)
+	}
+}
+
+type ipv4MappedAAAAAnswerHandler struct{ qname string }
+
+func (h ipv4MappedAAAAAnswerHandler) Name() string { return "ipv4mappedaaaaanswer" }
+
+func (h ipv4MappedAAAAAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{
+		&dns.AAAA{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 30}, AAAA: net.ParseIP("::ffff:10.0.0.1")},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// TestServeDNSDedupeResolvedAddressesCollapsesIPv4MappedAddress verifies
+// that with dedupeResolvedAddresses on, a name observed resolving to
+// 10.0.0.1 via an A answer and to its IPv4-mapped IPv6 form via a
+// subsequent AAAA answer ends up with a single ResolvedAddress, instead
+// of two entries representing the same endpoint.
+func TestServeDNSDedupeResolvedAddressesCollapsesIPv4MappedAddress(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.dedupeResolvedAddresses = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+	aReq := new(dns.Msg)
+	aReq.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, aReq); err != nil {
+		t.Fatalf("ServeDNS() A query returned error: %v", err)
+	}
+
+	h.Next = ipv4MappedAAAAAnswerHandler{qname: "foo.example.com."}
+	aaaaReq := new(dns.Msg)
+	aaaaReq.SetQuestion("foo.example.com.", dns.TypeAAAA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, aaaaReq); err != nil {
+		t.Fatalf("ServeDNS() AAAA query returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames = %+v, want a single entry", got.Status.ResolvedNames)
+	}
+	addrs := got.Status.ResolvedNames[0].ResolvedAddresses
+	if len(addrs) != 1 || addrs[0].IP != "10.0.0.1" {
+		t.Fatalf("ResolvedAddresses after an A then IPv4-mapped AAAA answer = %v, want a single collapsed 10.0.0.1 entry", addrs)
+	}
+}
+
+// authoritativeAAnswerHandler responds like aAnswerHandler but with the
+// AA (authoritative answer) bit set, for requireAuthoritative tests.
+type authoritativeAAnswerHandler struct{ qname string }
+
+func (h authoritativeAAnswerHandler) Name() string { return "authoritativeaanswer" }
+
+func (h authoritativeAAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+	m.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// TestServeDNSRequireAuthoritativeTracksAAResponse verifies that with
+// requireAuthoritative on, a response with the AA bit set is tracked.
+func TestServeDNSRequireAuthoritativeTracksAAResponse(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.requireAuthoritative = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = authoritativeAAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("expected an AA response to be tracked, got status %+v", got.Status)
+	}
+}
+
+// TestServeDNSRequireAuthoritativeSkipsNonAAResponse verifies that with
+// requireAuthoritative on, a response without the AA bit set (e.g. served
+// from CoreDNS's own recursive cache) is passed through without any
+// status update.
+func TestServeDNSRequireAuthoritativeSkipsNonAAResponse(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.requireAuthoritative = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want success (response still passed through)", rcode)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 0 {
+		t.Fatalf("expected a non-AA response to be skipped, got status %+v", got.Status)
+	}
+}
+
+// twoAAnswerHandler responds with two distinct A records, for tests that
+// need more than one address to exercise a filtering hook against.
+type twoAAnswerHandler struct{ qname string }
+
+func (h twoAAnswerHandler) Name() string { return "twoaanswer" }
+
+func (h twoAAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.A{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("10.0.0.2")},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// TestServeDNSIPFilterExcludeListDropsExcludedAddress verifies that an
+// address listed in an ipFilter excludeList hook is dropped from status
+// while the other resolved address is kept.
+func TestServeDNSIPFilterExcludeListDropsExcludedAddress(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.ipFilters = []ipFilterFunc{newExcludeListFilter(map[string]struct{}{"10.0.0.1": {}})}
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+
+	h.Next = twoAAnswerHandler{qname: "foo.example.com."}
+	req := new(dns.Msg)
+	req.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, req); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames = %+v, want a single entry", got.Status.ResolvedNames)
+	}
+	addrs := got.Status.ResolvedNames[0].ResolvedAddresses
+	if len(addrs) != 1 || addrs[0].IP != "10.0.0.2" {
+		t.Fatalf("ResolvedAddresses with an excludeList hook = %v, want only 10.0.0.2", addrs)
+	}
+}
+
+// privateAndPublicAAnswerHandler responds with one RFC 1918 address and
+// one routable address, for tests exercising privateFilter.
+type privateAndPublicAAnswerHandler struct{ qname string }
+
+func (h privateAndPublicAAnswerHandler) Name() string { return "privateandpublicaanswer" }
+
+func (h privateAndPublicAAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.A{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("203.0.113.1")},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// TestServeDNSIPFilterPrivateFilterDropsPrivateAddress verifies the
+// built-in privateFilter hook drops a private-use address while keeping a
+// routable one.
+func TestServeDNSIPFilterPrivateFilterDropsPrivateAddress(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.ipFilters = []ipFilterFunc{privateFilter}
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+
+	h.Next = privateAndPublicAAnswerHandler{qname: "foo.example.com."}
+	req := new(dns.Msg)
+	req.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, req); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames = %+v, want a single entry", got.Status.ResolvedNames)
+	}
+	addrs := got.Status.ResolvedNames[0].ResolvedAddresses
+	if len(addrs) != 1 || addrs[0].IP != "203.0.113.1" {
+		t.Fatalf("ResolvedAddresses with the privateFilter hook = %v, want only 203.0.113.1", addrs)
+	}
+}
+
+// mixedFamilyAAnswerHandler responds to an A query with a legitimate A
+// record alongside a smuggled/misplaced AAAA record, for tests
+// exercising family-mismatch filtering.
+type mixedFamilyAAnswerHandler struct{ qname string }
+
+func (h mixedFamilyAAnswerHandler) Name() string { return "mixedfamilyaanswer" }
+
+func (h mixedFamilyAAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = []dns.RR{
+		&dns.A{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 30}, A: net.ParseIP("10.0.0.1")},
+		&dns.AAAA{Hdr: dns.RR_Header{Name: h.qname, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 30}, AAAA: net.ParseIP("2001:db8::1")},
+	}
+	return dns.RcodeSuccess, w.WriteMsg(m)
+}
+
+// TestServeDNSMixedFamilyAnswerDropsMismatchedRecordOnly verifies that a
+// response to an A query carrying a stray AAAA record has that record
+// excluded from status, while the legitimate A record is still recorded
+// rather than the whole answer being discarded.
+func TestServeDNSMixedFamilyAnswerDropsMismatchedRecordOnly(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+
+	h.Next = mixedFamilyAAnswerHandler{qname: "foo.example.com."}
+	req := new(dns.Msg)
+	req.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, req); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames = %+v, want a single entry", got.Status.ResolvedNames)
+	}
+	addrs := got.Status.ResolvedNames[0].ResolvedAddresses
+	if len(addrs) != 1 || addrs[0].IP != "10.0.0.1" {
+		t.Fatalf("ResolvedAddresses for an A query with a stray AAAA record = %v, want only 10.0.0.1", addrs)
+	}
+}
+
+// TestServeDNSSyncStatusUpdateBlocksUntilComplete verifies the default,
+// synchronous mode: ServeDNS doesn't return until the status update
+// against a slow apiserver has finished.
+func TestServeDNSSyncStatusUpdateBlocksUntilComplete(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	slowClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		Get: func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			time.Sleep(20 * time.Millisecond)
+			return fakeClient.Get(ctx, key, obj, opts...)
+		},
+	})
+
+	h := New()
+	h.client = slowClient
+	h.updateTimeout = time.Second
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	start := time.Now()
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("ServeDNS() returned after %v, want it to block for the slow client's 20ms Get", elapsed)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames = %+v, want the update to have already landed", got.Status.ResolvedNames)
+	}
+}
+
+// TestServeDNSAsyncStatusUpdateReturnsBeforeUpdateCompletes verifies that,
+// with asyncStatusUpdate set, ServeDNS returns the response without
+// waiting for a slow status update, which then lands in the background.
+func TestServeDNSAsyncStatusUpdateReturnsBeforeUpdateCompletes(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+	slowClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		Get: func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			time.Sleep(30 * time.Millisecond)
+			return fakeClient.Get(ctx, key, obj, opts...)
+		},
+	})
+
+	h := New()
+	h.client = slowClient
+	h.updateTimeout = time.Second
+	h.asyncStatusUpdate = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	start := time.Now()
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 15*time.Millisecond {
+		t.Fatalf("ServeDNS() with asyncStatusUpdate took %v, want it to return well before the slow client's 30ms Get", elapsed)
+	}
+
+	deadline := time.After(time.Second)
+	for {
+		var got networkv1alpha1.DNSNameResolver
+		if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+			t.Fatalf("failed to fetch object: %v", err)
+		}
+		if len(got.Status.ResolvedNames) == 1 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("background status update never landed")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// TestServeDNSAsyncStatusUpdateDropsWhenQueueFull verifies that, once the
+// bounded async queue is at capacity, further updates are dropped and
+// counted rather than spawning unbounded goroutines.
+func TestServeDNSAsyncStatusUpdateDropsWhenQueueFull(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	release := make(chan struct{})
+	blockingClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		Get: func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			<-release
+			return fakeClient.Get(ctx, key, obj, opts...)
+		},
+	})
+	defer close(release)
+
+	h := New()
+	h.client = blockingClient
+	h.updateTimeout = time.Second
+	h.asyncStatusUpdate = true
+	h.asyncQueue = newAsyncUpdateQueue(1)
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	before := readCounter(t, asyncStatusUpdatesDroppedTotal)
+
+	for i := 0; i < 3; i++ {
+		r := new(dns.Msg)
+		r.SetQuestion("foo.example.com.", dns.TypeA)
+		if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+			t.Fatalf("ServeDNS() returned error: %v", err)
+		}
+	}
+
+	if got := readCounter(t, asyncStatusUpdatesDroppedTotal); got <= before {
+		t.Fatalf("async_status_updates_dropped_total = %v, want it to have increased from %v once the queue filled up", got, before)
+	}
+}
+
+// slowAAnswerHandler is a plugin.Handler like aAnswerHandler, except it
+// sleeps for a fixed duration before answering, simulating a slow chain
+// ahead of this plugin so processingBudget has something to catch.
+type slowAAnswerHandler struct {
+	aAnswerHandler
+	delay time.Duration
+}
+
+func (h slowAAnswerHandler) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg) (int, error) {
+	time.Sleep(h.delay)
+	return h.aAnswerHandler.ServeDNS(ctx, w, r)
+}
+
+// TestServeDNSProcessingBudgetExceededIncrementsMetric verifies that,
+// once the chain call alone takes longer than processingBudget,
+// ServeDNS counts it in budgetExceededTotal.
+func TestServeDNSProcessingBudgetExceededIncrementsMetric(t *testing.T) {
+	h := New()
+	h.updateTimeout = time.Second
+	h.processingBudget = 10 * time.Millisecond
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = slowAAnswerHandler{aAnswerHandler: aAnswerHandler{qname: "foo.example.com."}, delay: 30 * time.Millisecond}
+
+	before := readCounter(t, budgetExceededTotal)
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	if got := readCounter(t, budgetExceededTotal); got <= before {
+		t.Fatalf("budget_exceeded_total = %v, want it to have increased from %v once the chain call alone exceeded the 10ms budget", got, before)
+	}
+}
+
+// TestServeDNSProcessingBudgetUnderThresholdLeavesMetricUntouched
+// verifies that a fast chain, well under processingBudget, doesn't
+// increment budgetExceededTotal.
+func TestServeDNSProcessingBudgetUnderThresholdLeavesMetricUntouched(t *testing.T) {
+	h := New()
+	h.updateTimeout = time.Second
+	h.processingBudget = time.Second
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	before := readCounter(t, budgetExceededTotal)
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	if got := readCounter(t, budgetExceededTotal); got != before {
+		t.Fatalf("budget_exceeded_total = %v, want it to stay at %v when well under the 1s budget", got, before)
+	}
+}
+
+// TestAsyncUpdateQueueDrainWaitsForInFlightUpdate verifies that drain
+// blocks until an asyncStatusUpdate update already in flight has
+// actually written its status, the behavior a shutdown-time flush
+// depends on to avoid losing a pending update.
+func TestAsyncUpdateQueueDrainWaitsForInFlightUpdate(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var once sync.Once
+	blockingClient := interceptor.NewClient(fakeClient, interceptor.Funcs{
+		Get: func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			once.Do(func() { close(started) })
+			<-release
+			return fakeClient.Get(ctx, key, obj, opts...)
+		},
+	})
+
+	h := New()
+	h.client = blockingClient
+	h.updateTimeout = time.Second
+	h.asyncStatusUpdate = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	<-started
+
+	drained := make(chan bool, 1)
+	go func() { drained <- h.asyncQueue.drain(time.Second) }()
+	close(release)
+
+	select {
+	case ok := <-drained:
+		if !ok {
+			t.Fatal("drain() = false, want true: the in-flight update should finish well within the timeout")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain() did not return")
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("expected the in-flight update to have written status before drain() returned, got %+v", got.Status)
+	}
+}
+
+// TestAsyncUpdateQueueDrainTimesOut verifies that drain gives up and
+// reports false once its timeout elapses, rather than blocking shutdown
+// forever on an update that never finishes.
+func TestAsyncUpdateQueueDrainTimesOut(t *testing.T) {
+	q := newAsyncUpdateQueue(1)
+	block := make(chan struct{})
+	defer close(block)
+	if !q.tryRun(func() { <-block }) {
+		t.Fatal("tryRun() = false, want true")
+	}
+	if q.drain(20 * time.Millisecond) {
+		t.Fatal("drain() = true, want false: the in-flight update never finishes")
+	}
+}
+
+// TestServeDNSZonesInZoneTracksQuery verifies that with zones configured,
+// a query falling under one of them is still tracked normally.
+func TestServeDNSZonesInZoneTracksQuery(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.zones = []string{"example.com."}
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 1 {
+		t.Fatalf("expected an in-zone query to be tracked, got status %+v", got.Status)
+	}
+}
+
+// TestServeDNSZonesOutOfZoneSkipsTracking verifies that with zones
+// configured, a query falling outside all of them is passed through
+// without any status update, even though it otherwise matches a tracked
+// object.
+func TestServeDNSZonesOutOfZoneSkipsTracking(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.zones = []string{"example.org."}
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want %v (the response still passes through)", rcode, dns.RcodeSuccess)
+	}
+
+	var got networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &got); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(got.Status.ResolvedNames) != 0 {
+		t.Fatalf("expected an out-of-zone query to be untracked, got status %+v", got.Status)
+	}
+}
+
+// TestServeDNSWarmupDefersUpdate verifies that, with warmupDeadline set
+// in the future, a matched query still passes the response through but
+// leaves the DNSNameResolver's status untouched until flushWarmupUpdates
+// applies the buffered update.
+func TestServeDNSWarmupDefersUpdate(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.warmupPeriod = time.Minute
+	h.warmupDeadline = time.Now().Add(time.Minute)
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	rcode, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r)
+	if err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+	if rcode != dns.RcodeSuccess {
+		t.Errorf("ServeDNS() rcode = %v, want %v", rcode, dns.RcodeSuccess)
+	}
+
+	var gotDuringWarmup networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &gotDuringWarmup); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(gotDuringWarmup.Status.ResolvedNames) != 0 {
+		t.Fatalf("Status.ResolvedNames during warmup = %+v, want the update held back", gotDuringWarmup.Status.ResolvedNames)
+	}
+
+	h.warmupDeadline = time.Now().Add(-time.Second)
+	h.flushWarmupUpdates()
+
+	var gotAfterFlush networkv1alpha1.DNSNameResolver
+	if err := fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "ns1", Name: "obj1"}, &gotAfterFlush); err != nil {
+		t.Fatalf("failed to fetch object: %v", err)
+	}
+	if len(gotAfterFlush.Status.ResolvedNames) != 1 {
+		t.Fatalf("Status.ResolvedNames after flush = %+v, want the buffered update applied", gotAfterFlush.Status.ResolvedNames)
+	}
+}
+
+// TestServeDNSWarmupCoalescesRepeatedUpdates verifies that two queries
+// for the same name during warmup leave only one buffered update, so
+// flushWarmupUpdates applies a single coalesced write rather than one
+// per query observed during the warmup window.
+func TestServeDNSWarmupCoalescesRepeatedUpdates(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.warmupPeriod = time.Minute
+	h.warmupDeadline = time.Now().Add(time.Minute)
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	for i := 0; i < 2; i++ {
+		r := new(dns.Msg)
+		r.SetQuestion("foo.example.com.", dns.TypeA)
+		if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+			t.Fatalf("ServeDNS() returned error: %v", err)
+		}
+	}
+
+	if got := len(h.pendingWarmupUpdates); got != 1 {
+		t.Fatalf("pendingWarmupUpdates has %d entries, want 1 (coalesced by qname)", got)
+	}
+}
@@ -0,0 +1,73 @@
+package dnsnameresolver
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+// resolutionHistorySize bounds how many ResolutionRecords are kept per
+// DNS name by the in-memory resolution history, for forensic debugging
+// of flapping resolutions. 0 (the default) disables it entirely.
+var resolutionHistorySize int
+
+func init() {
+	flag.IntVar(&resolutionHistorySize, "resolution-history-size", 0,
+		"Number of recent resolution records to retain in memory per tracked DNS name, for forensic debugging. 0 disables it.")
+}
+
+// ResolutionRecord is a single observed resolution outcome for a tracked
+// DNS name.
+type ResolutionRecord struct {
+	Time  time.Time
+	Rcode int
+	IPs   []string
+}
+
+// resolutionHistory is a fixed-capacity, per-name ring buffer of recent
+// ResolutionRecords, capped live against resolutionHistorySize rather
+// than a size captured at construction, so --resolution-history-size
+// behaves the same way the plugin's other flags do in tests.
+type resolutionHistory struct {
+	mu      sync.Mutex
+	entries map[string][]ResolutionRecord
+}
+
+func newResolutionHistory() *resolutionHistory {
+	return &resolutionHistory{entries: make(map[string][]ResolutionRecord)}
+}
+
+// record appends a ResolutionRecord for dnsName, trimming the oldest
+// entries once resolutionHistorySize is exceeded. It's a no-op while the
+// history is disabled.
+func (rh *resolutionHistory) record(dnsName string, rcode int, ips []string) {
+	if resolutionHistorySize <= 0 {
+		return
+	}
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+
+	records := append(rh.entries[dnsName], ResolutionRecord{Time: time.Now(), Rcode: rcode, IPs: ips})
+	if len(records) > resolutionHistorySize {
+		records = records[len(records)-resolutionHistorySize:]
+	}
+	rh.entries[dnsName] = records
+}
+
+// history returns a copy of the recorded ResolutionRecords for dnsName,
+// oldest first.
+func (rh *resolutionHistory) history(dnsName string) []ResolutionRecord {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	return append([]ResolutionRecord(nil), rh.entries[dnsName]...)
+}
+
+// ipsOf returns the addresses in ipTTLs as a plain slice, for recording
+// into a ResolutionRecord.
+func ipsOf(ipTTLs map[string]ipTTL) []string {
+	ips := make([]string, 0, len(ipTTLs))
+	for ip := range ipTTLs {
+		ips = append(ips, ip)
+	}
+	return ips
+}
@@ -0,0 +1,35 @@
+package dnsnameresolver
+
+import "testing"
+
+func TestResolutionHistoryRecordsAndBounds(t *testing.T) {
+	old := resolutionHistorySize
+	defer func() { resolutionHistorySize = old }()
+	resolutionHistorySize = 2
+
+	rh := newResolutionHistory()
+	rh.record("example.com.", 0, []string{"10.0.0.1"})
+	rh.record("example.com.", 0, []string{"10.0.0.2"})
+	rh.record("example.com.", 3, nil)
+
+	got := rh.history("example.com.")
+	if len(got) != 2 {
+		t.Fatalf("history() returned %d entries, want 2 (bounded by resolutionHistorySize)", len(got))
+	}
+	if got[0].IPs[0] != "10.0.0.2" || got[1].Rcode != 3 {
+		t.Fatalf("history() = %+v, want the two most recent records, oldest first", got)
+	}
+}
+
+func TestResolutionHistoryDisabledByDefault(t *testing.T) {
+	old := resolutionHistorySize
+	defer func() { resolutionHistorySize = old }()
+	resolutionHistorySize = 0
+
+	rh := newResolutionHistory()
+	rh.record("example.com.", 0, []string{"10.0.0.1"})
+
+	if got := rh.history("example.com."); len(got) != 0 {
+		t.Fatalf("history() = %+v, want empty while resolutionHistorySize is 0", got)
+	}
+}
@@ -0,0 +1,43 @@
+package dnsnameresolver
+
+import "net"
+
+// ipFilterFunc transforms an ipTTLs map extracted from a DNS response
+// before it's recorded in a DNSNameResolver object's status, e.g. to
+// exclude an address a firewall integration never wants to see tracked.
+// It returns the map to record; returning ipTTLs unchanged is a no-op.
+// h.ipFilters holds a slice of these, applied in order by runUpdates, so
+// hooks compose: each one only has to reason about the map it's handed,
+// not about any other configured hook.
+type ipFilterFunc func(ipTTLs map[string]ipTTL) map[string]ipTTL
+
+// newExcludeListFilter returns an ipFilterFunc for the ipFilter
+// excludeList directive, dropping any address in exclude from the map.
+func newExcludeListFilter(exclude map[string]struct{}) ipFilterFunc {
+	return func(ipTTLs map[string]ipTTL) map[string]ipTTL {
+		filtered := make(map[string]ipTTL, len(ipTTLs))
+		for ip, ttl := range ipTTLs {
+			if _, excluded := exclude[ip]; !excluded {
+				filtered[ip] = ttl
+			}
+		}
+		return filtered
+	}
+}
+
+// privateFilter is the ipFilterFunc for the ipFilter privateFilter
+// directive, dropping any address in a private-use or link-local range
+// (RFC 1918, RFC 4193 unique local, or link-local) so status never
+// records an internal-only address alongside the routable ones a
+// firewall rule needs.
+func privateFilter(ipTTLs map[string]ipTTL) map[string]ipTTL {
+	filtered := make(map[string]ipTTL, len(ipTTLs))
+	for ip, ttl := range ipTTLs {
+		parsed := net.ParseIP(ip)
+		if parsed != nil && (parsed.IsPrivate() || parsed.IsLinkLocalUnicast()) {
+			continue
+		}
+		filtered[ip] = ttl
+	}
+	return filtered
+}
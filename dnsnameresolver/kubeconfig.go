@@ -0,0 +1,47 @@
+package dnsnameresolver
+
+import (
+	"flag"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+)
+
+// kubeconfigPath and kubeconfigContext let an operator point setup's
+// manager at a specific cluster and context for out-of-cluster debugging,
+// instead of always relying on the in-cluster config a production
+// deployment runs with.
+var kubeconfigPath string
+var kubeconfigContext string
+
+func init() {
+	flag.StringVar(&kubeconfigPath, "kubeconfig", "",
+		"Path to a kubeconfig file to use instead of the standard in-cluster/KUBECONFIG resolution, for out-of-cluster debugging. Empty (the default) uses that standard resolution.")
+	flag.StringVar(&kubeconfigContext, "context", "",
+		"Kubeconfig context to use. Without --kubeconfig, it selects a context from the standard KUBECONFIG/~/.kube/config loading rules instead of the in-cluster config. Empty (the default) uses the kubeconfig's current-context.")
+}
+
+// resolveRestConfig builds the *rest.Config setup's manager connects
+// with. With neither --kubeconfig nor --context set, it defers entirely
+// to controller-runtime's standard resolution (in-cluster config, then
+// $KUBECONFIG, then ~/.kube/config), exactly as before these flags
+// existed. With either set, it instead loads the named kubeconfig
+// file/context explicitly, so a locally-run build can target a specific
+// cluster context without exporting KUBECONFIG or editing the current
+// context out from under other tools.
+func resolveRestConfig() (*rest.Config, error) {
+	if kubeconfigPath == "" && kubeconfigContext == "" {
+		return config.GetConfig()
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfigPath != "" {
+		loadingRules.ExplicitPath = kubeconfigPath
+	}
+	overrides := &clientcmd.ConfigOverrides{}
+	if kubeconfigContext != "" {
+		overrides.CurrentContext = kubeconfigContext
+	}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+}
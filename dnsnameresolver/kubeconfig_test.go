@@ -0,0 +1,72 @@
+package dnsnameresolver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// multiContextKubeconfig is a minimal kubeconfig with two contexts
+// pointing at distinct clusters, used to verify resolveRestConfig picks
+// the requested one rather than always falling back to current-context.
+const multiContextKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: cluster-a
+  cluster:
+    server: https://cluster-a.example.com:6443
+- name: cluster-b
+  cluster:
+    server: https://cluster-b.example.com:6443
+contexts:
+- name: context-a
+  context:
+    cluster: cluster-a
+- name: context-b
+  context:
+    cluster: cluster-b
+current-context: context-a
+`
+
+func TestResolveRestConfigSelectsNamedContext(t *testing.T) {
+	oldPath, oldContext := kubeconfigPath, kubeconfigContext
+	defer func() { kubeconfigPath, kubeconfigContext = oldPath, oldContext }()
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(multiContextKubeconfig), 0o600); err != nil {
+		t.Fatalf("failed to write temp kubeconfig: %v", err)
+	}
+
+	kubeconfigPath = path
+	kubeconfigContext = "context-b"
+
+	restConfig, err := resolveRestConfig()
+	if err != nil {
+		t.Fatalf("resolveRestConfig() error = %v", err)
+	}
+	if restConfig.Host != "https://cluster-b.example.com:6443" {
+		t.Errorf("resolveRestConfig() with context-b Host = %q, want %q", restConfig.Host, "https://cluster-b.example.com:6443")
+	}
+}
+
+func TestResolveRestConfigDefaultsToCurrentContext(t *testing.T) {
+	oldPath, oldContext := kubeconfigPath, kubeconfigContext
+	defer func() { kubeconfigPath, kubeconfigContext = oldPath, oldContext }()
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(multiContextKubeconfig), 0o600); err != nil {
+		t.Fatalf("failed to write temp kubeconfig: %v", err)
+	}
+
+	kubeconfigPath = path
+	kubeconfigContext = ""
+
+	restConfig, err := resolveRestConfig()
+	if err != nil {
+		t.Fatalf("resolveRestConfig() error = %v", err)
+	}
+	if restConfig.Host != "https://cluster-a.example.com:6443" {
+		t.Errorf("resolveRestConfig() with no --context Host = %q, want the kubeconfig's current-context %q", restConfig.Host, "https://cluster-a.example.com:6443")
+	}
+}
@@ -0,0 +1,334 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/miekg/dns"
+)
+
+// dnsSourceAddress is the local IP address to bind as the source address
+// for outbound lookups against CoreDNS. In multi-homed operator pods,
+// the OS's default route selection may not pick an interface that's
+// routable to the CoreDNS pods being queried. Empty (the default) leaves
+// the source address unbound.
+var dnsSourceAddress string
+
+// fallbackDNSServer is queried by lookupDNSNameFromCoreDNS when
+// getRandomCoreDNSPodIPs finds no pod IPs (e.g. during a CoreDNS
+// rollout), so proactive refreshes continue instead of stalling until a
+// pod comes back. Typically the cluster DNS service VIP. Empty (the
+// default) disables the fallback: no pod IPs means the lookup fails.
+var fallbackDNSServer string
+
+// dnsECSSubnet, when set, is attached to outbound proactive lookups as an
+// EDNS Client Subnet option (RFC 7871), so a CoreDNS `view` plugin routes
+// this plugin's own lookups to the same server block a real client from
+// that subnet would hit, instead of whatever block matches this operator's
+// own pod IP. Empty (the default) attaches no ECS option.
+var dnsECSSubnet string
+
+// cacheHitRTTThreshold is the round-trip time below which a proactive
+// lookup's response is heuristically classified as a CoreDNS cache hit
+// rather than a query CoreDNS had to forward upstream, for
+// ocp_dnsnameresolver_coredns_cache_hits_total /
+// ..._cache_misses_total. There's no flag in the DNS response itself
+// that says whether the answering server's cache was used, so this is
+// necessarily an approximation: a genuinely fast upstream can be
+// misclassified as a hit, and a momentarily slow local cache lookup
+// (e.g. under load) as a miss. Useful only in aggregate, for tuning
+// TTLs, not as a per-query guarantee.
+var cacheHitRTTThreshold time.Duration
+
+func init() {
+	flag.StringVar(&dnsSourceAddress, "dns-source-address", "",
+		"Local IP address to bind as the source address for outbound DNS lookups against CoreDNS. Default: unbound.")
+	flag.StringVar(&fallbackDNSServer, "fallback-dns-server", "",
+		"DNS server address (host:port) to query when no CoreDNS pod IPs are available, e.g. the cluster DNS service VIP. Disabled by default.")
+	flag.StringVar(&dnsECSSubnet, "dns-ecs-subnet", "",
+		"CIDR to attach as an EDNS Client Subnet option (RFC 7871) on outbound proactive lookups, so a CoreDNS view plugin routes them the way it would a real client from that subnet. Empty by default, which attaches no ECS option.")
+	flag.DurationVar(&cacheHitRTTThreshold, "cache-hit-rtt-threshold", 2*time.Millisecond,
+		"Round-trip time below which a proactive lookup's response is heuristically counted as a CoreDNS cache hit rather than an upstream query, for the ocp_dnsnameresolver_coredns_cache_hits_total/misses_total metrics.")
+}
+
+// classifyCacheOutcome heuristically labels rtt as a CoreDNS cache hit or
+// miss against cacheHitRTTThreshold, for
+// ocp_dnsnameresolver_coredns_cache_hits_total /
+// ..._cache_misses_total. See cacheHitRTTThreshold's doc comment for why
+// this is only a heuristic.
+func classifyCacheOutcome(rtt time.Duration) string {
+	if rtt < cacheHitRTTThreshold {
+		return "hit"
+	}
+	return "miss"
+}
+
+// ecsSubnetOption returns the EDNS0 Client Subnet option (RFC 7871) to
+// attach to outbound lookups, built from --dns-ecs-subnet, or nil if unset
+// or invalid.
+func ecsSubnetOption() *dns.EDNS0_SUBNET {
+	if dnsECSSubnet == "" {
+		return nil
+	}
+	ip, ipNet, err := net.ParseCIDR(dnsECSSubnet)
+	if err != nil {
+		clog.Errorf("dnsnameresolver: --dns-ecs-subnet %q is not a valid CIDR, omitting the ECS option", dnsECSSubnet)
+		return nil
+	}
+	ones, _ := ipNet.Mask.Size()
+	family := uint16(1)
+	addr := ip.To4()
+	if addr == nil {
+		family = 2
+		addr = ip.To16()
+	}
+	return &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        family,
+		SourceNetmask: uint8(ones),
+		Address:       addr,
+	}
+}
+
+// newDNSClient returns a *dns.Client bound to dnsSourceAddress, if set.
+func newDNSClient() *dns.Client {
+	c := &dns.Client{}
+	if dnsSourceAddress == "" {
+		return c
+	}
+	ip := net.ParseIP(dnsSourceAddress)
+	if ip == nil {
+		clog.Errorf("dnsnameresolver: --dns-source-address %q is not a valid IP address, leaving lookups unbound", dnsSourceAddress)
+		return c
+	}
+	c.Dialer = &net.Dialer{LocalAddr: &net.UDPAddr{IP: ip}}
+	return c
+}
+
+// dnsExchanger is satisfied by *dns.Client; declared as an interface so
+// tests can substitute a fake without a real network round trip.
+// ExchangeContext is only used by lookupPTRName, whose caller derives its
+// deadline from a context rather than dns.Client's own default timeout;
+// every other user of this interface still calls Exchange.
+type dnsExchanger interface {
+	Exchange(m *dns.Msg, address string) (*dns.Msg, time.Duration, error)
+	ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error)
+}
+
+// negativeCacheError is returned by sendDNSLookupRequest in place of a
+// plain error when a negative response (NXDOMAIN or NODATA) carried an
+// SOA record in its authority section, so lookupAndSchedule can honor
+// the upstream's own negative-cache guidance (see minTTL's doc comment
+// on RFC 2308) instead of always falling back to defaultRetryInterval.
+type negativeCacheError struct {
+	err    error
+	minTTL uint32
+}
+
+func (n *negativeCacheError) Error() string {
+	if n.err != nil {
+		return n.err.Error()
+	}
+	return "dnsnameresolver: negative response"
+}
+
+func (n *negativeCacheError) Unwrap() error { return n.err }
+
+// soaMinimum returns the Minttl field of the first SOA record in resp's
+// authority section, and whether one was found. Per RFC 2308, that field
+// is what a negative (NXDOMAIN/NODATA) response's TTL should actually be
+// interpreted as: how long the answer may be cached, not the zone's SOA
+// refresh/retry timers.
+func soaMinimum(resp *dns.Msg) (uint32, bool) {
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Minttl, true
+		}
+	}
+	return 0, false
+}
+
+// sendDNSLookupRequest issues an A and an AAAA query for dnsName against
+// server and merges the results. The returned duration is the summed
+// round-trip time of both queries.
+func sendDNSLookupRequest(c dnsExchanger, server, dnsName string) (map[string]ipTTL, time.Duration, error) {
+	ipTTLs := make(map[string]ipTTL)
+	var total time.Duration
+	var lastErr error
+	var negMinTTL uint32
+	var haveNegMinTTL bool
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		msg := new(dns.Msg)
+		msg.SetQuestion(dns.Fqdn(dnsName), qtype)
+		msg.RecursionDesired = true
+		ecsOpt := ecsSubnetOption()
+		if dnsCookieEnabled || ecsOpt != nil {
+			msg.SetEdns0(4096, false)
+			opt := msg.IsEdns0()
+			if dnsCookieEnabled {
+				opt.Option = append(opt.Option, defaultCookieJar.option(server))
+			}
+			if ecsOpt != nil {
+				opt.Option = append(opt.Option, ecsOpt)
+			}
+		}
+
+		resp, rtt, err := c.Exchange(msg, server)
+		total += rtt
+		upstreamRTT.WithLabelValues(dns.TypeToString[qtype]).Observe(rtt.Seconds())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if classifyCacheOutcome(rtt) == "hit" {
+			coreDNSCacheHitsTotal.Inc()
+		} else {
+			coreDNSCacheMissesTotal.Inc()
+		}
+		if !validResponseQuestion(msg, resp) {
+			clog.Warningf("dnsnameresolver: discarding a %s response from %s for %q: question section %v doesn't match the query", dns.TypeToString[qtype], server, dnsName, resp.Question)
+			continue
+		}
+		if dnsCookieEnabled {
+			defaultCookieJar.observe(server, resp)
+		}
+		discardAnswersForOtherOwners(resp, dnsName, server)
+		// followSVCB is false here: this is the proactive lookup path
+		// querying for A/AAAA directly, not the client-facing SVCB
+		// glue-record parsing extractIPTTLs otherwise supports.
+		for k, v := range extractIPTTLs(resp, 0, false) {
+			ipTTLs[k] = v
+		}
+		if len(resp.Answer) == 0 {
+			if minTTL, ok := soaMinimum(resp); ok && (!haveNegMinTTL || minTTL < negMinTTL) {
+				negMinTTL, haveNegMinTTL = minTTL, true
+			}
+		}
+	}
+
+	if len(ipTTLs) == 0 {
+		if haveNegMinTTL {
+			return nil, total, &negativeCacheError{err: lastErr, minTTL: negMinTTL}
+		}
+		if lastErr != nil {
+			return nil, total, lastErr
+		}
+	}
+	return ipTTLs, total, nil
+}
+
+// validResponseQuestion reports whether resp's question section actually
+// matches the query msg was sent as, so a response for a different name
+// or record type — spoofed, or a hijacked/misrouted answer from a
+// misbehaving upstream — can't be mistaken for an answer to this lookup.
+func validResponseQuestion(msg, resp *dns.Msg) bool {
+	if len(msg.Question) != 1 || len(resp.Question) != 1 {
+		return false
+	}
+	q, want := resp.Question[0], msg.Question[0]
+	return strings.EqualFold(q.Name, want.Name) && q.Qtype == want.Qtype && q.Qclass == want.Qclass
+}
+
+// discardAnswersForOtherOwners drops any of resp's answer records whose
+// owner name doesn't match dnsName, so a compromised or spoofed upstream
+// can't smuggle records for an unrelated name into an otherwise
+// legitimate-looking response. This plugin doesn't follow CNAME chains
+// (extractIPTTLs only looks at A/AAAA records), so every record answering
+// a lookup for dnsName is expected to be owned by dnsName itself.
+// Discarded records are logged rather than silently dropped, since seeing
+// any is itself a sign of a malfunctioning or hostile upstream.
+func discardAnswersForOtherOwners(resp *dns.Msg, dnsName, server string) {
+	fqdn := dns.Fqdn(dnsName)
+	kept := resp.Answer[:0]
+	for _, rr := range resp.Answer {
+		if !strings.EqualFold(rr.Header().Name, fqdn) {
+			clog.Warningf("dnsnameresolver: discarding an answer record for %q from %s in a response to a lookup for %q: owner name doesn't match", rr.Header().Name, server, dnsName)
+			continue
+		}
+		kept = append(kept, rr)
+	}
+	resp.Answer = kept
+}
+
+// getRandomCoreDNSPodIPs returns the address(es) this process should
+// query for its own proactive lookups. It defaults to the local CoreDNS
+// instance; overridden in tests.
+//
+// This plugin doesn't consume EndpointSlice objects to discover other
+// CoreDNS pods, so there's no Conditions.Ready interpretation here to
+// make conservative: the assumption is that this plugin runs colocated
+// with the CoreDNS instance it queries (e.g. as a sidecar container in
+// the same pod), which is always either up or not answering at all. If
+// EndpointSlice-based selection across multiple CoreDNS pods is added
+// later, note that the EndpointSlice API itself documents a nil
+// Conditions.Ready as an unknown state that consumers should in most
+// cases treat as ready, not as not-ready — so that future addition
+// should default to the same interpretation this stub already has,
+// with a stricter opt-in flag for operators who want to exclude
+// endpoints with unknown readiness.
+var getRandomCoreDNSPodIPs = func() []string {
+	return []string{"127.0.0.1:53"}
+}
+
+// newDNSExchanger constructs the dnsExchanger lookupDNSNameFromCoreDNS
+// issues its queries through; overridden in tests to avoid a real
+// network round trip.
+var newDNSExchanger = func() dnsExchanger { return newDNSClient() }
+
+// lookupDNSNameFromCoreDNS resolves dnsName against every CoreDNS
+// instance selected by getRandomCoreDNSPodIPs, falling back to
+// fallbackDNSServer (if configured) when no pod IPs are available.
+func lookupDNSNameFromCoreDNS(dnsName string) (map[string]ipTTL, time.Duration, error) {
+	servers := getRandomCoreDNSPodIPs()
+	if len(servers) == 0 {
+		if fallbackDNSServer == "" {
+			return nil, 0, fmt.Errorf("dnsnameresolver: no CoreDNS servers available to query")
+		}
+		clog.Warningf("dnsnameresolver: no CoreDNS pod IPs available, querying fallback server %q", fallbackDNSServer)
+		return sendDNSLookupRequest(newDNSExchanger(), fallbackDNSServer, dnsName)
+	}
+	return aggregateDNSLookupAcrossServers(newDNSExchanger(), servers, dnsName)
+}
+
+// aggregateDNSLookupAcrossServers queries every server in servers for
+// dnsName and merges the results, keeping the minimum TTL observed for
+// each address across servers. Different CoreDNS pods' caches for the
+// same name can have aged by different amounts, so querying only one
+// pod (as lookupDNSNameFromCoreDNS used to) could record whichever TTL
+// that pod's cache happened to hold, flapping the stored value from one
+// proactive lookup to the next depending on which pod answered; the
+// minimum across pods is always a safe, consistent bound to cache to. A
+// server that errors is skipped rather than failing the whole lookup, as
+// long as at least one server answers.
+func aggregateDNSLookupAcrossServers(c dnsExchanger, servers []string, dnsName string) (map[string]ipTTL, time.Duration, error) {
+	merged := make(map[string]ipTTL)
+	var total time.Duration
+	var lastErr error
+	answered := false
+
+	for _, server := range servers {
+		ipTTLs, rtt, err := sendDNSLookupRequest(c, server, dnsName)
+		total += rtt
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		answered = true
+		for ip, ttl := range ipTTLs {
+			if existing, ok := merged[ip]; !ok || ttl.ttl < existing.ttl {
+				merged[ip] = ttl
+			}
+		}
+	}
+
+	if !answered {
+		return nil, total, lastErr
+	}
+	return merged, total, nil
+}
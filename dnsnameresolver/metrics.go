@@ -0,0 +1,237 @@
+package dnsnameresolver
+
+import (
+	"github.com/coredns/coredns/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsSubsystem is the prometheus subsystem name used by every metric
+// this plugin exports.
+const MetricsSubsystem = "dnsnameresolver"
+
+var (
+	updatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: MetricsSubsystem,
+		Name:      "status_updates_total",
+		Help:      "Counter of DNSNameResolver status updates, partitioned by result (success, error, or skipped when the object was deleted before the update could be applied).",
+	}, []string{"result"})
+
+	updateDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: plugin.Namespace,
+		Subsystem: MetricsSubsystem,
+		Name:      "status_update_duration_seconds",
+		Help:      "Histogram of the time it took to update a DNSNameResolver object's status.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// statusBytes uses the "ocp" namespace, rather than plugin.Namespace,
+	// since it describes the DNSNameResolver object rather than this
+	// CoreDNS server's own behavior.
+	statusBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "status_bytes",
+		Help:      "Size in bytes of a DNSNameResolver object's serialized status, to catch objects approaching the apiserver size limit.",
+	}, []string{"namespace", "name"})
+
+	// nameFanout uses the "ocp" namespace for the same reason statusBytes
+	// does: it describes a tracked DNS name, not this server's own
+	// behavior.
+	nameFanout = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "name_fanout",
+		Help:      "Number of distinct namespaces referencing a tracked DNS name, to spot hot names causing update write amplification.",
+	}, []string{"dnsname"})
+
+	// upstreamRTT tracks how long the proactive Resolver's own lookups
+	// against CoreDNS take, partitioned by query type, to help diagnose
+	// firewall-rule update lag caused by a slow upstream rather than a
+	// slow apiserver.
+	upstreamRTT = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "upstream_rtt_seconds",
+		Help:      "Histogram of the round-trip time of the plugin's own proactive DNS lookups against CoreDNS, partitioned by record_type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"record_type"})
+
+	// duplicateObjectsTotal counts DNSNameResolver objects that were
+	// skipped because another object in the same namespace already
+	// tracks the same DNS name; only one of them can back the fast
+	// lookup path.
+	duplicateObjectsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "duplicate_objects_total",
+		Help:      "Counter of DNSNameResolver objects skipped because another object in the same namespace already tracks the same DNS name.",
+	}, []string{"namespace"})
+
+	// updateOutcomeTotal captures what a single per-object updatesTotal
+	// counter can't: when several namespaces track the same DNS name, an
+	// update round can succeed for some of their objects and fail for
+	// others. Labeled on each matched object's own registered dnsName
+	// (the wildcard pattern itself for a wildcard object), never the raw
+	// client-queried name, so a client querying arbitrary subdomains
+	// under a tracked wildcard can't grow this metric's cardinality
+	// beyond the number of names actually being tracked.
+	updateOutcomeTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "update_outcome_total",
+		Help:      "Counter of combined per-name status update outcomes across every namespace tracking that DNS name, partitioned by dnsname and outcome (success, partial, or failure).",
+	}, []string{"dnsname", "outcome"})
+
+	// trackedNamesRejectedTotal counts names the Resolver refused to
+	// track proactively because --max-tracked-names was already reached.
+	trackedNamesRejectedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "tracked_names_rejected_total",
+		Help:      "Counter of DNS names the resolver refused to track proactively because --max-tracked-names was already reached.",
+	})
+
+	// asyncStatusUpdatesDroppedTotal counts status updates dropped
+	// because the asyncStatusUpdate directive's bounded queue was full.
+	asyncStatusUpdatesDroppedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "async_status_updates_dropped_total",
+		Help:      "Counter of status updates dropped because the asyncStatusUpdate directive's --async-status-update-queue-size was already reached.",
+	})
+
+	// budgetExceededTotal uses the "ocp" namespace, the same as
+	// duplicateObjectsTotal and friends, so it lines up with the metric
+	// name (ocp_dnsnameresolver_budget_exceeded_total) operators are told
+	// to alert on for the processingBudget directive.
+	budgetExceededTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "budget_exceeded_total",
+		Help:      "Counter of ServeDNS calls whose own overhead (chain call plus status update spawn) exceeded the processingBudget directive.",
+	})
+
+	// schedulerWakeupsTotal counts every timer tick or channel event that
+	// wakes Resolver.Start's scheduling loop. Registered like every other
+	// metric here, through the CoreDNS metrics plugin's shared registry
+	// in setup.go: this codebase has no separate controller-runtime
+	// metrics registration path to hook into.
+	schedulerWakeupsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "scheduler_wakeups_total",
+		Help:      "Counter of timer ticks and channel events that woke the proactive resolver's scheduling loop.",
+	})
+
+	// schedulerEmptyWakeupsTotal counts wakeups taken while no DNS name
+	// is tracked at all, e.g. an added/deleted notification arriving
+	// with an empty schedule. A wakeup while any name is tracked is not
+	// counted here, even if none of those names is due for a lookup yet.
+	// A high ratio against schedulerWakeupsTotal points at wasteful churn
+	// on those channels.
+	schedulerEmptyWakeupsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "scheduler_empty_wakeups_total",
+		Help:      "Counter of scheduling loop wakeups taken while no DNS name was tracked.",
+	})
+
+	// schedulerEventsDroppedTotal counts added/deleted notifications
+	// dropped because the corresponding channel's buffer was full, i.e.
+	// Start's loop wasn't keeping up. Dropping is safe: both channels are
+	// pure wakeup signals (Start always recomputes from r.dnsNames and
+	// r.nextLookups on wakeup), so a drop only risks a slightly delayed
+	// recheck, never a missed or stale lookup. A sustained rate here means
+	// Add/Delete/Prewarm callers (the informer handlers) are running far
+	// ahead of Start's scheduling loop.
+	schedulerEventsDroppedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "scheduler_events_dropped_total",
+		Help:      "Counter of added/deleted scheduler notifications dropped because the channel's bounded buffer was full.",
+	}, []string{"channel"})
+
+	// coreDNSCacheHitsTotal and coreDNSCacheMissesTotal count how many of
+	// the proactive Resolver's own lookups against CoreDNS were
+	// heuristically classified as a cache hit vs. a miss, per
+	// classifyCacheOutcome and --cache-hit-rtt-threshold, so operators
+	// tuning TTLs can see how often a refresh is actually reaching
+	// upstream instead of being served from CoreDNS's own cache.
+	coreDNSCacheHitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "coredns_cache_hits_total",
+		Help:      "Counter of the plugin's own proactive lookups against CoreDNS heuristically classified as a cache hit (round-trip time under --cache-hit-rtt-threshold).",
+	})
+	coreDNSCacheMissesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "coredns_cache_misses_total",
+		Help:      "Counter of the plugin's own proactive lookups against CoreDNS heuristically classified as a cache miss (round-trip time at or above --cache-hit-rtt-threshold).",
+	})
+
+	// successRatio uses the "ocp" namespace for the same reason
+	// statusBytes and nameFanout do: it describes a tracked DNS name's
+	// own resolution behavior, not this server's. It's a gauge, not a
+	// counter, since it's a ratio over the rolling window maintained by
+	// successRatioTracker rather than a monotonically increasing total.
+	successRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "success_ratio",
+		Help:      "Rolling ratio of successful resolutions to total observed for a tracked DNS name, over its most recent --success-ratio-window-size observations.",
+	}, []string{"dnsname"})
+
+	// buildInfo reports which plugin build is running, for fleet
+	// observability across many CoreDNS instances: its value is always 1,
+	// with version and commit (see version.go) carried as labels rather
+	// than as separate gauges, the conventional way to expose build
+	// metadata to Prometheus.
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "build_info",
+		Help:      "Gauge, always 1, whose version and commit labels identify the running plugin build.",
+	}, []string{"version", "commit"})
+
+	// externalStatusEditsDetectedTotal counts reconciles that found a
+	// tracked DNSNameResolver's status cleared of resolved addresses
+	// without this plugin's own NoAddresses condition to account for it
+	// (see statusLooksTampered), each of which triggers a corrective
+	// re-resolution.
+	externalStatusEditsDetectedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "external_status_edits_detected_total",
+		Help:      "Counter of reconciles that detected a tracked DNSNameResolver's resolved addresses were cleared by something other than this plugin and scheduled a corrective lookup.",
+	})
+
+	// specDriftTotal counts reconciles that found a tracked
+	// DNSNameResolver's spec (its DNS name or wildcard-ness) had changed
+	// since this plugin last cached it, most often because a watch event
+	// was missed while the controller was down or its watch connection
+	// was disrupted. The periodic reconcileResyncInterval requeue is what
+	// catches this without depending on the watch alone; a 0 (disabled)
+	// reconcileResyncInterval means drift is only ever caught by the next
+	// watch event that does arrive.
+	specDriftTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "spec_drift_total",
+		Help:      "Counter of reconciles that found a tracked DNSNameResolver's spec had changed since this plugin last cached it, typically caught by a missed watch event finally reconciling.",
+	})
+
+	// warmupUpdatesDeferredTotal counts status updates buffered by the
+	// warmup directive instead of being applied immediately; each
+	// increment means one qname's update was buffered (or re-buffered,
+	// overwriting a still-pending one), not that one ultimately got
+	// applied, since coalescing during the warmup window can mean several
+	// increments here correspond to a single eventual write.
+	warmupUpdatesDeferredTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "ocp",
+		Subsystem: MetricsSubsystem,
+		Name:      "warmup_updates_deferred_total",
+		Help:      "Counter of status updates buffered by the warmup directive instead of applied immediately, incremented once per ServeDNS call deferred (coalescing may mean fewer writes are eventually applied).",
+	})
+)
@@ -0,0 +1,27 @@
+package dnsnameresolver
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TestBuildInfoReportsVersionAndCommit verifies buildInfo is set to 1 under
+// the current version and commit labels, the way setup's OnStartup hook
+// populates it, so fleet-wide scraping can identify which build is running.
+func TestBuildInfoReportsVersionAndCommit(t *testing.T) {
+	oldVersion, oldCommit := version, commit
+	defer func() { version, commit = oldVersion, oldCommit }()
+	version, commit = "v1.2.3", "abcdef0"
+
+	buildInfo.Reset()
+	buildInfo.WithLabelValues(version, commit).Set(1)
+
+	var m dto.Metric
+	if err := buildInfo.WithLabelValues("v1.2.3", "abcdef0").Write(&m); err != nil {
+		t.Fatalf("failed to read ocp_dnsnameresolver_build_info: %v", err)
+	}
+	if got := m.GetGauge().GetValue(); got != 1 {
+		t.Errorf("build_info{version=%q,commit=%q} = %v, want 1", version, commit, got)
+	}
+}
@@ -0,0 +1,99 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// namespaceMatcher decides whether a namespace is one this plugin
+// instance was configured to watch. Exact names are looked up in a set
+// for O(1) matching; glob patterns (e.g. "tenant-*") are matched in
+// order as a fallback.
+type namespaceMatcher struct {
+	exact    map[string]struct{}
+	patterns []string
+}
+
+// configuredNamespace reports whether ns is one of the namespaces this
+// plugin instance was configured to watch DNSNameResolver objects in. A
+// nil matcher (no `namespaces` directive given) means "watch every
+// namespace". Guarded by namespacesMu since SetNamespaces can replace
+// h.namespaces concurrently with lookups made from Reconcile.
+func (h *OCPDNSNameResolver) configuredNamespace(ns string) bool {
+	h.namespacesMu.RLock()
+	defer h.namespacesMu.RUnlock()
+	return h.namespaces.match(ns)
+}
+
+// SetNamespaces atomically replaces the configured namespace set, parsed
+// from ns the same way the `namespaces` Corefile directive is (exact
+// names and glob patterns; see parseNamespaces), for future runtime
+// reconfiguration without a full Corefile reload. If c is non-nil,
+// SetNamespaces also runs reconcileAllNow against it afterward, so
+// objects in a namespace newly brought into scope are adopted
+// immediately instead of waiting for their next watch event.
+func (h *OCPDNSNameResolver) SetNamespaces(ctx context.Context, ns []string, c client.Client) error {
+	h.namespacesMu.Lock()
+	h.namespaces = parseNamespaces(ns)
+	h.namespacesMu.Unlock()
+
+	if c == nil {
+		return nil
+	}
+	return h.reconcileAllNow(ctx, c)
+}
+
+// match reports whether ns satisfies m. A nil matcher matches everything.
+func (m *namespaceMatcher) match(ns string) bool {
+	if m == nil {
+		return true
+	}
+	if _, ok := m.exact[ns]; ok {
+		return true
+	}
+	for _, pattern := range m.patterns {
+		if ok, _ := path.Match(pattern, ns); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the exact names and glob patterns m was built from, in a
+// deterministic order, for introspection (see Config in config.go). A
+// nil matcher, meaning "watch every namespace", returns nil.
+func (m *namespaceMatcher) list() []string {
+	if m == nil {
+		return nil
+	}
+	names := make([]string, 0, len(m.exact)+len(m.patterns))
+	for ns := range m.exact {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	return append(names, m.patterns...)
+}
+
+// isGlobPattern reports whether ns contains glob metacharacters and
+// should be matched with path.Match rather than as an exact name.
+func isGlobPattern(ns string) bool {
+	return strings.ContainsAny(ns, "*?[")
+}
+
+// parseNamespaces turns the space separated list of namespace names and
+// glob patterns from the Corefile `namespaces` directive into a matcher.
+func parseNamespaces(args []string) *namespaceMatcher {
+	m := &namespaceMatcher{exact: make(map[string]struct{}, len(args))}
+	for _, ns := range args {
+		if isGlobPattern(ns) {
+			m.patterns = append(m.patterns, ns)
+			continue
+		}
+		m.exact[ns] = struct{}{}
+	}
+	return m
+}
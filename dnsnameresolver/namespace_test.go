@@ -0,0 +1,85 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"testing"
+
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestConfiguredNamespace(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces *namespaceMatcher
+		ns         string
+		want       bool
+	}{
+		{"empty config matches all", nil, "any-namespace", true},
+		{"exact match", parseNamespaces([]string{"openshift-ingress"}), "openshift-ingress", true},
+		{"no match", parseNamespaces([]string{"openshift-ingress"}), "default", false},
+		{"glob match", parseNamespaces([]string{"tenant-*"}), "tenant-a", true},
+		{"glob no match", parseNamespaces([]string{"tenant-*"}), "other", false},
+		{"exact and glob combined", parseNamespaces([]string{"default", "tenant-*"}), "default", true},
+	}
+
+	for _, tt := range tests {
+		h := &OCPDNSNameResolver{namespaces: tt.namespaces}
+		if got := h.configuredNamespace(tt.ns); got != tt.want {
+			t.Errorf("%s: configuredNamespace(%q) = %v, want %v", tt.name, tt.ns, got, tt.want)
+		}
+	}
+}
+
+// TestSetNamespacesSwapsLiveAndAdoptsNewlyConfiguredNamespace verifies
+// that SetNamespaces atomically replaces the matcher configuredNamespace
+// consults, and that passing a client triggers reconcileAllNow so an
+// existing object in the newly-configured namespace is adopted right
+// away instead of waiting for its next watch event.
+func TestSetNamespacesSwapsLiveAndAdoptsNewlyConfiguredNamespace(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace = "tenant-b"
+	resolverObj.Name = "obj1"
+	resolverObj.Spec.Name = "example.com."
+
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).Build()
+	h := &OCPDNSNameResolver{
+		namespaces: parseNamespaces([]string{"tenant-a"}),
+		objects:    make(map[string]*object),
+		byName:     make(map[string]map[string]*object),
+		wildcards:  make(map[string]map[string]*object),
+	}
+
+	if h.configuredNamespace("tenant-b") {
+		t.Fatalf("configuredNamespace(%q) = true before SetNamespaces, want false", "tenant-b")
+	}
+
+	if err := h.SetNamespaces(context.Background(), []string{"tenant-b"}, fakeClient); err != nil {
+		t.Fatalf("SetNamespaces() error = %v", err)
+	}
+
+	if !h.configuredNamespace("tenant-b") {
+		t.Errorf("configuredNamespace(%q) = false after SetNamespaces, want true", "tenant-b")
+	}
+	if h.configuredNamespace("tenant-a") {
+		t.Errorf("configuredNamespace(%q) = true after SetNamespaces, want false: the old namespace set should be fully replaced, not merged", "tenant-a")
+	}
+	if matches := h.matchingObjects("example.com."); len(matches) != 1 {
+		t.Fatalf("matchingObjects() after SetNamespaces() = %v, want the newly-configured namespace's object adopted", matches)
+	}
+}
+
+// TestSetNamespacesWithoutClientOnlySwapsMatcher verifies that
+// SetNamespaces skips reconcileAllNow, rather than panicking, when
+// called with a nil client.
+func TestSetNamespacesWithoutClientOnlySwapsMatcher(t *testing.T) {
+	h := &OCPDNSNameResolver{namespaces: parseNamespaces([]string{"tenant-a"})}
+
+	if err := h.SetNamespaces(context.Background(), []string{"tenant-b"}, nil); err != nil {
+		t.Fatalf("SetNamespaces() error = %v", err)
+	}
+
+	if !h.configuredNamespace("tenant-b") {
+		t.Errorf("configuredNamespace(%q) = false after SetNamespaces, want true", "tenant-b")
+	}
+}
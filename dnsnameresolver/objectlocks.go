@@ -0,0 +1,43 @@
+package dnsnameresolver
+
+import "sync"
+
+// objectLocks hands out a mutex per DNSNameResolver object (keyed the same
+// way as OCPDNSNameResolver.objects, "namespace/name") so that updateStatus
+// calls racing to update the same object in-process serialize instead of
+// each doing its own unsynchronized Get/DeepCopy/Update against it. Without
+// this, two goroutines updating the same object concurrently (for example,
+// ServeDNS handling an A and an AAAA answer for the same name at nearly the
+// same time) can both Get the same ResourceVersion and have the second
+// Update rejected as a conflict, or silently lose whichever update landed
+// first.
+type objectLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newObjectLocks() *objectLocks {
+	return &objectLocks{locks: make(map[string]*sync.Mutex)}
+}
+
+// forObject returns the mutex for the object identified by namespace and
+// name, creating it on first use. A nil receiver (as in tests that build an
+// OCPDNSNameResolver by hand without going through New()) returns a fresh,
+// unshared mutex rather than panicking.
+func (o *objectLocks) forObject(namespace, name string) *sync.Mutex {
+	if o == nil {
+		return &sync.Mutex{}
+	}
+
+	key := namespace + "/" + name
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	l, ok := o.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		o.locks[key] = l
+	}
+	return l
+}
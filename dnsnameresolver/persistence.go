@@ -0,0 +1,108 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// schedulerStateSaveInterval controls how often, when persistSchedulerState
+// is configured, the resolver's scheduling snapshot is written back to its
+// ConfigMap. It's a flag rather than a directive argument since it's an
+// operational tuning knob rather than a feature toggle.
+var schedulerStateSaveInterval time.Duration
+
+func init() {
+	flag.DurationVar(&schedulerStateSaveInterval, "scheduler-state-save-interval", 30*time.Second,
+		"How often the resolver's scheduling snapshot is persisted, when persistSchedulerState is configured.")
+}
+
+// schedulerStateConfigMapKey is the Data key under which the resolver's
+// JSON-encoded SchedulerSnapshot is stored in its ConfigMap.
+const schedulerStateConfigMapKey = "scheduler-state.json"
+
+// loadSchedulerSnapshot reads a previously persisted SchedulerSnapshot from
+// the given ConfigMap using reader, which should be an uncached reader
+// (e.g. a manager's APIReader) since this runs before the manager's cache
+// has started. A missing ConfigMap or key isn't an error: it just means
+// there's nothing to restore yet, as on a fresh install.
+func loadSchedulerSnapshot(ctx context.Context, reader client.Reader, namespace, name string) (SchedulerSnapshot, error) {
+	var cm corev1.ConfigMap
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	raw, ok := cm.Data[schedulerStateConfigMapKey]
+	if !ok {
+		return nil, nil
+	}
+	var snapshot SchedulerSnapshot
+	if err := json.Unmarshal([]byte(raw), &snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// saveSchedulerSnapshot writes snapshot to the given ConfigMap, creating it
+// if it doesn't already exist.
+func saveSchedulerSnapshot(ctx context.Context, c client.Client, namespace, name string, snapshot SchedulerSnapshot) error {
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	var cm corev1.ConfigMap
+	err = c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &cm)
+	if apierrors.IsNotFound(err) {
+		cm = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       map[string]string{schedulerStateConfigMapKey: string(raw)},
+		}
+		return c.Create(ctx, &cm)
+	}
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[schedulerStateConfigMapKey] = string(raw)
+	return c.Update(ctx, &cm)
+}
+
+// runSchedulerStatePersistence periodically saves h's resolver scheduling
+// state to its configured ConfigMap until stopCh is closed, saving once
+// more on the way out on a best-effort basis.
+func (h *OCPDNSNameResolver) runSchedulerStatePersistence(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(schedulerStateSaveInterval)
+	defer ticker.Stop()
+
+	save := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), h.updateTimeout)
+		defer cancel()
+		if err := saveSchedulerSnapshot(ctx, h.client, h.schedulerStateNamespace, h.schedulerStateConfigMapName, h.resolver.Snapshot()); err != nil {
+			clog.Warningf("dnsnameresolver: failed to persist scheduler state to ConfigMap %s/%s: %v", h.schedulerStateNamespace, h.schedulerStateConfigMapName, err)
+		}
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			save()
+			return
+		case <-ticker.C:
+			save()
+		}
+	}
+}
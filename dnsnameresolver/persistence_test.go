@@ -0,0 +1,97 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// TestSchedulerSnapshotRoundTripsThroughConfigMap verifies that a snapshot
+// saved with saveSchedulerSnapshot comes back unchanged from
+// loadSchedulerSnapshot, including when that requires creating the
+// ConfigMap versus updating an existing one.
+func TestSchedulerSnapshotRoundTripsThroughConfigMap(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().Build()
+	ctx := context.Background()
+
+	want := SchedulerSnapshot{
+		"example.com.": {
+			TTLSeconds:     30,
+			NextLookupTime: time.Unix(1700000000, 0).UTC(),
+		},
+		"*.example.org.": {
+			IsWildcard:     true,
+			TTLSeconds:     60,
+			NextLookupTime: time.Unix(1700000060, 0).UTC(),
+		},
+	}
+
+	if err := saveSchedulerSnapshot(ctx, fakeClient, "openshift-dns", "dnsnameresolver-scheduler-state", want); err != nil {
+		t.Fatalf("saveSchedulerSnapshot() (create) error = %v", err)
+	}
+
+	got, err := loadSchedulerSnapshot(ctx, fakeClient, "openshift-dns", "dnsnameresolver-scheduler-state")
+	if err != nil {
+		t.Fatalf("loadSchedulerSnapshot() error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("loadSchedulerSnapshot() = %+v, want %+v", got, want)
+	}
+	for dnsName, wantEntry := range want {
+		gotEntry, ok := got[dnsName]
+		if !ok || !gotEntry.NextLookupTime.Equal(wantEntry.NextLookupTime) || gotEntry.TTLSeconds != wantEntry.TTLSeconds || gotEntry.IsWildcard != wantEntry.IsWildcard {
+			t.Errorf("loadSchedulerSnapshot()[%q] = %+v, want %+v", dnsName, gotEntry, wantEntry)
+		}
+	}
+
+	// Saving again with the ConfigMap already present exercises the
+	// update path rather than create.
+	want["example.net."] = SchedulerSnapshotEntry{TTLSeconds: 5, NextLookupTime: time.Unix(1700000005, 0).UTC()}
+	if err := saveSchedulerSnapshot(ctx, fakeClient, "openshift-dns", "dnsnameresolver-scheduler-state", want); err != nil {
+		t.Fatalf("saveSchedulerSnapshot() (update) error = %v", err)
+	}
+	got, err = loadSchedulerSnapshot(ctx, fakeClient, "openshift-dns", "dnsnameresolver-scheduler-state")
+	if err != nil {
+		t.Fatalf("loadSchedulerSnapshot() after update error = %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("loadSchedulerSnapshot() after update = %+v, want %+v", got, want)
+	}
+}
+
+// TestLoadSchedulerSnapshotMissingConfigMapIsNotAnError verifies that a
+// fresh install, with no ConfigMap yet, restores cleanly rather than
+// failing setup.
+func TestLoadSchedulerSnapshotMissingConfigMapIsNotAnError(t *testing.T) {
+	fakeClient := fake.NewClientBuilder().Build()
+
+	got, err := loadSchedulerSnapshot(context.Background(), fakeClient, "openshift-dns", "dnsnameresolver-scheduler-state")
+	if err != nil {
+		t.Fatalf("loadSchedulerSnapshot() with no ConfigMap error = %v", err)
+	}
+	if got != nil {
+		t.Errorf("loadSchedulerSnapshot() with no ConfigMap = %+v, want nil", got)
+	}
+}
+
+// TestLoadSchedulerSnapshotMissingKeyIsNotAnError verifies that a
+// ConfigMap that exists but predates this feature (or was created by
+// something else) doesn't fail restore just because it lacks the
+// snapshot key.
+func TestLoadSchedulerSnapshotMissingKeyIsNotAnError(t *testing.T) {
+	cm := &corev1.ConfigMap{}
+	cm.Namespace = "openshift-dns"
+	cm.Name = "dnsnameresolver-scheduler-state"
+	fakeClient := fake.NewClientBuilder().WithObjects(cm).Build()
+
+	got, err := loadSchedulerSnapshot(context.Background(), fakeClient, "openshift-dns", "dnsnameresolver-scheduler-state")
+	if err != nil {
+		t.Fatalf("loadSchedulerSnapshot() with no snapshot key error = %v", err)
+	}
+	if got != nil {
+		t.Errorf("loadSchedulerSnapshot() with no snapshot key = %+v, want nil", got)
+	}
+}
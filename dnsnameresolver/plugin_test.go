@@ -0,0 +1,16 @@
+package dnsnameresolver
+
+import "testing"
+
+func TestNew(t *testing.T) {
+	h := New()
+	if h.updateTimeout != defaultUpdateTimeout {
+		t.Errorf("New() updateTimeout = %v, want %v", h.updateTimeout, defaultUpdateTimeout)
+	}
+	if h.objects == nil || h.byName == nil || h.wildcards == nil {
+		t.Errorf("New() left an object cache nil")
+	}
+	if h.Name() != "dnsnameresolver" {
+		t.Errorf("New() Name() = %q, want %q", h.Name(), "dnsnameresolver")
+	}
+}
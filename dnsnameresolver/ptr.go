@@ -0,0 +1,114 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/miekg/dns"
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ptrNamesAnnotation stores the reverse-lookup (PTR) name observed for
+// each address a DNSNameResolver object currently resolves to, as a JSON
+// object mapping IP to PTR name, when the trackPTR directive is enabled.
+// Like failureThresholdAnnotation, there's no first-class status field
+// for this: it's enrichment for firewall systems that key on reverse
+// DNS, not something the forward-resolution status type was designed to
+// carry.
+const ptrNamesAnnotation = "dnsnameresolver.openshift.io/ptr-names"
+
+// lookupPTRName issues a PTR query for ip against a CoreDNS instance
+// selected the same way lookupDNSNameFromCoreDNS is, and returns the
+// first PTR record's target. It's bounded by ctx's own deadline, not a
+// fresh timeout of its own, since recordPTRAnnotations already runs
+// outside any per-object lock and can afford to wait exactly as long as
+// its caller allows.
+func lookupPTRName(ctx context.Context, ip string) (string, error) {
+	reverse, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return "", err
+	}
+
+	server := fallbackDNSServer
+	if servers := getRandomCoreDNSPodIPs(); len(servers) > 0 {
+		server = servers[0]
+	}
+	if server == "" {
+		return "", fmt.Errorf("dnsnameresolver: no CoreDNS servers available to query")
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(reverse, dns.TypePTR)
+	msg.RecursionDesired = true
+
+	resp, _, err := newDNSExchanger().ExchangeContext(ctx, msg, server)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range resp.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok {
+			return ptr.Ptr, nil
+		}
+	}
+	return "", fmt.Errorf("dnsnameresolver: no PTR record in response for %s", ip)
+}
+
+// recordPTRAnnotations resolves the PTR name of every address currently
+// present in obj's status and stamps them onto obj as ptrNamesAnnotation,
+// via the same kind of metadata-only merge patch recordInstanceAnnotation
+// uses. A lookup failure for one address is logged and simply omitted
+// from the map rather than aborting the whole update: enrichment for the
+// other, successfully-resolved addresses shouldn't be held back by one
+// PTR query that timed out or came back empty. Callers run this after
+// releasing any per-object lock: the sequential PTR lookups below are
+// each a blocking network round trip, and holding a lock across them
+// would stall an unrelated concurrent update to the same object for as
+// long as this whole enrichment pass takes.
+func (h *OCPDNSNameResolver) recordPTRAnnotations(ctx context.Context, obj *networkv1alpha1.DNSNameResolver) error {
+	ips := make(map[string]struct{})
+	for _, name := range obj.Status.ResolvedNames {
+		for _, addr := range name.ResolvedAddresses {
+			ips[addr.IP] = struct{}{}
+		}
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+
+	sorted := make([]string, 0, len(ips))
+	for ip := range ips {
+		sorted = append(sorted, ip)
+	}
+	sort.Strings(sorted)
+
+	ptrNames := make(map[string]string, len(sorted))
+	for _, ip := range sorted {
+		name, err := lookupPTRName(ctx, ip)
+		if err != nil {
+			clog.Debugf("dnsnameresolver: PTR lookup for %s failed, omitting from %s: %v", ip, ptrNamesAnnotation, err)
+			continue
+		}
+		ptrNames[ip] = name
+	}
+	if len(ptrNames) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(ptrNames)
+	if err != nil {
+		return err
+	}
+
+	var p annotationPatch
+	p.Metadata.Annotations = map[string]string{ptrNamesAnnotation: string(data)}
+	patch, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return h.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, patch))
+}
@@ -0,0 +1,46 @@
+package dnsnameresolver
+
+import (
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// namespaceLimiters hands out a token-bucket rate limiter per namespace so
+// that a single namespace can't monopolize apiserver write capacity with a
+// burst of status updates. A zero qps disables limiting.
+type namespaceLimiters struct {
+	qps float64
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newNamespaceLimiters(qps float64) *namespaceLimiters {
+	return &namespaceLimiters{
+		qps:      qps,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// forNamespace returns the limiter for ns, creating it on first use. It
+// returns nil when rate limiting is disabled.
+func (n *namespaceLimiters) forNamespace(ns string) *rate.Limiter {
+	if n == nil || n.qps <= 0 {
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	l, ok := n.limiters[ns]
+	if !ok {
+		burst := int(n.qps)
+		if burst < 1 {
+			burst = 1
+		}
+		l = rate.NewLimiter(rate.Limit(n.qps), burst)
+		n.limiters[ns] = l
+	}
+	return l
+}
@@ -0,0 +1,49 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNamespaceLimitersThrottlesPerNamespace(t *testing.T) {
+	n := newNamespaceLimiters(10) // 10 QPS, burst 10
+
+	l := n.forNamespace("ns1")
+	// Drain the initial burst.
+	for i := 0; i < 10; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("unexpected error draining burst: %v", err)
+		}
+	}
+
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error waiting for a token: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the 11th update in a 10 QPS bucket to be deferred, got through after %v", elapsed)
+	}
+
+	// A different namespace should have its own, unthrottled bucket.
+	other := n.forNamespace("ns2")
+	start = time.Now()
+	if err := other.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Millisecond {
+		t.Errorf("expected ns2's first update to go through immediately, took %v", elapsed)
+	}
+}
+
+func TestNamespaceLimitersDisabled(t *testing.T) {
+	var n *namespaceLimiters
+	if l := n.forNamespace("ns1"); l != nil {
+		t.Fatalf("expected a nil limiter set to disable rate limiting, got %v", l)
+	}
+
+	n = newNamespaceLimiters(0)
+	if l := n.forNamespace("ns1"); l != nil {
+		t.Fatalf("expected qps=0 to disable rate limiting, got %v", l)
+	}
+}
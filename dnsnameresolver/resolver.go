@@ -0,0 +1,818 @@
+package dnsnameresolver
+
+import (
+	"container/heap"
+	"flag"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+)
+
+// initialLookupDelay is the maximum random delay applied before a newly
+// tracked name's first proactive lookup. During a mass-import of
+// DNSNameResolver objects, without it every new name would be looked up
+// immediately, which can hammer a CoreDNS upstream that's still warming
+// up. 0 (the default) disables the delay.
+var initialLookupDelay time.Duration
+
+// prewarmNames is a comma-separated list of DNS names to proactively
+// resolve on startup, ahead of any DNSNameResolver object referencing
+// them, so the CoreDNS cache is already warm once real objects show up.
+var prewarmNames string
+
+// maxTrackedNames caps how many distinct DNS names the resolver will
+// track for proactive lookup at once, so a misconfigured controller
+// creating an unbounded number of DNSNameResolver objects can't grow the
+// resolver's memory and lookup load without limit. 0 (the default) is
+// unlimited.
+var maxTrackedNames int
+
+// pauseResolverAtStartup starts the Resolver's scheduling loop already
+// paused, for operators who want to bring CoreDNS up (e.g. during a
+// maintenance window) without immediately issuing proactive lookups. It
+// can be resumed at runtime via Resolver.Resume without a restart.
+var pauseResolverAtStartup bool
+
+// startupRampDuration is the window, measured from Start, during which
+// Resolver.Start paces already-due lookups instead of dispatching every
+// one it finds in a single wakeup. Reconciling a fleet of existing
+// DNSNameResolver objects after a restart can hand the scheduler a
+// large batch of names whose TTLs already expired while this instance
+// was down; without a ramp, all of them fire in the same tick against a
+// CoreDNS upstream that may itself have just restarted. 0 (the default)
+// disables ramping.
+var startupRampDuration time.Duration
+
+// startupRampMaxBatch caps how many due lookups Start dispatches per
+// wakeup while still inside startupRampDuration; the rest are spread
+// evenly across the remainder of the ramp window instead. Only takes
+// effect when startupRampDuration is non-zero.
+var startupRampMaxBatch int
+
+// minNegativeCacheRetryInterval and maxNegativeCacheRetryInterval clamp
+// the retry interval lookupAndSchedule derives from a negative response's
+// SOA minimum TTL (see negativeCacheError), so a misconfigured or
+// malicious upstream can't use an SOA minimum of 0 to make the resolver
+// hammer it, or one of years to leave a failing name essentially
+// untracked.
+var minNegativeCacheRetryInterval time.Duration
+var maxNegativeCacheRetryInterval time.Duration
+
+// resolverDrainTimeout bounds how long graceful shutdown waits for
+// lookups Start already dispatched (see Resolver.Drain) to finish before
+// giving up and letting shutdown proceed anyway.
+var resolverDrainTimeout time.Duration
+
+func init() {
+	flag.DurationVar(&initialLookupDelay, "initial-lookup-delay", 0,
+		"Maximum random delay before a newly tracked name's first proactive lookup, to smooth startup during a mass-import.")
+	flag.StringVar(&prewarmNames, "prewarm-names", "",
+		"Comma-separated list of DNS names to proactively resolve at startup, before any DNSNameResolver object references them.")
+	flag.IntVar(&maxTrackedNames, "max-tracked-names", 0,
+		"Maximum number of distinct DNS names the resolver will track for proactive lookup. 0 means unlimited.")
+	flag.BoolVar(&pauseResolverAtStartup, "pause-resolver", false,
+		"Start the proactive resolver's scheduling loop paused, deferring lookups until Resume is called.")
+	flag.DurationVar(&startupRampDuration, "startup-ramp-duration", 0,
+		"Window after Start during which already-due lookups are paced rather than all dispatched at once. 0 disables ramping.")
+	flag.IntVar(&startupRampMaxBatch, "startup-ramp-max-batch", 20,
+		"Maximum number of due lookups dispatched per scheduler wakeup while inside --startup-ramp-duration.")
+	flag.DurationVar(&minNegativeCacheRetryInterval, "min-negative-cache-retry-interval", 5*time.Second,
+		"Lower bound clamp on the retry interval derived from a negative response's SOA minimum TTL.")
+	flag.DurationVar(&maxNegativeCacheRetryInterval, "max-negative-cache-retry-interval", time.Hour,
+		"Upper bound clamp on the retry interval derived from a negative response's SOA minimum TTL.")
+	flag.DurationVar(&resolverDrainTimeout, "resolver-drain-timeout", 5*time.Second,
+		"How long graceful shutdown waits for in-flight proactive lookups to finish before giving up and shutting down anyway.")
+}
+
+// clampNegativeCacheInterval clamps d to
+// [minNegativeCacheRetryInterval, maxNegativeCacheRetryInterval].
+func clampNegativeCacheInterval(d time.Duration) time.Duration {
+	if d < minNegativeCacheRetryInterval {
+		return minNegativeCacheRetryInterval
+	}
+	if d > maxNegativeCacheRetryInterval {
+		return maxNegativeCacheRetryInterval
+	}
+	return d
+}
+
+// parsePrewarmNames splits the --prewarm-names flag value into its
+// individual, non-empty names.
+func parsePrewarmNames() []string {
+	if prewarmNames == "" {
+		return nil
+	}
+	var names []string
+	for _, name := range strings.Split(prewarmNames, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// randInt63n is overridden in tests to make the delay deterministic.
+var randInt63n = rand.Int63n
+
+// randomInitialDelay returns a random duration in [0, initialLookupDelay),
+// or 0 if initialLookupDelay is disabled.
+func randomInitialDelay() time.Duration {
+	if initialLookupDelay <= 0 {
+		return 0
+	}
+	return time.Duration(randInt63n(int64(initialLookupDelay)))
+}
+
+// ipTTL records a single resolved address and the TTL it was observed
+// with.
+type ipTTL struct {
+	ip  string
+	ttl uint32
+}
+
+// object is the in-memory state ServeDNS's fast path keeps for a single
+// DNSNameResolver resource, indexed by exact or wildcard DNS name for
+// O(1) lookup against live query traffic.
+type object struct {
+	namespace  string
+	name       string
+	dnsName    string
+	isWildcard bool
+}
+
+func newObject(namespace, name, dnsName string, isWildcard bool) *object {
+	return &object{
+		namespace:  namespace,
+		name:       name,
+		dnsName:    dnsName,
+		isWildcard: isWildcard,
+	}
+}
+
+// defaultRetryInterval is how soon a failed proactive lookup is retried.
+const defaultRetryInterval = 30 * time.Second
+
+// schedulerChannelBufferSize bounds the added and deleted channels. Both
+// are pure wakeup signals that Start's loop reacts to by recomputing from
+// r.dnsNames and r.nextLookups rather than by consuming a payload, so a
+// full buffer can be drained non-blockingly: the informer handler moves
+// on (recorded via schedulerEventsDroppedTotal) and Start's next wakeup
+// still sees the up-to-date state.
+const schedulerChannelBufferSize = 16
+
+// dnsNameDetails is the scheduling state the Resolver keeps for one
+// tracked DNS name (regular or wildcard).
+type dnsNameDetails struct {
+	dnsName        string
+	isWildcard     bool
+	lastLookupTime time.Time
+	ttlSeconds     int32
+	nextLookupTime time.Time
+
+	// heapIndex is this entry's current position in Resolver.nextLookups,
+	// maintained by nextLookupHeap's Swap so Delete and lookupAndSchedule
+	// can update or remove this entry's place in the heap in O(log n)
+	// instead of searching for it.
+	heapIndex int
+}
+
+// nextLookupHeap is a container/heap.Interface ordering tracked DNS names
+// by nextLookupTime, so Resolver.getNextDNSNameDetails can find the
+// soonest-due name in O(1) and Add/Delete/lookupAndSchedule can maintain
+// that order in O(log n), instead of the O(n) scan a plain map alone
+// would require on every scheduler wakeup.
+type nextLookupHeap []*dnsNameDetails
+
+func (h nextLookupHeap) Len() int { return len(h) }
+
+func (h nextLookupHeap) Less(i, j int) bool {
+	return h[i].nextLookupTime.Before(h[j].nextLookupTime)
+}
+
+func (h nextLookupHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *nextLookupHeap) Push(x any) {
+	d := x.(*dnsNameDetails)
+	d.heapIndex = len(*h)
+	*h = append(*h, d)
+}
+
+func (h *nextLookupHeap) Pop() any {
+	old := *h
+	n := len(old)
+	d := old[n-1]
+	old[n-1] = nil
+	d.heapIndex = -1
+	*h = old[:n-1]
+	return d
+}
+
+// SchedulerSnapshotEntry is the persistable scheduling state for a single
+// tracked DNS name, as produced by Resolver.Snapshot and consumed by
+// Resolver.Restore.
+type SchedulerSnapshotEntry struct {
+	IsWildcard     bool
+	TTLSeconds     int32
+	NextLookupTime time.Time
+}
+
+// SchedulerSnapshot is a persistable copy of a Resolver's scheduling
+// state, keyed by DNS name.
+type SchedulerSnapshot map[string]SchedulerSnapshotEntry
+
+// Resolver proactively re-resolves the DNS names referenced by
+// DNSNameResolver objects ahead of TTL expiry, independent of live client
+// queries, by querying CoreDNS itself. It fans successful lookups back
+// out through onResolved.
+type Resolver struct {
+	mu sync.Mutex
+
+	// paused, while true, makes Start's loop defer issuing lookups: due
+	// dnsNameDetails keep their scheduled nextLookupTime rather than
+	// being reset, so resuming picks up exactly where pausing left off.
+	paused bool
+
+	dnsNames         map[string]*dnsNameDetails
+	nextLookups      nextLookupHeap                 // same *dnsNameDetails as dnsNames, ordered by nextLookupTime
+	namespaceDNSInfo map[string]map[string]struct{} // regular dnsName -> namespaces referencing it
+	wildcardDNSInfo  map[string]map[string]struct{} // wildcard dnsName -> namespaces referencing it
+
+	// restored holds a scheduling snapshot loaded via Restore, consulted
+	// by Add the first time each name in it is (re-)tracked, so a name
+	// that already had a well-known nextLookupTime before a restart
+	// doesn't get treated as brand new and looked up immediately. Entries
+	// are consumed (deleted) as they're applied.
+	restored SchedulerSnapshot
+
+	// deleted receives a dnsName once no namespace references it any
+	// longer. added is signalled whenever a new name might change the
+	// next wakeup time.
+	deleted chan string
+	added   chan struct{}
+
+	lookup     func(dnsName string) (map[string]ipTTL, time.Duration, error)
+	onResolved func(dnsName string, isWildcard bool, ipTTLs map[string]ipTTL)
+
+	// inFlight tracks every lookupAndSchedule goroutine dispatched by
+	// Start or by Add's own immediate lookup of a newly tracked name,
+	// that hasn't returned yet, so Drain can wait for them to finish
+	// instead of letting a graceful shutdown cut one off mid-lookup.
+	inFlight sync.WaitGroup
+}
+
+// NewResolver constructs a Resolver. lookup performs the actual DNS
+// query (normally lookupDNSNameFromCoreDNS); onResolved is invoked with
+// the addresses found by a successful lookup.
+func NewResolver(lookup func(string) (map[string]ipTTL, time.Duration, error), onResolved func(string, bool, map[string]ipTTL)) *Resolver {
+	return &Resolver{
+		dnsNames:         make(map[string]*dnsNameDetails),
+		nextLookups:      make(nextLookupHeap, 0),
+		namespaceDNSInfo: make(map[string]map[string]struct{}),
+		wildcardDNSInfo:  make(map[string]map[string]struct{}),
+		deleted:          make(chan string, schedulerChannelBufferSize),
+		added:            make(chan struct{}, schedulerChannelBufferSize),
+		lookup:           lookup,
+		onResolved:       onResolved,
+	}
+}
+
+// Restore seeds the resolver with a previously persisted scheduling
+// snapshot (see Snapshot), so that names re-added via Add after a restart
+// resume at their prior nextLookupTime instead of being treated as newly
+// tracked and looked up immediately. It must be called before any
+// reconcile events start calling Add, which in practice means before the
+// manager (and therefore the informers driving Add) is started.
+func (r *Resolver) Restore(snapshot SchedulerSnapshot) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.restored = snapshot
+}
+
+// Snapshot returns a persistable copy of the resolver's current
+// scheduling state, suitable for passing to Restore after a restart.
+func (r *Resolver) Snapshot() SchedulerSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snapshot := make(SchedulerSnapshot, len(r.dnsNames))
+	for dnsName, d := range r.dnsNames {
+		snapshot[dnsName] = SchedulerSnapshotEntry{
+			IsWildcard:     d.isWildcard,
+			TTLSeconds:     d.ttlSeconds,
+			NextLookupTime: d.nextLookupTime,
+		}
+	}
+	return snapshot
+}
+
+// Lookup performs an on-demand query using the Resolver's configured
+// lookup function, without tracking dnsName for proactive re-resolution.
+// It's used by callers, such as SRV-target following, that need a single
+// answer rather than ongoing scheduling.
+func (r *Resolver) Lookup(dnsName string) (map[string]ipTTL, time.Duration, error) {
+	return r.lookup(dnsName)
+}
+
+func (r *Resolver) infoFor(isWildcard bool) map[string]map[string]struct{} {
+	if isWildcard {
+		return r.wildcardDNSInfo
+	}
+	return r.namespaceDNSInfo
+}
+
+// Add records that namespace references dnsName, tracking it for
+// proactive lookups if it isn't already tracked, and triggers an
+// immediate lookup for newly tracked names. If dnsName isn't already
+// tracked and the resolver is already at its --max-tracked-names cap,
+// the name is rejected instead: it won't be proactively re-resolved, and
+// ServeDNS's own passive tracking of live query answers becomes the only
+// way it gets refreshed.
+func (r *Resolver) Add(namespace, dnsName string, isWildcard bool) {
+	r.mu.Lock()
+	_, alreadyTracked := r.dnsNames[dnsName]
+	if !alreadyTracked && maxTrackedNames > 0 && len(r.dnsNames) >= maxTrackedNames {
+		r.mu.Unlock()
+		trackedNamesRejectedTotal.Inc()
+		clog.Warningf("dnsnameresolver: rejecting %q: resolver is at its --max-tracked-names cap (%d)", dnsName, maxTrackedNames)
+		return
+	}
+
+	info := r.infoFor(isWildcard)
+	if _, ok := info[dnsName]; !ok {
+		info[dnsName] = make(map[string]struct{})
+	}
+	info[dnsName][namespace] = struct{}{}
+	nameFanout.WithLabelValues(dnsName).Set(float64(len(info[dnsName])))
+
+	var dueNow, fromRestore bool
+	if !alreadyTracked {
+		var d *dnsNameDetails
+		if restored, ok := r.restored[dnsName]; ok && restored.IsWildcard == isWildcard {
+			delete(r.restored, dnsName)
+			fromRestore = true
+			dueNow = !restored.NextLookupTime.After(time.Now())
+			d = &dnsNameDetails{
+				dnsName:        dnsName,
+				isWildcard:     isWildcard,
+				ttlSeconds:     restored.TTLSeconds,
+				nextLookupTime: restored.NextLookupTime,
+			}
+		} else {
+			dueNow = true
+			d = &dnsNameDetails{
+				dnsName:        dnsName,
+				isWildcard:     isWildcard,
+				nextLookupTime: time.Now(),
+			}
+		}
+		r.dnsNames[dnsName] = d
+		heap.Push(&r.nextLookups, d)
+		if dueNow {
+			// Claim this name's initial lookup the same way dueDNSNames
+			// claims a due name off the heap: bump nextLookupTime past
+			// now so Start's own scheduling loop can't also see this
+			// brand-new entry as due and dispatch a second, concurrent
+			// initial lookup for it before the goroutine below reports
+			// back with a real reschedule.
+			d.nextLookupTime = time.Now().Add(schedulerInFlightHold)
+			heap.Fix(&r.nextLookups, d.heapIndex)
+		}
+	}
+	r.mu.Unlock()
+
+	if !alreadyTracked && dueNow {
+		r.inFlight.Add(1)
+		go func() {
+			defer r.inFlight.Done()
+			// A name resuming from a snapshot that's already due is
+			// catching up after a restart, not a fresh mass-import, so
+			// it skips the smoothing delay applied to genuinely new
+			// names.
+			if !fromRestore {
+				if delay := randomInitialDelay(); delay > 0 {
+					time.Sleep(delay)
+				}
+			}
+			r.lookupAndSchedule(dnsName)
+		}()
+	}
+	if !alreadyTracked {
+		// Only a newly-tracked name changes the heap, so only that case
+		// needs to wake Start's timer loop. A relist re-announcing names
+		// that are already tracked (e.g. after an apiserver reconnect)
+		// touches only the fanout bookkeeping above and would otherwise
+		// send one signal per object; skipping the send here means a
+		// relist storm costs Start zero extra wakeups instead of one
+		// per object, on top of the buffered, coalescing send below
+		// already capping any burst that does go through.
+		select {
+		case r.added <- struct{}{}:
+		default:
+			schedulerEventsDroppedTotal.WithLabelValues("added").Inc()
+		}
+	}
+}
+
+// Prewarm seeds the resolver with dnsNames for proactive lookup even
+// though no DNSNameResolver object references them yet, so operators can
+// warm the CoreDNS cache ahead of a bulk import. Prewarmed names have no
+// referencing namespace, so onResolved finds no object to update status
+// on; only the lookup itself, and its effect on the CoreDNS cache, has
+// any observable result.
+func (r *Resolver) Prewarm(dnsNames []string) {
+	for _, dnsName := range dnsNames {
+		r.mu.Lock()
+		_, alreadyTracked := r.dnsNames[dnsName]
+		if !alreadyTracked {
+			d := &dnsNameDetails{
+				dnsName:        dnsName,
+				nextLookupTime: time.Now(),
+			}
+			r.dnsNames[dnsName] = d
+			heap.Push(&r.nextLookups, d)
+		}
+		r.mu.Unlock()
+
+		if !alreadyTracked {
+			go r.lookupAndSchedule(dnsName)
+		}
+	}
+	select {
+	case r.added <- struct{}{}:
+	default:
+		schedulerEventsDroppedTotal.WithLabelValues("added").Inc()
+	}
+}
+
+// Delete records that namespace no longer references dnsName. Once no
+// namespace references it, it stops being tracked and is sent on the
+// deleted channel.
+func (r *Resolver) Delete(namespace, dnsName string, isWildcard bool) {
+	r.mu.Lock()
+	info := r.infoFor(isWildcard)
+	untracked := false
+	if nsSet, ok := info[dnsName]; ok {
+		delete(nsSet, namespace)
+		if len(nsSet) == 0 {
+			delete(info, dnsName)
+			untracked = true
+		} else {
+			nameFanout.WithLabelValues(dnsName).Set(float64(len(nsSet)))
+		}
+	}
+	if untracked {
+		if d, ok := r.dnsNames[dnsName]; ok {
+			heap.Remove(&r.nextLookups, d.heapIndex)
+		}
+		delete(r.dnsNames, dnsName)
+	}
+	r.mu.Unlock()
+
+	if untracked {
+		nameFanout.DeleteLabelValues(dnsName)
+		select {
+		case r.deleted <- dnsName:
+		default:
+			// Start's loop isn't consuming (not running yet, already
+			// stopped, or the buffer is saturated by a delete burst).
+			// dnsName is already untracked above, so dropping this
+			// notification only costs Start an unnecessary wakeup on
+			// its next timer tick, not correctness.
+			schedulerEventsDroppedTotal.WithLabelValues("deleted").Inc()
+		}
+	}
+}
+
+// minSchedulerReset floors the duration Start's timer is reset to. Without
+// it, a name already due (or several becoming due within the same
+// instant) would reset the timer to zero, firing again almost
+// immediately; dueDNSNames below drains every currently-due name in one
+// wakeup, but the floor still matters to keep Start from spinning between
+// a wakeup that found nothing new due and the next one.
+const minSchedulerReset = 10 * time.Millisecond
+
+// getNextDNSNameDetails returns the tracked name with the soonest
+// nextLookupTime and how long to wait before it's due, by peeking at the
+// root of r.nextLookups rather than scanning r.dnsNames. Callers must hold
+// r.mu.
+func (r *Resolver) getNextDNSNameDetails() (*dnsNameDetails, time.Duration) {
+	if len(r.nextLookups) == 0 {
+		return nil, time.Hour
+	}
+	next := r.nextLookups[0]
+	wait := time.Until(next.nextLookupTime)
+	if wait < minSchedulerReset {
+		wait = minSchedulerReset
+	}
+	return next, wait
+}
+
+// schedulerInFlightHold is the placeholder nextLookupTime dueDNSNames
+// gives a name it just handed to Start for lookup, so that same name
+// can't be selected again on a subsequent wakeup before lookupAndSchedule
+// reports back with its real reschedule. Its exact value isn't
+// load-bearing beyond "comfortably longer than a single lookup can take".
+const schedulerInFlightHold = time.Minute
+
+// dueDNSNames drains every tracked name whose nextLookupTime is at or
+// before now off the top of r.nextLookups, so Start can dispatch a batch
+// of simultaneously-expired names from a single wakeup instead of ticking
+// once per name. Each drained entry's nextLookupTime is bumped forward by
+// schedulerInFlightHold (see above) rather than removed from the heap, so
+// it still counts toward the next wakeup computed by
+// getNextDNSNameDetails once its actual lookup completes and reschedules
+// it for real.
+func (r *Resolver) dueDNSNames(now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []string
+	for len(r.nextLookups) > 0 && !r.nextLookups[0].nextLookupTime.After(now) {
+		d := r.nextLookups[0]
+		due = append(due, d.dnsName)
+		d.nextLookupTime = now.Add(schedulerInFlightHold)
+		heap.Fix(&r.nextLookups, d.heapIndex)
+	}
+	return due
+}
+
+// lookupAndSchedule performs a single lookup of dnsName and reschedules
+// its next lookup based on the result.
+func (r *Resolver) lookupAndSchedule(dnsName string) {
+	ipTTLs, _, err := r.lookup(dnsName)
+
+	r.mu.Lock()
+	d, ok := r.dnsNames[dnsName]
+	if !ok {
+		r.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	d.lastLookupTime = now
+	if err == nil {
+		d.ttlSeconds = minTTLSeconds(ipTTLs)
+		d.nextLookupTime = now.Add(time.Duration(d.ttlSeconds) * time.Second)
+	} else if negErr, ok := err.(*negativeCacheError); ok {
+		// A negative response (NXDOMAIN/NODATA) carrying an SOA in its
+		// authority section tells us exactly how long the upstream wants
+		// that answer treated as valid; honor it, clamped to sane bounds,
+		// instead of always falling back to defaultRetryInterval.
+		d.nextLookupTime = now.Add(clampNegativeCacheInterval(time.Duration(negErr.minTTL) * time.Second))
+	} else {
+		d.nextLookupTime = now.Add(defaultRetryInterval)
+	}
+	heap.Fix(&r.nextLookups, d.heapIndex)
+	isWildcard := d.isWildcard
+	r.mu.Unlock()
+
+	if err == nil && r.onResolved != nil {
+		r.onResolved(dnsName, isWildcard, ipTTLs)
+	}
+}
+
+// ObserveTTL brings a tracked wildcard's own scheduled refresh forward to
+// no later than ttlSeconds from now, if that's sooner than what's
+// currently scheduled. It's how wildcardGroupRefresh ties a wildcard's
+// single proactive refresh cycle to the shortest TTL observed among the
+// subdomains matched against it in live traffic, rather than leaving it
+// solely at the mercy of the wildcard's own literal-pattern lookup
+// (which many zones never answer, since "*.example.com." itself is
+// rarely a real record). dnsName not being tracked, or not being a
+// wildcard, is a no-op: this is purely an optimization on top of the
+// existing schedule, never a way to newly track a name.
+func (r *Resolver) ObserveTTL(dnsName string, ttlSeconds int32) {
+	if ttlSeconds <= 0 {
+		return
+	}
+	r.mu.Lock()
+	d, ok := r.dnsNames[dnsName]
+	brought := false
+	if ok && d.isWildcard {
+		if candidate := time.Now().Add(time.Duration(ttlSeconds) * time.Second); candidate.Before(d.nextLookupTime) {
+			d.nextLookupTime = candidate
+			heap.Fix(&r.nextLookups, d.heapIndex)
+			brought = true
+		}
+	}
+	r.mu.Unlock()
+
+	if brought {
+		select {
+		case r.added <- struct{}{}:
+		default:
+			schedulerEventsDroppedTotal.WithLabelValues("added").Inc()
+		}
+	}
+}
+
+// ScheduleNow brings dnsName's next proactive lookup forward to now, if
+// it's tracked and not already due sooner. It's used to force a
+// corrective re-resolution outside the normal TTL-driven schedule, e.g.
+// when a reconcile notices a DNSNameResolver's status was changed by
+// something other than this plugin. dnsName not being tracked is a
+// no-op: it reports false and there's nothing to bring forward.
+func (r *Resolver) ScheduleNow(dnsName string) bool {
+	r.mu.Lock()
+	d, ok := r.dnsNames[dnsName]
+	brought := false
+	if ok {
+		now := time.Now()
+		if now.Before(d.nextLookupTime) {
+			d.nextLookupTime = now
+			heap.Fix(&r.nextLookups, d.heapIndex)
+			brought = true
+		}
+	}
+	r.mu.Unlock()
+
+	if brought {
+		select {
+		case r.added <- struct{}{}:
+		default:
+			schedulerEventsDroppedTotal.WithLabelValues("added").Inc()
+		}
+	}
+	return ok
+}
+
+// Pause makes Start's loop stop issuing lookups until Resume is called.
+// Names already due for a lookup, or that become due while paused, stay
+// due: nothing about their schedule changes, so resuming immediately
+// catches up rather than losing track of them.
+func (r *Resolver) Pause() {
+	r.mu.Lock()
+	r.paused = true
+	r.mu.Unlock()
+}
+
+// Resume undoes Pause and wakes Start's loop so it re-evaluates the
+// schedule immediately instead of waiting for its next event.
+func (r *Resolver) Resume() {
+	r.mu.Lock()
+	r.paused = false
+	r.mu.Unlock()
+	select {
+	case r.added <- struct{}{}:
+	default:
+		schedulerEventsDroppedTotal.WithLabelValues("added").Inc()
+	}
+}
+
+// Drain waits for every lookup Start has already dispatched to finish,
+// e.g. so a graceful shutdown doesn't cut a still-running proactive
+// lookup short. Callers close stopCh before calling Drain, so Start's
+// loop has already stopped issuing new lookups by the time this waits.
+// It reports whether every lookup finished before timeout elapsed; on
+// false, shutdown proceeds anyway with some lookups still in flight.
+func (r *Resolver) Drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		r.inFlight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Start runs the scheduling loop until stopCh is closed.
+func (r *Resolver) Start(stopCh <-chan struct{}) {
+	startedAt := time.Now()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		r.mu.Lock()
+		paused := r.paused
+		next, wait := r.getNextDNSNameDetails()
+		r.mu.Unlock()
+
+		// recordWakeup accounts for every event below that actually
+		// wakes this loop (everything except stopCh, which ends it
+		// instead), and separately counts wakeups taken while no name
+		// is tracked at all (next == nil). A wakeup with tracked names
+		// none of which is due yet is not counted as empty.
+		recordWakeup := func() {
+			schedulerWakeupsTotal.Inc()
+			if next == nil {
+				schedulerEmptyWakeupsTotal.Inc()
+			}
+		}
+
+		if paused {
+			// Lookups are deferred entirely; block for a state change
+			// rather than spinning on a timer for names that are
+			// already (or become) due.
+			select {
+			case <-stopCh:
+				return
+			case <-r.added:
+				recordWakeup()
+			case <-r.deleted:
+				recordWakeup()
+			}
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-stopCh:
+			return
+		case <-r.added:
+			recordWakeup()
+			continue
+		case <-r.deleted:
+			recordWakeup()
+			continue
+		case <-timer.C:
+			recordWakeup()
+			due := r.dueDNSNames(time.Now())
+			if startupRampDuration > 0 {
+				if remaining := startupRampDuration - time.Since(startedAt); remaining > 0 {
+					due = r.deferStartupRampOverflow(due, remaining)
+				}
+			}
+			for _, dnsName := range due {
+				r.inFlight.Add(1)
+				go func(dnsName string) {
+					defer r.inFlight.Done()
+					r.lookupAndSchedule(dnsName)
+				}(dnsName)
+			}
+		}
+	}
+}
+
+// deferStartupRampOverflow, while still inside the startup ramp window,
+// caps due to at most startupRampMaxBatch names for immediate dispatch,
+// pushing the rest's nextLookupTime out to evenly-spaced points across
+// remaining (the time left in the ramp window) instead of returning them
+// for dispatch now. dueDNSNames has already bumped every entry in due to
+// schedulerInFlightHold; deferred entries get a real, staggered
+// nextLookupTime instead so they come due spread out rather than all at
+// once when the hold expires.
+func (r *Resolver) deferStartupRampOverflow(due []string, remaining time.Duration) []string {
+	if len(due) <= startupRampMaxBatch {
+		return due
+	}
+	immediate, deferred := due[:startupRampMaxBatch], due[startupRampMaxBatch:]
+
+	step := remaining / time.Duration(len(deferred)+1)
+	if step <= 0 {
+		step = time.Second
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for i, dnsName := range deferred {
+		d, ok := r.dnsNames[dnsName]
+		if !ok {
+			continue
+		}
+		d.nextLookupTime = now.Add(step * time.Duration(i+1))
+		heap.Fix(&r.nextLookups, d.heapIndex)
+	}
+	return immediate
+}
+
+// minTTLSeconds returns the smallest TTL among ipTTLs, or
+// defaultRetryInterval's equivalent in seconds if there are none. A TTL
+// large enough to overflow int32 when cast (ttl is a uint32, per the DNS
+// wire format) is clamped to 0 rather than wrapping negative, so a
+// pathological upstream answer can't push nextLookupTime far into the
+// past and destabilize the scheduler.
+func minTTLSeconds(ipTTLs map[string]ipTTL) int32 {
+	min := int32(-1)
+	for _, it := range ipTTLs {
+		ttl := int32(it.ttl)
+		if ttl < 0 {
+			ttl = 0
+		}
+		if min == -1 || ttl < min {
+			min = ttl
+		}
+	}
+	if min == -1 {
+		return int32(defaultRetryInterval / time.Second)
+	}
+	return min
+}
@@ -0,0 +1,87 @@
+package dnsnameresolver
+
+import (
+	"container/heap"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// linearNextDNSNameDetails is the O(n) scan getNextDNSNameDetails used
+// before it was backed by the nextLookups heap, kept here only as a
+// benchmark baseline to demonstrate the heap's improvement at scale.
+func linearNextDNSNameDetails(dnsNames map[string]*dnsNameDetails) *dnsNameDetails {
+	var next *dnsNameDetails
+	for _, d := range dnsNames {
+		if next == nil || d.nextLookupTime.Before(next.nextLookupTime) {
+			next = d
+		}
+	}
+	return next
+}
+
+func benchmarkResolvers(b *testing.B, n int) (map[string]*dnsNameDetails, nextLookupHeap) {
+	b.Helper()
+	dnsNames := make(map[string]*dnsNameDetails, n)
+	names := make(nextLookupHeap, 0, n)
+	base := time.Now()
+	for i := 0; i < n; i++ {
+		d := &dnsNameDetails{
+			dnsName:        fmt.Sprintf("name-%d.example.com.", i),
+			nextLookupTime: base.Add(time.Duration(i) * time.Second),
+		}
+		dnsNames[d.dnsName] = d
+		names = append(names, d)
+	}
+	heap.Init(&names)
+	return dnsNames, names
+}
+
+// BenchmarkGetNextDNSNameDetailsLinear measures the O(n) scan this
+// resolver used before the nextLookups heap was introduced, as a
+// baseline for BenchmarkGetNextDNSNameDetailsHeap.
+func BenchmarkGetNextDNSNameDetailsLinear(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			dnsNames, _ := benchmarkResolvers(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = linearNextDNSNameDetails(dnsNames)
+			}
+		})
+	}
+}
+
+// BenchmarkGetNextDNSNameDetailsHeap measures Resolver.getNextDNSNameDetails
+// as it's actually implemented, peeking at the root of the nextLookups
+// heap instead of scanning every tracked name.
+func BenchmarkGetNextDNSNameDetailsHeap(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			_, names := benchmarkResolvers(b, n)
+			r := &Resolver{dnsNames: make(map[string]*dnsNameDetails), nextLookups: names}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.getNextDNSNameDetails()
+			}
+		})
+	}
+}
+
+// BenchmarkLookupAndScheduleReschedule measures how expensive rescheduling
+// a single name is once it resolves, i.e. heap.Fix's O(log n) cost against
+// the rest of the tracked set.
+func BenchmarkLookupAndScheduleReschedule(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000, 100000} {
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			dnsNames, names := benchmarkResolvers(b, n)
+			r := &Resolver{dnsNames: dnsNames, nextLookups: names}
+			d := names[0]
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				d.nextLookupTime = time.Now().Add(time.Duration(i) * time.Millisecond)
+				heap.Fix(&r.nextLookups, d.heapIndex)
+			}
+		})
+	}
+}
@@ -0,0 +1,1364 @@
+package dnsnameresolver
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func readGauge(t *testing.T, dnsName string) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := nameFanout.WithLabelValues(dnsName).Write(&m); err != nil {
+		t.Fatalf("failed to read name_fanout gauge: %v", err)
+	}
+	return m.GetGauge().GetValue()
+}
+
+func readHistogramSampleCount(t *testing.T, recordType string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := upstreamRTT.WithLabelValues(recordType).Write(&m); err != nil {
+		t.Fatalf("failed to read upstream_rtt_seconds histogram: %v", err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// fakeExchanger is a dnsExchanger that returns a fixed rtt and answer
+// without touching the network.
+type fakeExchanger struct {
+	rtt time.Duration
+}
+
+func (f fakeExchanger) Exchange(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	resp := new(dns.Msg)
+	resp.SetReply(m)
+	return resp, f.rtt, nil
+}
+
+func (f fakeExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	return f.Exchange(m, address)
+}
+
+func TestSendDNSLookupRequestRecordsUpstreamRTT(t *testing.T) {
+	beforeA := readHistogramSampleCount(t, "A")
+	beforeAAAA := readHistogramSampleCount(t, "AAAA")
+
+	if _, _, err := sendDNSLookupRequest(fakeExchanger{rtt: 25 * time.Millisecond}, "127.0.0.1:53", "example.com."); err != nil {
+		t.Fatalf("sendDNSLookupRequest() error = %v", err)
+	}
+
+	if got := readHistogramSampleCount(t, "A"); got != beforeA+1 {
+		t.Errorf("upstream_rtt_seconds{record_type=\"A\"} sample count = %d, want %d", got, beforeA+1)
+	}
+	if got := readHistogramSampleCount(t, "AAAA"); got != beforeAAAA+1 {
+		t.Errorf("upstream_rtt_seconds{record_type=\"AAAA\"} sample count = %d, want %d", got, beforeAAAA+1)
+	}
+}
+
+// classifyCacheOutcome is exercised directly against synthetic RTTs, rather
+// than through sendDNSLookupRequest, since it's a pure function of rtt and
+// cacheHitRTTThreshold with no network or state to fake.
+func TestClassifyCacheOutcome(t *testing.T) {
+	old := cacheHitRTTThreshold
+	defer func() { cacheHitRTTThreshold = old }()
+	cacheHitRTTThreshold = 2 * time.Millisecond
+
+	if got := classifyCacheOutcome(1 * time.Millisecond); got != "hit" {
+		t.Errorf("classifyCacheOutcome(1ms) = %q, want %q", got, "hit")
+	}
+	if got := classifyCacheOutcome(5 * time.Millisecond); got != "miss" {
+		t.Errorf("classifyCacheOutcome(5ms) = %q, want %q", got, "miss")
+	}
+	if got := classifyCacheOutcome(cacheHitRTTThreshold); got != "miss" {
+		t.Errorf("classifyCacheOutcome(threshold) = %q, want %q, threshold itself should count as a miss", got, "miss")
+	}
+}
+
+func TestSendDNSLookupRequestRecordsCacheHitOrMiss(t *testing.T) {
+	old := cacheHitRTTThreshold
+	defer func() { cacheHitRTTThreshold = old }()
+	cacheHitRTTThreshold = 2 * time.Millisecond
+
+	beforeHits := readCounter(t, coreDNSCacheHitsTotal)
+	beforeMisses := readCounter(t, coreDNSCacheMissesTotal)
+
+	if _, _, err := sendDNSLookupRequest(fakeExchanger{rtt: 1 * time.Millisecond}, "127.0.0.1:53", "example.com."); err != nil {
+		t.Fatalf("sendDNSLookupRequest() error = %v", err)
+	}
+	// One A and one AAAA query, both classified as hits at this rtt.
+	if got := readCounter(t, coreDNSCacheHitsTotal); got != beforeHits+2 {
+		t.Errorf("coredns_cache_hits_total = %v, want %v", got, beforeHits+2)
+	}
+	if got := readCounter(t, coreDNSCacheMissesTotal); got != beforeMisses {
+		t.Errorf("coredns_cache_misses_total = %v, want unchanged at %v", got, beforeMisses)
+	}
+
+	if _, _, err := sendDNSLookupRequest(fakeExchanger{rtt: 25 * time.Millisecond}, "127.0.0.1:53", "example.com."); err != nil {
+		t.Fatalf("sendDNSLookupRequest() error = %v", err)
+	}
+	if got := readCounter(t, coreDNSCacheMissesTotal); got != beforeMisses+2 {
+		t.Errorf("coredns_cache_misses_total = %v, want %v", got, beforeMisses+2)
+	}
+}
+
+// TestLookupPTRNameReturnsPTRTarget verifies that lookupPTRName builds a
+// correct reverse-lookup query and extracts the PTR record's target from
+// a fake server's response, without a real network round trip.
+func TestLookupPTRNameReturnsPTRTarget(t *testing.T) {
+	oldPodIPs, oldExchanger := getRandomCoreDNSPodIPs, newDNSExchanger
+	defer func() { getRandomCoreDNSPodIPs, newDNSExchanger = oldPodIPs, oldExchanger }()
+
+	getRandomCoreDNSPodIPs = func() []string { return []string{"127.0.0.1:53"} }
+
+	var gotQuestion string
+	newDNSExchanger = func() dnsExchanger {
+		return fakeExchangerFunc(func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+			gotQuestion = m.Question[0].Name
+			resp := new(dns.Msg)
+			resp.SetReply(m)
+			resp.Answer = append(resp.Answer, &dns.PTR{
+				Hdr: dns.RR_Header{Name: m.Question[0].Name, Rrtype: dns.TypePTR, Class: dns.ClassINET},
+				Ptr: "web.example.com.",
+			})
+			return resp, time.Millisecond, nil
+		})
+	}
+
+	got, err := lookupPTRName(context.Background(), "10.0.0.1")
+	if err != nil {
+		t.Fatalf("lookupPTRName() error = %v", err)
+	}
+	if got != "web.example.com." {
+		t.Errorf("lookupPTRName() = %q, want %q", got, "web.example.com.")
+	}
+	if want := "1.0.0.10.in-addr.arpa."; gotQuestion != want {
+		t.Errorf("lookupPTRName() queried %q, want %q", gotQuestion, want)
+	}
+}
+
+// TestLookupPTRNameErrorsWithoutPTRAnswer verifies that lookupPTRName
+// reports an error, rather than an empty name, when the response has no
+// PTR record.
+func TestLookupPTRNameErrorsWithoutPTRAnswer(t *testing.T) {
+	oldPodIPs, oldExchanger := getRandomCoreDNSPodIPs, newDNSExchanger
+	defer func() { getRandomCoreDNSPodIPs, newDNSExchanger = oldPodIPs, oldExchanger }()
+
+	getRandomCoreDNSPodIPs = func() []string { return []string{"127.0.0.1:53"} }
+	newDNSExchanger = func() dnsExchanger {
+		return fakeExchangerFunc(func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+			resp := new(dns.Msg)
+			resp.SetReply(m)
+			return resp, time.Millisecond, nil
+		})
+	}
+
+	if _, err := lookupPTRName(context.Background(), "10.0.0.1"); err == nil {
+		t.Error("lookupPTRName() with no PTR answer = nil error, want an error")
+	}
+}
+
+// soaAnswerHandler is a dnsExchanger that answers every query with an
+// empty answer section and an SOA record in the authority section, as a
+// real upstream does for NXDOMAIN/NODATA.
+type soaAnswerHandler struct {
+	minTTL uint32
+}
+
+func (s soaAnswerHandler) Exchange(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	resp := new(dns.Msg)
+	resp.SetReply(m)
+	resp.Ns = append(resp.Ns, &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+		Ns:     "ns1.example.com.",
+		Mbox:   "hostmaster.example.com.",
+		Minttl: s.minTTL,
+	})
+	return resp, time.Millisecond, nil
+}
+
+func (s soaAnswerHandler) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	return s.Exchange(m, address)
+}
+
+// TestSendDNSLookupRequestReturnsSOAMinimumOnNegativeResponse verifies
+// that a negative response carrying an SOA record surfaces its minimum
+// TTL via a *negativeCacheError, rather than the plain error
+// lookupAndSchedule would otherwise fall back to defaultRetryInterval for.
+func TestSendDNSLookupRequestReturnsSOAMinimumOnNegativeResponse(t *testing.T) {
+	_, _, err := sendDNSLookupRequest(soaAnswerHandler{minTTL: 120}, "127.0.0.1:53", "example.com.")
+	if err == nil {
+		t.Fatal("sendDNSLookupRequest() error = nil, want a negativeCacheError for a negative response")
+	}
+	negErr, ok := err.(*negativeCacheError)
+	if !ok {
+		t.Fatalf("sendDNSLookupRequest() error = %T, want *negativeCacheError", err)
+	}
+	if negErr.minTTL != 120 {
+		t.Errorf("negativeCacheError.minTTL = %d, want 120", negErr.minTTL)
+	}
+}
+
+// TestLookupAndScheduleUsesSOAMinimumForRetry verifies that
+// lookupAndSchedule schedules a failing name's next lookup using the
+// negative response's (clamped) SOA minimum TTL, instead of always
+// falling back to defaultRetryInterval.
+func TestLookupAndScheduleUsesSOAMinimumForRetry(t *testing.T) {
+	oldMin, oldMax := minNegativeCacheRetryInterval, maxNegativeCacheRetryInterval
+	defer func() { minNegativeCacheRetryInterval, maxNegativeCacheRetryInterval = oldMin, oldMax }()
+	minNegativeCacheRetryInterval = time.Second
+	maxNegativeCacheRetryInterval = time.Hour
+
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return sendDNSLookupRequest(soaAnswerHandler{minTTL: 90}, "127.0.0.1:53", dnsName)
+	}, nil)
+
+	r.Add("ns1", "example.com.", false)
+	r.mu.Lock()
+	d := r.dnsNames["example.com."]
+	r.mu.Unlock()
+	if d == nil {
+		t.Fatal("example.com. not tracked after Add")
+	}
+
+	r.lookupAndSchedule("example.com.")
+
+	r.mu.Lock()
+	next := d.nextLookupTime
+	r.mu.Unlock()
+
+	if got := time.Until(next); got < 80*time.Second || got > 100*time.Second {
+		t.Errorf("nextLookupTime is %v from now, want close to the SOA minimum of 90s", got)
+	}
+}
+
+// TestLookupAndScheduleClampsSOAMinimumForRetry verifies that an SOA
+// minimum outside [minNegativeCacheRetryInterval,
+// maxNegativeCacheRetryInterval] gets clamped rather than honored as-is.
+func TestLookupAndScheduleClampsSOAMinimumForRetry(t *testing.T) {
+	oldMin, oldMax := minNegativeCacheRetryInterval, maxNegativeCacheRetryInterval
+	defer func() { minNegativeCacheRetryInterval, maxNegativeCacheRetryInterval = oldMin, oldMax }()
+	minNegativeCacheRetryInterval = 30 * time.Second
+	maxNegativeCacheRetryInterval = time.Minute
+
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return sendDNSLookupRequest(soaAnswerHandler{minTTL: 0}, "127.0.0.1:53", dnsName)
+	}, nil)
+
+	r.Add("ns1", "example.com.", false)
+	r.lookupAndSchedule("example.com.")
+
+	r.mu.Lock()
+	next := r.dnsNames["example.com."].nextLookupTime
+	r.mu.Unlock()
+
+	if got := time.Until(next); got < 25*time.Second || got > 35*time.Second {
+		t.Errorf("nextLookupTime is %v from now, want clamped close to the 30s floor", got)
+	}
+}
+
+func TestResolverNameFanoutMetric(t *testing.T) {
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return nil, 0, nil
+	}, nil)
+
+	r.Add("ns1", "example.com.", false)
+	if got := readGauge(t, "example.com."); got != 1 {
+		t.Fatalf("name_fanout after one Add = %v, want 1", got)
+	}
+
+	r.Add("ns2", "example.com.", false)
+	if got := readGauge(t, "example.com."); got != 2 {
+		t.Fatalf("name_fanout after two Adds = %v, want 2", got)
+	}
+
+	r.Delete("ns1", "example.com.", false)
+	if got := readGauge(t, "example.com."); got != 1 {
+		t.Fatalf("name_fanout after one Delete = %v, want 1", got)
+	}
+
+	// Untracking the last namespace sends on r.deleted; the channel is
+	// buffered, so this doesn't need a consumer to complete.
+	r.Delete("ns2", "example.com.", false)
+	if got := readGauge(t, "example.com."); got != 0 {
+		t.Fatalf("name_fanout after all namespaces deleted = %v, want 0 (metric removed)", got)
+	}
+}
+
+func TestDeleteReturnsWithoutScheduler(t *testing.T) {
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return nil, 0, nil
+	}, nil)
+	r.Add("ns1", "example.com.", false)
+
+	done := make(chan struct{})
+	go func() {
+		// Nothing reads r.deleted here: Start's loop isn't running.
+		r.Delete("ns1", "example.com.", false)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Delete blocked indefinitely with no scheduler consuming r.deleted")
+	}
+}
+
+func TestMinTTLSecondsClampsOverflowingTTL(t *testing.T) {
+	// math.MaxInt32+1, well within uint32's range but negative once cast
+	// to int32.
+	const hugeTTL = uint32(1) << 31
+	got := minTTLSeconds(map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: hugeTTL}})
+	if got != 0 {
+		t.Fatalf("minTTLSeconds() with an overflowing TTL = %d, want 0", got)
+	}
+}
+
+func TestResolverPrewarmSchedulesNames(t *testing.T) {
+	lookedUp := make(chan string, 2)
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookedUp <- dnsName
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, 0, nil
+	}, nil)
+
+	r.Prewarm([]string{"example.com.", "example.org."})
+
+	r.mu.Lock()
+	_, hasCom := r.dnsNames["example.com."]
+	_, hasOrg := r.dnsNames["example.org."]
+	r.mu.Unlock()
+	if !hasCom || !hasOrg {
+		t.Fatalf("Prewarm didn't add both names to the schedule: dnsNames = %v", r.dnsNames)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case name := <-lookedUp:
+			seen[name] = true
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for Prewarm to trigger lookups")
+		}
+	}
+	if !seen["example.com."] || !seen["example.org."] {
+		t.Fatalf("Prewarm didn't trigger a lookup for both names, saw %v", seen)
+	}
+}
+
+func TestParsePrewarmNames(t *testing.T) {
+	old := prewarmNames
+	defer func() { prewarmNames = old }()
+
+	prewarmNames = ""
+	if got := parsePrewarmNames(); got != nil {
+		t.Errorf("parsePrewarmNames() with flag unset = %v, want nil", got)
+	}
+
+	prewarmNames = "example.com., example.org. ,,example.net."
+	want := []string{"example.com.", "example.org.", "example.net."}
+	got := parsePrewarmNames()
+	if len(got) != len(want) {
+		t.Fatalf("parsePrewarmNames() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("parsePrewarmNames() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestNewDNSClientBindsSourceAddress(t *testing.T) {
+	old := dnsSourceAddress
+	defer func() { dnsSourceAddress = old }()
+
+	dnsSourceAddress = ""
+	if c := newDNSClient(); c.Dialer != nil {
+		t.Errorf("newDNSClient() with no source address set Dialer = %v, want nil", c.Dialer)
+	}
+
+	dnsSourceAddress = "10.1.2.3"
+	c := newDNSClient()
+	if c.Dialer == nil {
+		t.Fatal("newDNSClient() with a source address left Dialer nil")
+	}
+	udpAddr, ok := c.Dialer.LocalAddr.(*net.UDPAddr)
+	if !ok || !udpAddr.IP.Equal(net.ParseIP("10.1.2.3")) {
+		t.Errorf("newDNSClient() Dialer.LocalAddr = %v, want UDP addr 10.1.2.3", c.Dialer.LocalAddr)
+	}
+
+	dnsSourceAddress = "not-an-ip"
+	if c := newDNSClient(); c.Dialer != nil {
+		t.Errorf("newDNSClient() with an invalid source address set Dialer = %v, want nil", c.Dialer)
+	}
+}
+
+// cookieRequiringExchanger simulates an upstream that rejects a query
+// with no or stale cookie (BADCOOKIE) and otherwise issues a fresh
+// server cookie, exercising the per-server cookie state in cookieJar.
+type cookieRequiringExchanger struct {
+	serverCookie string
+}
+
+func (e *cookieRequiringExchanger) Exchange(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	resp := new(dns.Msg)
+	resp.SetReply(m)
+
+	opt := m.IsEdns0()
+	var clientCookie string
+	var gotServerCookie string
+	if opt != nil {
+		for _, o := range opt.Option {
+			if c, ok := o.(*dns.EDNS0_COOKIE); ok {
+				if len(c.Cookie) >= 16 {
+					clientCookie = c.Cookie[:16]
+				}
+				if len(c.Cookie) > 16 {
+					gotServerCookie = c.Cookie[16:]
+				}
+			}
+		}
+	}
+
+	if gotServerCookie != e.serverCookie {
+		resp.Rcode = dns.RcodeBadCookie
+	}
+
+	respOpt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	respOpt.Option = append(respOpt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: clientCookie + e.serverCookie})
+	resp.Extra = append(resp.Extra, respOpt)
+
+	return resp, time.Millisecond, nil
+}
+
+func (e *cookieRequiringExchanger) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	return e.Exchange(m, address)
+}
+
+func TestSendDNSLookupRequestAttachesCookie(t *testing.T) {
+	old := dnsCookieEnabled
+	dnsCookieEnabled = true
+	defer func() { dnsCookieEnabled = old }()
+
+	oldJar := defaultCookieJar
+	defaultCookieJar = newCookieJar()
+	defer func() { defaultCookieJar = oldJar }()
+
+	server := &cookieRequiringExchanger{serverCookie: "aabbccddeeff0011"}
+
+	// The first exchange has no server cookie yet, so this fake upstream
+	// returns BADCOOKIE along with the server cookie it expects next.
+	if _, _, err := sendDNSLookupRequest(server, "10.0.0.1:53", "example.com."); err != nil {
+		t.Fatalf("sendDNSLookupRequest() error = %v", err)
+	}
+
+	defaultCookieJar.mu.Lock()
+	got := defaultCookieJar.servers["10.0.0.1:53"]
+	defaultCookieJar.mu.Unlock()
+	if got != server.serverCookie {
+		t.Fatalf("cookieJar didn't learn the server cookie: got %q, want %q", got, server.serverCookie)
+	}
+}
+
+func TestSendDNSLookupRequestAttachesECSOption(t *testing.T) {
+	old := dnsECSSubnet
+	dnsECSSubnet = "203.0.113.0/24"
+	defer func() { dnsECSSubnet = old }()
+
+	var gotSubnets []*dns.EDNS0_SUBNET
+	server := fakeExchangerFunc(func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+		if opt := m.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+					gotSubnets = append(gotSubnets, subnet)
+				}
+			}
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(m)
+		return resp, time.Millisecond, nil
+	})
+
+	if _, _, err := sendDNSLookupRequest(server, "10.0.0.1:53", "example.com."); err != nil {
+		t.Fatalf("sendDNSLookupRequest() error = %v", err)
+	}
+
+	if len(gotSubnets) != 2 {
+		t.Fatalf("queries with an ECS option = %d, want 2 (one per A/AAAA query)", len(gotSubnets))
+	}
+	for _, subnet := range gotSubnets {
+		if subnet.Family != 1 || subnet.SourceNetmask != 24 || subnet.Address.String() != "203.0.113.0" {
+			t.Errorf("ECS option = %+v, want family 1, netmask 24, address 203.0.113.0", subnet)
+		}
+	}
+}
+
+func TestSendDNSLookupRequestOmitsECSOptionWhenUnset(t *testing.T) {
+	old := dnsECSSubnet
+	dnsECSSubnet = ""
+	defer func() { dnsECSSubnet = old }()
+
+	server := fakeExchangerFunc(func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+		if opt := m.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if _, ok := o.(*dns.EDNS0_SUBNET); ok {
+					t.Fatal("query carries an ECS option, want none when --dns-ecs-subnet is unset")
+				}
+			}
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(m)
+		return resp, time.Millisecond, nil
+	})
+
+	if _, _, err := sendDNSLookupRequest(server, "10.0.0.1:53", "example.com."); err != nil {
+		t.Fatalf("sendDNSLookupRequest() error = %v", err)
+	}
+}
+
+// TestSendDNSLookupRequestDiscardsMismatchedAnswers verifies that
+// sendDNSLookupRequest rejects a response whose question section doesn't
+// match the query, and separately discards answer records owned by a
+// name other than the one queried, instead of trusting either as an
+// answer for the queried name.
+func TestSendDNSLookupRequestDiscardsMismatchedAnswers(t *testing.T) {
+	server := fakeExchangerFunc(func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+		resp := new(dns.Msg)
+		switch m.Question[0].Qtype {
+		case dns.TypeA:
+			// A malicious/misbehaving upstream answers a completely
+			// different question and throws in a record for yet another
+			// unrelated name.
+			resp.SetQuestion("attacker.example.", dns.TypeA)
+			resp.Answer = []dns.RR{
+				&dns.A{Hdr: dns.RR_Header{Name: "attacker.example.", Rrtype: dns.TypeA, Ttl: 30}, A: net.ParseIP("10.13.13.13")},
+			}
+		case dns.TypeAAAA:
+			// This response's question section matches, but it smuggles
+			// in an answer for a name the client never asked about,
+			// alongside one that's legitimate.
+			resp.SetReply(m)
+			resp.Answer = []dns.RR{
+				&dns.AAAA{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeAAAA, Ttl: 30}, AAAA: net.ParseIP("::1")},
+				&dns.AAAA{Hdr: dns.RR_Header{Name: "attacker.example.", Rrtype: dns.TypeAAAA, Ttl: 30}, AAAA: net.ParseIP("::2")},
+			}
+		}
+		return resp, time.Millisecond, nil
+	})
+
+	got, _, err := sendDNSLookupRequest(server, "10.0.0.1:53", "example.com.")
+	if err != nil {
+		t.Fatalf("sendDNSLookupRequest() error = %v", err)
+	}
+
+	if _, ok := got["10.13.13.13"]; ok {
+		t.Errorf("got %v, want the A response for a different question discarded entirely", got)
+	}
+	if _, ok := got["::2"]; ok {
+		t.Errorf("got %v, want the answer record owned by an unrelated name discarded", got)
+	}
+	if _, ok := got["::1"]; !ok {
+		t.Errorf("got %v, want the legitimate AAAA answer for example.com. kept", got)
+	}
+}
+
+// TestAggregateDNSLookupAcrossServersUsesMinimumTTL verifies that when two
+// CoreDNS pods answer the same name with divergent TTLs for the same
+// address, aggregateDNSLookupAcrossServers keeps the minimum rather than
+// whichever pod happened to answer.
+func TestAggregateDNSLookupAcrossServersUsesMinimumTTL(t *testing.T) {
+	perServerTTL := map[string]uint32{
+		"10.0.0.1:53": 300,
+		"10.0.0.2:53": 30,
+	}
+	server := fakeExchangerFunc(func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+		if m.Question[0].Qtype != dns.TypeA {
+			resp := new(dns.Msg)
+			resp.SetReply(m)
+			return resp, time.Millisecond, nil
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(m)
+		resp.Answer = []dns.RR{
+			&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Ttl: perServerTTL[address]}, A: net.ParseIP("192.0.2.1")},
+		}
+		return resp, time.Millisecond, nil
+	})
+
+	got, _, err := aggregateDNSLookupAcrossServers(server, []string{"10.0.0.1:53", "10.0.0.2:53"}, "example.com.")
+	if err != nil {
+		t.Fatalf("aggregateDNSLookupAcrossServers() error = %v", err)
+	}
+
+	ttl, ok := got["192.0.2.1"]
+	if !ok {
+		t.Fatalf("got %v, want an entry for 192.0.2.1", got)
+	}
+	if ttl.ttl != 30 {
+		t.Errorf("ttl = %d, want the minimum TTL observed across pods (30)", ttl.ttl)
+	}
+}
+
+// TestAggregateDNSLookupAcrossServersToleratesPartialFailure verifies that
+// a server erroring out doesn't fail the whole lookup as long as at least
+// one other server answers.
+func TestAggregateDNSLookupAcrossServersToleratesPartialFailure(t *testing.T) {
+	server := fakeExchangerFunc(func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+		if address == "10.0.0.1:53" {
+			return nil, time.Millisecond, fmt.Errorf("connection refused")
+		}
+		if m.Question[0].Qtype != dns.TypeA {
+			resp := new(dns.Msg)
+			resp.SetReply(m)
+			return resp, time.Millisecond, nil
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(m)
+		resp.Answer = []dns.RR{
+			&dns.A{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Ttl: 60}, A: net.ParseIP("192.0.2.1")},
+		}
+		return resp, time.Millisecond, nil
+	})
+
+	got, _, err := aggregateDNSLookupAcrossServers(server, []string{"10.0.0.1:53", "10.0.0.2:53"}, "example.com.")
+	if err != nil {
+		t.Fatalf("aggregateDNSLookupAcrossServers() error = %v", err)
+	}
+	if ttl, ok := got["192.0.2.1"]; !ok || ttl.ttl != 60 {
+		t.Errorf("got %v, want the answering server's result kept despite the other server erroring", got)
+	}
+}
+
+func TestRandomInitialDelayBounds(t *testing.T) {
+	old := initialLookupDelay
+	defer func() { initialLookupDelay = old }()
+
+	initialLookupDelay = 0
+	if d := randomInitialDelay(); d != 0 {
+		t.Errorf("randomInitialDelay() with delay disabled = %v, want 0", d)
+	}
+
+	initialLookupDelay = 100 * time.Millisecond
+	for i := 0; i < 50; i++ {
+		if d := randomInitialDelay(); d < 0 || d >= initialLookupDelay {
+			t.Fatalf("randomInitialDelay() = %v, want in [0, %v)", d, initialLookupDelay)
+		}
+	}
+}
+
+func TestResolverAddAppliesInitialLookupDelay(t *testing.T) {
+	oldDelay, oldRand := initialLookupDelay, randInt63n
+	defer func() { initialLookupDelay, randInt63n = oldDelay, oldRand }()
+
+	const delay = 40 * time.Millisecond
+	initialLookupDelay = delay
+	randInt63n = func(n int64) int64 { return n - 1 } // deterministically pick the top of the range
+
+	lookedUp := make(chan time.Time, 1)
+	start := time.Now()
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookedUp <- time.Now()
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 30}}, 0, nil
+	}, nil)
+
+	r.Add("ns1", "example.com.", false)
+
+	select {
+	case at := <-lookedUp:
+		if elapsed := at.Sub(start); elapsed < delay/2 {
+			t.Fatalf("first lookup happened after only %v, want it delayed close to %v", elapsed, delay)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the delayed initial lookup")
+	}
+}
+
+func TestLookupDNSNameFromCoreDNSUsesFallbackWhenNoPodIPs(t *testing.T) {
+	oldPodIPs, oldExchanger, oldFallback := getRandomCoreDNSPodIPs, newDNSExchanger, fallbackDNSServer
+	defer func() {
+		getRandomCoreDNSPodIPs, newDNSExchanger, fallbackDNSServer = oldPodIPs, oldExchanger, oldFallback
+	}()
+
+	getRandomCoreDNSPodIPs = func() []string { return nil }
+	fallbackDNSServer = "10.9.9.9:53"
+
+	var queriedServer string
+	newDNSExchanger = func() dnsExchanger {
+		return fakeExchangerFunc(func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+			queriedServer = address
+			resp := new(dns.Msg)
+			resp.SetReply(m)
+			return resp, time.Millisecond, nil
+		})
+	}
+
+	if _, _, err := lookupDNSNameFromCoreDNS("example.com."); err != nil {
+		t.Fatalf("lookupDNSNameFromCoreDNS() error = %v", err)
+	}
+	if queriedServer != "10.9.9.9:53" {
+		t.Errorf("lookupDNSNameFromCoreDNS() queried %q, want the fallback server %q", queriedServer, "10.9.9.9:53")
+	}
+}
+
+func TestLookupDNSNameFromCoreDNSErrorsWithNoFallback(t *testing.T) {
+	oldPodIPs, oldFallback := getRandomCoreDNSPodIPs, fallbackDNSServer
+	defer func() { getRandomCoreDNSPodIPs, fallbackDNSServer = oldPodIPs, oldFallback }()
+
+	getRandomCoreDNSPodIPs = func() []string { return nil }
+	fallbackDNSServer = ""
+
+	if _, _, err := lookupDNSNameFromCoreDNS("example.com."); err == nil {
+		t.Fatal("lookupDNSNameFromCoreDNS() with no pod IPs and no fallback = nil error, want an error")
+	}
+}
+
+// fakeExchangerFunc adapts a plain function to the dnsExchanger interface.
+type fakeExchangerFunc func(m *dns.Msg, address string) (*dns.Msg, time.Duration, error)
+
+func (f fakeExchangerFunc) Exchange(m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	return f(m, address)
+}
+
+func (f fakeExchangerFunc) ExchangeContext(ctx context.Context, m *dns.Msg, address string) (*dns.Msg, time.Duration, error) {
+	return f(m, address)
+}
+
+func readCounter(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		t.Fatalf("failed to read counter: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestResolverAddRejectsBeyondMaxTrackedNames(t *testing.T) {
+	oldMax := maxTrackedNames
+	defer func() { maxTrackedNames = oldMax }()
+	maxTrackedNames = 1
+
+	before := readCounter(t, trackedNamesRejectedTotal)
+
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return nil, 0, nil
+	}, nil)
+
+	r.Add("ns1", "example.com.", false)
+	if _, ok := r.dnsNames["example.com."]; !ok {
+		t.Fatalf("first Add should be tracked, dnsNames = %v", r.dnsNames)
+	}
+
+	r.Add("ns1", "other.example.com.", false)
+	if _, ok := r.dnsNames["other.example.com."]; ok {
+		t.Fatalf("Add beyond --max-tracked-names should be rejected, dnsNames = %v", r.dnsNames)
+	}
+	if got := readCounter(t, trackedNamesRejectedTotal); got != before+1 {
+		t.Errorf("tracked_names_rejected_total = %v, want %v", got, before+1)
+	}
+
+	// A second namespace referencing the already-tracked name is not
+	// subject to the cap.
+	r.Add("ns2", "example.com.", false)
+	if got := readGauge(t, "example.com."); got != 2 {
+		t.Errorf("name_fanout after a second namespace on an already-tracked name = %v, want 2", got)
+	}
+}
+
+func TestResolverPauseResume(t *testing.T) {
+	lookups := make(chan string, 10)
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookups <- dnsName
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 0}}, 0, nil
+	}, nil)
+
+	r.Pause()
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.Start(stopCh)
+
+	r.Add("ns1", "example.com.", false)
+	// Add's own initial lookup isn't gated by Pause (it fires
+	// unconditionally to warm a brand new name), so drain it before
+	// asserting the scheduling loop stays quiet.
+	select {
+	case <-lookups:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Add's initial lookup")
+	}
+
+	select {
+	case dnsName := <-lookups:
+		t.Fatalf("Start issued a lookup for %q while paused", dnsName)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	r.Resume()
+
+	select {
+	case dnsName := <-lookups:
+		if dnsName != "example.com." {
+			t.Errorf("lookup after Resume = %q, want %q", dnsName, "example.com.")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a lookup after Resume")
+	}
+}
+
+// TestResolverAddDoesNotDoubleDispatchInitialLookup verifies that a
+// brand-new name's initial lookup, dispatched directly by Add, isn't also
+// picked up and re-dispatched by Start's own scheduling loop before that
+// first lookup reports back and reschedules it for real.
+func TestResolverAddDoesNotDoubleDispatchInitialLookup(t *testing.T) {
+	lookupStarted := make(chan struct{}, 10)
+	release := make(chan struct{})
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookupStarted <- struct{}{}
+		<-release
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.Start(stopCh)
+
+	r.Add("ns1", "example.com.", false)
+
+	select {
+	case <-lookupStarted:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the initial lookup to start")
+	}
+
+	// Give Start's own scheduling loop, which just woke via r.added,
+	// a chance to also see this brand-new name as due while the first
+	// lookup is still blocked in flight.
+	select {
+	case <-lookupStarted:
+		t.Fatal("a second initial lookup was dispatched for the same name while the first was still in flight")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	close(release)
+}
+
+// TestResolverDrainWaitsForInFlightLookup verifies Drain blocks while a
+// dispatched lookup is still running, and reports success once it
+// finishes, so graceful shutdown can wait out a lookup already underway
+// instead of abandoning it.
+func TestResolverDrainWaitsForInFlightLookup(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		close(started)
+		<-release
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+
+	stopCh := make(chan struct{})
+	go r.Start(stopCh)
+	r.Add("ns1", "example.com.", false)
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the lookup to start")
+	}
+
+	close(stopCh)
+
+	if r.Drain(50 * time.Millisecond) {
+		t.Fatal("Drain() = true while a lookup was still in flight")
+	}
+
+	close(release)
+
+	if !r.Drain(time.Second) {
+		t.Fatal("Drain() = false after the in-flight lookup finished")
+	}
+}
+
+// TestResolverStartRecordsWakeupMetrics verifies that Start's scheduling
+// loop counts every wakeup it processes, and separately counts the ones
+// taken while no name is tracked, by injecting an added notification
+// with no tracked names (an empty wakeup) followed by an Add, whose
+// added notification wakes the loop with a name tracked (a non-empty
+// one).
+func TestResolverStartRecordsWakeupMetrics(t *testing.T) {
+	before := readCounter(t, schedulerWakeupsTotal)
+	beforeEmpty := readCounter(t, schedulerEmptyWakeupsTotal)
+
+	lookups := make(chan string, 1)
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookups <- dnsName
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.Start(stopCh)
+
+	// An added notification with nothing tracked yet is an empty
+	// wakeup: it doesn't change what (if anything) is next due.
+	select {
+	case r.added <- struct{}{}:
+	case <-time.After(time.Second):
+		t.Fatal("timed out sending to r.added")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for readCounter(t, schedulerEmptyWakeupsTotal) == beforeEmpty {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for scheduler_empty_wakeups_total to increase")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Add() triggers its own immediate lookup goroutine, independent of
+	// Start's loop, and tracking the name also wakes Start's loop via
+	// r.added. This counts as a non-empty wakeup (unlike the wakeup
+	// above, with nothing tracked at all yet), even though Add already
+	// claimed the name's initial lookup for itself and Start's own timer
+	// path won't also pick it up (see Add's in-flight hold on
+	// nextLookupTime).
+	r.Add("ns1", "example.com.", false)
+	select {
+	case <-lookups:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a lookup")
+	}
+
+	deadline = time.Now().Add(time.Second)
+	for readCounter(t, schedulerWakeupsTotal) < before+2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for scheduler_wakeups_total to increase by at least 2, got %v (before %v)", readCounter(t, schedulerWakeupsTotal), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestResolverStartBatchesSimultaneouslyDueNames verifies that Start
+// drains every simultaneously-due name in a single wakeup (via
+// dueDNSNames) instead of ticking once per name, by seeding many already-
+// expired names directly into the scheduler and asserting they're all
+// looked up while scheduler_wakeups_total increases by only a small,
+// bounded amount rather than once per name.
+func TestResolverStartBatchesSimultaneouslyDueNames(t *testing.T) {
+	const numNames = 50
+
+	lookups := make(chan string, numNames)
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookups <- dnsName
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+
+	now := time.Now()
+	for i := 0; i < numNames; i++ {
+		name := fmt.Sprintf("due%d.example.com.", i)
+		d := &dnsNameDetails{dnsName: name, nextLookupTime: now}
+		r.dnsNames[name] = d
+		r.nextLookups = append(r.nextLookups, d)
+	}
+	heap.Init(&r.nextLookups)
+
+	before := readCounter(t, schedulerWakeupsTotal)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.Start(stopCh)
+
+	seen := make(map[string]struct{}, numNames)
+	deadline := time.After(2 * time.Second)
+	for len(seen) < numNames {
+		select {
+		case dnsName := <-lookups:
+			seen[dnsName] = struct{}{}
+		case <-deadline:
+			t.Fatalf("timed out waiting for all %d due names to be looked up, got %d", numNames, len(seen))
+		}
+	}
+
+	// A handful of extra wakeups (e.g. the reschedules lookupAndSchedule
+	// triggers as each lookup completes) is fine; one wakeup per due name
+	// is exactly the busy-ticking behavior batching is meant to prevent.
+	if got := readCounter(t, schedulerWakeupsTotal); got > before+numNames/2 {
+		t.Errorf("scheduler_wakeups_total increased by %v for %d simultaneously-due names, want batched into far fewer wakeups", got-before, numNames)
+	}
+}
+
+// TestResolverStartupRampLimitsInitialLookupRate verifies that with
+// startupRampDuration and startupRampMaxBatch set, Start's first wakeup
+// dispatches only startupRampMaxBatch of a large batch of simultaneously
+// due names, deferring the rest instead of firing all of them at once.
+func TestResolverStartupRampLimitsInitialLookupRate(t *testing.T) {
+	oldDuration, oldMaxBatch := startupRampDuration, startupRampMaxBatch
+	defer func() { startupRampDuration, startupRampMaxBatch = oldDuration, oldMaxBatch }()
+	startupRampDuration = time.Hour
+	startupRampMaxBatch = 5
+
+	const numNames = 50
+
+	lookups := make(chan string, numNames)
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookups <- dnsName
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+
+	now := time.Now()
+	for i := 0; i < numNames; i++ {
+		name := fmt.Sprintf("ramp%d.example.com.", i)
+		d := &dnsNameDetails{dnsName: name, nextLookupTime: now}
+		r.dnsNames[name] = d
+		r.nextLookups = append(r.nextLookups, d)
+	}
+	heap.Init(&r.nextLookups)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.Start(stopCh)
+
+	seen := 0
+	deadline := time.After(500 * time.Millisecond)
+loop:
+	for {
+		select {
+		case <-lookups:
+			seen++
+		case <-deadline:
+			break loop
+		}
+	}
+
+	if seen != startupRampMaxBatch {
+		t.Fatalf("lookups dispatched before the ramp deadline = %d, want exactly startupRampMaxBatch (%d)", seen, startupRampMaxBatch)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	distinct := make(map[time.Time]struct{}, len(r.dnsNames))
+	for _, d := range r.dnsNames {
+		distinct[d.nextLookupTime] = struct{}{}
+	}
+	if len(distinct) < numNames-startupRampMaxBatch {
+		t.Errorf("distinct nextLookupTime values among deferred names = %d, want each staggered to its own point instead of bunched together", len(distinct))
+	}
+}
+
+// TestResolverAddOnAlreadyTrackedNameDoesNotWakeScheduler verifies that
+// re-announcing names the resolver already tracks — as happens for every
+// object on every one of them when a relist follows an apiserver
+// reconnect — doesn't signal Start's scheduler loop at all, since nothing
+// about their schedule changed. Only the initial Add of each name (which
+// does change the heap) should count as a wakeup.
+func TestResolverAddOnAlreadyTrackedNameDoesNotWakeScheduler(t *testing.T) {
+	const numNames = 200
+
+	lookups := make(chan string, numNames)
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookups <- dnsName
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.Start(stopCh)
+
+	names := make([]string, numNames)
+	for i := 0; i < numNames; i++ {
+		names[i] = fmt.Sprintf("relist%d.example.com.", i)
+		r.Add("ns1", names[i], false)
+	}
+	for range names {
+		select {
+		case <-lookups:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for the initial lookups after Add")
+		}
+	}
+
+	before := readCounter(t, schedulerWakeupsTotal)
+
+	// Simulate a bulk relist: every object is reconciled again and its
+	// already-tracked name re-announced, exactly as addOrUpdateObject
+	// does for every object on every relist.
+	for _, name := range names {
+		r.Add("ns1", name, false)
+	}
+
+	// Give Start's loop a chance to react if it were going to; since none
+	// of these Adds changed the heap, it shouldn't wake at all.
+	time.Sleep(50 * time.Millisecond)
+
+	if got := readCounter(t, schedulerWakeupsTotal); got != before {
+		t.Errorf("scheduler_wakeups_total increased by %v after re-announcing %d already-tracked names, want 0", got-before, numNames)
+	}
+}
+
+// TestResolverSnapshotRestoreRoundTrip verifies that a snapshot taken from
+// one resolver, applied to a fresh one via Restore, resumes a name at its
+// prior nextLookupTime instead of treating it as newly tracked and
+// looking it up immediately.
+func TestResolverSnapshotRestoreRoundTrip(t *testing.T) {
+	r1 := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+	r1.Add("ns1", "example.com.", false)
+
+	// Wait for Add's own initial lookup to complete and reschedule the
+	// name well into the future, so the snapshot captures a
+	// not-yet-due nextLookupTime.
+	deadline := time.Now().Add(time.Second)
+	for {
+		r1.mu.Lock()
+		ttl := r1.dnsNames["example.com."].ttlSeconds
+		r1.mu.Unlock()
+		if ttl != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the initial lookup to reschedule example.com.")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	snapshot := r1.Snapshot()
+	want, ok := snapshot["example.com."]
+	if !ok {
+		t.Fatalf("Snapshot() = %+v, missing example.com.", snapshot)
+	}
+	if !want.NextLookupTime.After(time.Now()) {
+		t.Fatalf("Snapshot()[example.com.].NextLookupTime = %v, want a time in the future", want.NextLookupTime)
+	}
+
+	lookups := make(chan string, 1)
+	r2 := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookups <- dnsName
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+	r2.Restore(snapshot)
+	r2.Add("ns1", "example.com.", false)
+
+	select {
+	case dnsName := <-lookups:
+		t.Fatalf("Add issued an immediate lookup for restored, not-yet-due name %q", dnsName)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	r2.mu.Lock()
+	got := r2.dnsNames["example.com."]
+	r2.mu.Unlock()
+	if got == nil || !got.nextLookupTime.Equal(want.NextLookupTime) || got.ttlSeconds != want.TTLSeconds {
+		t.Errorf("Add after Restore = %+v, want nextLookupTime %v, ttlSeconds %d", got, want.NextLookupTime, want.TTLSeconds)
+	}
+}
+
+// TestResolverRestoreDueNameLooksUpImmediately verifies that a restored
+// name whose persisted nextLookupTime has already passed (e.g. the
+// operator was down longer than the name's TTL) still gets looked up
+// right away, rather than being stuck until some arbitrary future time.
+func TestResolverRestoreDueNameLooksUpImmediately(t *testing.T) {
+	lookups := make(chan string, 1)
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		lookups <- dnsName
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: 300}}, 0, nil
+	}, nil)
+	r.Restore(SchedulerSnapshot{
+		"example.com.": {TTLSeconds: 30, NextLookupTime: time.Now().Add(-time.Minute)},
+	})
+
+	r.Add("ns1", "example.com.", false)
+
+	select {
+	case dnsName := <-lookups:
+		if dnsName != "example.com." {
+			t.Errorf("lookup after Restore of a due name = %q, want %q", dnsName, "example.com.")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a lookup of a restored, already-due name")
+	}
+}
+
+// TestGetNextDNSNameDetailsReturnsSoonest verifies that
+// getNextDNSNameDetails, backed by the nextLookups heap, returns the
+// tracked name with the earliest nextLookupTime regardless of the order
+// names were added in.
+func TestGetNextDNSNameDetailsReturnsSoonest(t *testing.T) {
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return nil, 0, nil
+	}, nil)
+
+	base := time.Now().Add(time.Hour)
+	names := map[string]time.Duration{
+		"c.example.com.": 30 * time.Minute,
+		"a.example.com.": 5 * time.Minute,
+		"b.example.com.": 20 * time.Minute,
+	}
+	for name, offset := range names {
+		d := &dnsNameDetails{dnsName: name, nextLookupTime: base.Add(offset)}
+		r.dnsNames[name] = d
+		r.nextLookups = append(r.nextLookups, d)
+	}
+	heap.Init(&r.nextLookups)
+
+	next, _ := r.getNextDNSNameDetails()
+	if next == nil || next.dnsName != "a.example.com." {
+		t.Fatalf("getNextDNSNameDetails() = %+v, want a.example.com. (earliest nextLookupTime)", next)
+	}
+}
+
+// TestResolverObserveTTLBringsWildcardRefreshForward verifies that
+// ObserveTTL, as used by wildcardGroupRefresh, moves a tracked wildcard's
+// next lookup earlier when a shorter TTL is observed from live traffic
+// against one of its subdomains, but never pushes it later, and leaves a
+// non-wildcard or untracked name alone.
+func TestResolverObserveTTLBringsWildcardRefreshForward(t *testing.T) {
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return nil, 0, nil
+	}, nil)
+
+	base := time.Now().Add(time.Hour)
+	wc := &dnsNameDetails{dnsName: "*.example.com.", isWildcard: true, nextLookupTime: base}
+	exact := &dnsNameDetails{dnsName: "www.other.com.", nextLookupTime: base}
+	r.dnsNames["*.example.com."] = wc
+	r.dnsNames["www.other.com."] = exact
+	r.nextLookups = append(r.nextLookups, wc, exact)
+	heap.Init(&r.nextLookups)
+
+	// A shorter TTL observed for a subdomain matched against the
+	// wildcard brings its refresh forward.
+	r.ObserveTTL("*.example.com.", 30)
+	if got := r.dnsNames["*.example.com."].nextLookupTime; !got.Before(base) {
+		t.Errorf("nextLookupTime = %v, want brought forward of %v", got, base)
+	}
+
+	// A longer TTL than what's already scheduled doesn't push it back out.
+	brought := r.dnsNames["*.example.com."].nextLookupTime
+	r.ObserveTTL("*.example.com.", 3600)
+	if got := r.dnsNames["*.example.com."].nextLookupTime; !got.Equal(brought) {
+		t.Errorf("nextLookupTime = %v, want unchanged at %v (longer TTL shouldn't push it back out)", got, brought)
+	}
+
+	// A non-wildcard tracked name is untouched.
+	r.ObserveTTL("www.other.com.", 1)
+	if got := r.dnsNames["www.other.com."].nextLookupTime; !got.Equal(base) {
+		t.Errorf("nextLookupTime for a non-wildcard name = %v, want unchanged at %v", got, base)
+	}
+
+	// An untracked name is a no-op, not a panic.
+	r.ObserveTTL("*.untracked.com.", 1)
+
+	next, _ := r.getNextDNSNameDetails()
+	if next == nil || next.dnsName != "*.example.com." {
+		t.Errorf("getNextDNSNameDetails() = %+v, want the wildcard whose refresh was brought forward", next)
+	}
+}
+
+// TestLookupAndScheduleReordersHeap verifies that rescheduling a name via
+// lookupAndSchedule moves it to its new place in the nextLookups heap, so
+// a name that was due soonest but got a long TTL stops being returned as
+// next.
+func TestLookupAndScheduleReordersHeap(t *testing.T) {
+	ttls := map[string]uint32{
+		"soon.example.com.": 3600,
+		"late.example.com.": 30,
+	}
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return map[string]ipTTL{"10.0.0.1": {ip: "10.0.0.1", ttl: ttls[dnsName]}}, 0, nil
+	}, nil)
+
+	now := time.Now()
+	soon := &dnsNameDetails{dnsName: "soon.example.com.", nextLookupTime: now}
+	late := &dnsNameDetails{dnsName: "late.example.com.", nextLookupTime: now.Add(time.Hour)}
+	r.dnsNames["soon.example.com."] = soon
+	r.dnsNames["late.example.com."] = late
+	r.nextLookups = append(r.nextLookups, soon, late)
+	heap.Init(&r.nextLookups)
+
+	next, _ := r.getNextDNSNameDetails()
+	if next.dnsName != "soon.example.com." {
+		t.Fatalf("getNextDNSNameDetails() before reschedule = %q, want soon.example.com.", next.dnsName)
+	}
+
+	// soon.example.com. resolves with a long TTL, pushing its
+	// nextLookupTime an hour out, so late.example.com. (30s TTL,
+	// already scheduled sooner) should become next.
+	r.lookupAndSchedule("soon.example.com.")
+
+	next, _ = r.getNextDNSNameDetails()
+	if next.dnsName != "late.example.com." {
+		t.Fatalf("getNextDNSNameDetails() after reschedule = %q, want late.example.com.", next.dnsName)
+	}
+}
+
+// TestDeleteRemovesFromHeap verifies that Delete removes an untracked
+// name from the nextLookups heap, so it can never be returned by
+// getNextDNSNameDetails again.
+func TestDeleteRemovesFromHeap(t *testing.T) {
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return nil, 0, nil
+	}, nil)
+
+	now := time.Now()
+	keep := &dnsNameDetails{dnsName: "keep.example.com.", nextLookupTime: now.Add(time.Hour)}
+	remove := &dnsNameDetails{dnsName: "remove.example.com.", nextLookupTime: now.Add(time.Minute)}
+	r.dnsNames["keep.example.com."] = keep
+	r.dnsNames["remove.example.com."] = remove
+	r.nextLookups = append(r.nextLookups, keep, remove)
+	heap.Init(&r.nextLookups)
+	r.namespaceDNSInfo["remove.example.com."] = map[string]struct{}{"ns1": {}}
+
+	r.Delete("ns1", "remove.example.com.", false)
+
+	if len(r.nextLookups) != 1 || r.nextLookups[0].dnsName != "keep.example.com." {
+		t.Fatalf("nextLookups after deleting remove.example.com. = %v, want only keep.example.com.", r.nextLookups)
+	}
+}
+
+// TestSchedulerChannelSaturationDropsWithMetric verifies that Add and
+// Delete never block when the added/deleted channels are full, and that
+// each dropped notification increments schedulerEventsDroppedTotal with
+// the right channel label instead of being silently discarded.
+func TestSchedulerChannelSaturationDropsWithMetric(t *testing.T) {
+	r := NewResolver(func(dnsName string) (map[string]ipTTL, time.Duration, error) {
+		return nil, 0, nil
+	}, nil)
+
+	// Fill both channels to capacity with nothing draining them, as if
+	// Start's loop weren't running or were falling behind a burst.
+	for i := 0; i < cap(r.added); i++ {
+		r.added <- struct{}{}
+	}
+	for i := 0; i < cap(r.deleted); i++ {
+		r.deleted <- "placeholder"
+	}
+
+	addedBefore := readCounter(t, schedulerEventsDroppedTotal.WithLabelValues("added"))
+	deletedBefore := readCounter(t, schedulerEventsDroppedTotal.WithLabelValues("deleted"))
+
+	done := make(chan struct{})
+	go func() {
+		r.Add("ns1", "example.com.", false)
+		r.Delete("ns1", "example.com.", false)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Add/Delete blocked with the added/deleted channels saturated")
+	}
+
+	if got := readCounter(t, schedulerEventsDroppedTotal.WithLabelValues("added")); got != addedBefore+1 {
+		t.Errorf("scheduler_events_dropped_total{channel=\"added\"} = %v, want %v", got, addedBefore+1)
+	}
+	if got := readCounter(t, schedulerEventsDroppedTotal.WithLabelValues("deleted")); got != deletedBefore+1 {
+		t.Errorf("scheduler_events_dropped_total{channel=\"deleted\"} = %v, want %v", got, deletedBefore+1)
+	}
+}
@@ -0,0 +1,561 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"flag"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/metrics"
+	clog "github.com/coredns/coredns/plugin/pkg/log"
+	"github.com/miekg/dns"
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	"github.com/openshift/coredns-ocp-dnsnameresolver/manifests"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+func init() { plugin.Register("dnsnameresolver", setup) }
+
+// leaderElectionID and enableLeaderElection configure the manager's
+// leader election. Leader election is off by default: each plugin
+// instance needs its own full reconcile of DNSNameResolver objects to
+// answer the DNS queries its own CoreDNS server sees, so under the
+// normal one-active-reconciler-per-CoreDNS-instance deployment there's
+// nothing to elect a leader among. It exists for operators who run
+// multiple instances against the same lease deliberately (e.g. an
+// active/standby pair) and, in that case, need distinct
+// --leader-election-id values per independent deployment so they don't
+// fight over the same lease.
+var leaderElectionID string
+var enableLeaderElection bool
+
+func init() {
+	flag.StringVar(&leaderElectionID, "leader-election-id", "3a3a07d4.openshift.io",
+		"Leader election lease ID used when --enable-leader-election is set. Give independent deployments of this plugin distinct values so they don't contend for the same lease.")
+	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
+		"Enable leader election among instances of this plugin sharing --leader-election-id. Off by default, since a typical deployment needs every instance actively reconciling.")
+}
+
+// managerOptions returns the ctrl.Options newManager builds its manager
+// from, factored out so the leader election wiring above can be tested
+// without standing up a real manager.
+func managerOptions(s *runtime.Scheme) ctrl.Options {
+	return ctrl.Options{
+		Scheme:           s,
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: leaderElectionID,
+	}
+}
+
+func setup(c *caddy.Controller) error {
+	h, err := parse(c)
+	if err != nil {
+		return plugin.Error("dnsnameresolver", err)
+	}
+
+	restConfig, err := resolveRestConfig()
+	if err != nil {
+		return plugin.Error("dnsnameresolver", err)
+	}
+
+	mgr, err := newManager(restConfig, h)
+	if err != nil {
+		return plugin.Error("dnsnameresolver", err)
+	}
+	h.client = mgr.GetClient()
+
+	mgrCtx, cancelMgr := context.WithCancel(context.Background())
+
+	c.OnStartup(func() error {
+		clog.Infof("dnsnameresolver: running with config %+v", h.Config())
+		metrics.MustRegister(c, updatesTotal, updateDuration, statusBytes, nameFanout, updateOutcomeTotal, upstreamRTT, duplicateObjectsTotal, trackedNamesRejectedTotal, asyncStatusUpdatesDroppedTotal, schedulerWakeupsTotal, schedulerEmptyWakeupsTotal, schedulerEventsDroppedTotal, coreDNSCacheHitsTotal, coreDNSCacheMissesTotal, successRatio, buildInfo, externalStatusEditsDetectedTotal, budgetExceededTotal, specDriftTotal, warmupUpdatesDeferredTotal)
+		buildInfo.WithLabelValues(version, commit).Set(1)
+		if h.schedulerStateNamespace != "" {
+			// mgr.GetClient()'s cached reads block until the manager's
+			// cache is started below, so the initial restore uses the
+			// uncached APIReader instead.
+			snapshot, err := loadSchedulerSnapshot(context.Background(), mgr.GetAPIReader(), h.schedulerStateNamespace, h.schedulerStateConfigMapName)
+			if err != nil {
+				clog.Warningf("dnsnameresolver: failed to restore scheduler state from ConfigMap %s/%s: %v", h.schedulerStateNamespace, h.schedulerStateConfigMapName, err)
+			} else if snapshot != nil {
+				h.resolver.Restore(snapshot)
+			}
+			go h.runSchedulerStatePersistence(h.stopCh)
+		}
+		if h.exportPath != "" {
+			go h.runExporter(h.stopCh)
+		}
+		go func() {
+			if err := mgr.Start(mgrCtx); err != nil {
+				clog.Errorf("dnsnameresolver: manager exited: %v", err)
+			}
+		}()
+		go func() {
+			if !mgr.GetCache().WaitForCacheSync(mgrCtx) {
+				return
+			}
+			if err := h.reconcileAllNow(mgrCtx, mgr.GetClient()); err != nil {
+				clog.Warningf("dnsnameresolver: initial reconcile sweep failed: %v", err)
+			}
+		}()
+		if pauseResolverAtStartup {
+			h.resolver.Pause()
+		}
+		if h.warmupPeriod > 0 {
+			h.startWarmup()
+		}
+		go h.resolver.Start(h.stopCh)
+		h.resolver.Prewarm(parsePrewarmNames())
+		return nil
+	})
+
+	c.OnFinalShutdown(func() error {
+		// Drained before stopCh closes, while the manager's client is
+		// still usable, so an asyncStatusUpdate update already running
+		// against the apiserver gets to finish instead of being cut off
+		// mid-write by the shutdown that follows.
+		if h.asyncStatusUpdate {
+			if !h.asyncQueue.drain(shutdownFlushTimeout) {
+				clog.Warningf("dnsnameresolver: shutdown proceeding with asyncStatusUpdate updates still in flight after %s", shutdownFlushTimeout)
+			}
+		}
+		// stopCh is closed before cancelMgr so runSchedulerStatePersistence's
+		// final save has a working client to persist through. Closing it
+		// also ends the resolver's Start loop, so it stops dispatching new
+		// proactive lookups; Drain then waits out whichever lookups it had
+		// already dispatched before that, giving them a chance to finish
+		// against a still-running CoreDNS instead of being abandoned
+		// mid-lookup.
+		close(h.stopCh)
+		if !h.resolver.Drain(resolverDrainTimeout) {
+			clog.Warningf("dnsnameresolver: shutdown proceeding with proactive lookups still in flight after %s", resolverDrainTimeout)
+		}
+		cancelMgr()
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		h.Next = next
+		return h
+	})
+
+	return nil
+}
+
+func parse(c *caddy.Controller) (*OCPDNSNameResolver, error) {
+	h := New()
+
+	for c.Next() {
+		for c.NextBlock() {
+			switch c.Val() {
+			case "namespaces":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				h.namespaces = parseNamespaces(args)
+			case "updateTimeout":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				timeout, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				h.updateTimeout = timeout
+			case "namespaceUpdateQPS":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				qps, err := strconv.ParseFloat(args[0], 64)
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				h.limiters = newNamespaceLimiters(qps)
+			case "answerLimit":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				limit, err := strconv.Atoi(args[0])
+				if err != nil || limit < 0 {
+					return nil, c.Errf("invalid answerLimit %q", args[0])
+				}
+				h.answerLimit = limit
+			case "followSRV":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.followSRV = true
+			case "followSVCB":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.followSVCB = true
+			case "failOnUpdateError":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.failOnUpdateError = true
+			case "asyncStatusUpdate":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.asyncStatusUpdate = true
+			case "logSkippedQueries":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.logSkippedQueries = true
+			case "logUpdateDecisions":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.logUpdateDecisions = true
+			case "persistSchedulerState":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				h.schedulerStateNamespace = args[0]
+				h.schedulerStateConfigMapName = args[1]
+			case "clientCIDRs":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, arg := range args {
+					_, cidr, err := net.ParseCIDR(arg)
+					if err != nil {
+						return nil, c.Errf("invalid clientCIDRs entry %q: %v", arg, err)
+					}
+					h.clientCIDRs = append(h.clientCIDRs, cidr)
+				}
+			case "ipFilter":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "excludeList":
+					if len(args) < 2 {
+						return nil, c.ArgErr()
+					}
+					exclude := make(map[string]struct{}, len(args)-1)
+					for _, ip := range args[1:] {
+						if net.ParseIP(ip) == nil {
+							return nil, c.Errf("invalid ipFilter excludeList entry %q", ip)
+						}
+						exclude[ip] = struct{}{}
+					}
+					h.ipFilters = append(h.ipFilters, newExcludeListFilter(exclude))
+				case "privateFilter":
+					if len(args) != 1 {
+						return nil, c.ArgErr()
+					}
+					h.ipFilters = append(h.ipFilters, privateFilter)
+				default:
+					return nil, c.Errf("invalid ipFilter hook %q", args[0])
+				}
+			case "requireRecursionDesired":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.requireRecursionDesired = true
+			case "ttlRounding":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				granularity, err := strconv.Atoi(args[0])
+				if err != nil || granularity <= 0 {
+					return nil, c.Errf("invalid ttlRounding %q: must be a positive number of seconds", args[0])
+				}
+				h.ttlRoundingSeconds = uint32(granularity)
+			case "zeroTTLPolicy":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case zeroTTLPolicyStore, zeroTTLPolicySkip:
+					if len(args) != 1 {
+						return nil, c.ArgErr()
+					}
+				case zeroTTLPolicyFloor, zeroTTLPolicyStoreVolatile:
+					if len(args) != 2 {
+						return nil, c.Errf("zeroTTLPolicy %s requires a minimum TTL in seconds", args[0])
+					}
+					minimum, err := strconv.Atoi(args[1])
+					if err != nil || minimum <= 0 {
+						return nil, c.Errf("invalid zeroTTLPolicy %s minimum TTL %q: must be a positive number of seconds", args[0], args[1])
+					}
+					h.zeroTTLMinimum = uint32(minimum)
+				default:
+					return nil, c.Errf("invalid zeroTTLPolicy %q: must be one of store, floor, skip, storeVolatile", args[0])
+				}
+				h.zeroTTLPolicy = args[0]
+			case "maxAddressAge":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				maxAge, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				if maxAge <= 0 {
+					return nil, c.Errf("invalid maxAddressAge %q: must be positive", args[0])
+				}
+				h.maxAddressAge = maxAge
+			case "processingBudget":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				budget, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				if budget <= 0 {
+					return nil, c.Errf("invalid processingBudget %q: must be positive", args[0])
+				}
+				h.processingBudget = budget
+			case "warmup":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				warmup, err := time.ParseDuration(args[0])
+				if err != nil {
+					return nil, c.Err(err.Error())
+				}
+				if warmup <= 0 {
+					return nil, c.Errf("invalid warmup %q: must be positive", args[0])
+				}
+				h.warmupPeriod = warmup
+			case "requireAuthoritative":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.requireAuthoritative = true
+			case "disableWildcards":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.disableWildcards = true
+			case "tracing":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.tracingEnabled = true
+			case "clearUnwatchedStatus":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.clearUnwatchedStatus = true
+			case "searchSuffixes":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, suffix := range args {
+					h.searchSuffixes = append(h.searchSuffixes, strings.ToLower(dns.Fqdn(suffix)))
+				}
+			case "zones":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				for _, zone := range args {
+					h.zones = append(h.zones, strings.ToLower(dns.Fqdn(zone)))
+				}
+			case "wildcardSubdomainTracking":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case "on":
+					h.wildcardSubdomainTracking = true
+				case "off":
+					h.wildcardSubdomainTracking = false
+				default:
+					return nil, c.Errf("invalid wildcardSubdomainTracking %q", args[0])
+				}
+			case "wildcardGroupRefresh":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.wildcardGroupRefresh = true
+			case "applyMode":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case applyModeUpdateStatus, applyModeServerSideApply:
+					h.applyMode = args[0]
+				default:
+					return nil, c.Errf("invalid applyMode %q", args[0])
+				}
+			case "familyOrder":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				switch args[0] {
+				case familyOrderV4First, familyOrderV6First:
+					h.familyOrder = args[0]
+				default:
+					return nil, c.Errf("invalid familyOrder %q", args[0])
+				}
+			case "managedBySelector":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				selector, err := labels.Parse(args[0])
+				if err != nil {
+					return nil, c.Errf("invalid managedBySelector %q: %v", args[0], err)
+				}
+				h.managedBySelector = selector
+				h.managedBySelectorRaw = args[0]
+			case "failureRcodes":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				rcodes := make(map[int]bool, len(args))
+				for _, arg := range args {
+					rcode, ok := dns.StringToRcode[strings.ToUpper(arg)]
+					if !ok {
+						var err error
+						rcode, err = strconv.Atoi(arg)
+						if err != nil {
+							return nil, c.Errf("invalid failureRcodes entry %q", arg)
+						}
+					}
+					rcodes[rcode] = true
+				}
+				h.failureRcodes = rcodes
+			case "rcodeMessages":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args)%2 != 0 {
+					return nil, c.ArgErr()
+				}
+				messages := make(map[int]string, len(args)/2)
+				for i := 0; i < len(args); i += 2 {
+					rcode, ok := dns.StringToRcode[strings.ToUpper(args[i])]
+					if !ok {
+						var err error
+						rcode, err = strconv.Atoi(args[i])
+						if err != nil {
+							return nil, c.Errf("invalid rcodeMessages entry %q", args[i])
+						}
+					}
+					messages[rcode] = args[i+1]
+				}
+				h.rcodeMessages = messages
+			case "apiVersion":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				if args[0] != supportedAPIVersion {
+					return nil, c.Errf("unsupported apiVersion %q: this build only supports %q", args[0], supportedAPIVersion)
+				}
+				h.apiVersion = args[0]
+			case "instanceAnnotation":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				h.instanceAnnotationKey = args[0]
+			case "maxStatusBytes":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				limit, err := strconv.Atoi(args[0])
+				if err != nil || limit <= 0 {
+					return nil, c.Errf("invalid maxStatusBytes %q: must be a positive number of bytes", args[0])
+				}
+				h.maxStatusBytes = limit
+			case "nodataCountsAsFailure":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.nodataCountsAsFailure = true
+			case "exportPath":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				h.exportPath = args[0]
+			case "failureThreshold":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				threshold, err := strconv.Atoi(args[0])
+				if err != nil || threshold < 1 {
+					return nil, c.Errf("invalid failureThreshold %q: must be a positive integer", args[0])
+				}
+				h.failureThreshold = threshold
+			case "dedupeResolvedAddresses":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.dedupeResolvedAddresses = true
+			case "trackPTR":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				h.trackPTR = true
+			default:
+				return nil, c.ArgErr()
+			}
+		}
+	}
+
+	if h.asyncStatusUpdate && h.failOnUpdateError {
+		return nil, c.Errf("asyncStatusUpdate and failOnUpdateError cannot both be set: an async update can't fail a response that was already sent")
+	}
+
+	return h, nil
+}
+
+func newManager(restConfig *rest.Config, h *OCPDNSNameResolver) (manager.Manager, error) {
+	if err := manifests.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := scheme.Scheme
+	if err := networkv1alpha1.Install(s); err != nil {
+		return nil, err
+	}
+
+	mgr, err := ctrl.NewManager(restConfig, managerOptions(s))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.addToManager(mgr); err != nil {
+		return nil, err
+	}
+
+	return mgr, nil
+}
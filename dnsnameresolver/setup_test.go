@@ -0,0 +1,801 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/coredns/caddy"
+	"github.com/miekg/dns"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+// TestReloadStopsPreviousManagerContext exercises the lifecycle contract
+// setup() relies on: each setup() call gets its own cancelable context
+// (rather than sharing a single process-wide signal handler), and
+// OnFinalShutdown cancels only that instance's context. This simulates
+// two Corefile reload cycles and asserts that finishing the first one
+// stops its manager goroutine without affecting the second.
+func TestReloadStopsPreviousManagerContext(t *testing.T) {
+	startInstance := func() (ctx context.Context, onFinalShutdown func(), stopped <-chan struct{}) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			<-ctx.Done()
+			close(done)
+		}()
+		return ctx, cancel, done
+	}
+
+	// First setup() cycle, standing in for the plugin instance created
+	// before a Corefile reload.
+	_, cancelFirst, firstStopped := startInstance()
+
+	// Second setup() cycle, standing in for the reloaded plugin instance.
+	_, cancelSecond, secondStopped := startInstance()
+	defer cancelSecond()
+
+	select {
+	case <-firstStopped:
+		t.Fatal("first instance's manager stopped before its OnFinalShutdown ran")
+	case <-secondStopped:
+		t.Fatal("second instance's manager stopped before its OnFinalShutdown ran")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Reload completes: CoreDNS runs the outgoing instance's
+	// OnFinalShutdown, which must stop only its own manager.
+	cancelFirst()
+
+	select {
+	case <-firstStopped:
+	case <-time.After(time.Second):
+		t.Fatal("first instance's manager was not stopped by its own OnFinalShutdown")
+	}
+
+	select {
+	case <-secondStopped:
+		t.Fatal("second instance's manager was stopped by the first instance's OnFinalShutdown")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// TestParseRejectsAsyncStatusUpdateWithFailOnUpdateError verifies that
+// combining asyncStatusUpdate with failOnUpdateError is a Corefile error
+// rather than a silently ignored setting: once ServeDNS has returned the
+// response asynchronously, a later update failure can no longer be
+// turned into a SERVFAIL.
+func TestParseRejectsAsyncStatusUpdateWithFailOnUpdateError(t *testing.T) {
+	input := `dnsnameresolver {
+    asyncStatusUpdate
+    failOnUpdateError
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with asyncStatusUpdate and failOnUpdateError = nil error, want an error")
+	}
+}
+
+// TestParsePersistSchedulerStateRequiresBothArgs verifies that
+// persistSchedulerState needs both a namespace and a ConfigMap name,
+// since the plugin has no default of its own to fall back to.
+func TestParsePersistSchedulerStateRequiresBothArgs(t *testing.T) {
+	input := `dnsnameresolver {
+    persistSchedulerState openshift-dns
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with persistSchedulerState given one arg = nil error, want an error")
+	}
+}
+
+// TestParsePersistSchedulerState verifies persistSchedulerState's two
+// arguments land on the plugin as its ConfigMap namespace and name.
+func TestParsePersistSchedulerState(t *testing.T) {
+	input := `dnsnameresolver {
+    persistSchedulerState openshift-dns dnsnameresolver-scheduler-state
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if h.schedulerStateNamespace != "openshift-dns" || h.schedulerStateConfigMapName != "dnsnameresolver-scheduler-state" {
+		t.Errorf("persistSchedulerState parsed as namespace %q, name %q, want %q, %q",
+			h.schedulerStateNamespace, h.schedulerStateConfigMapName, "openshift-dns", "dnsnameresolver-scheduler-state")
+	}
+}
+
+// TestParseRejectsInvalidClientCIDR verifies that a clientCIDRs entry
+// that isn't a valid CIDR is a Corefile error rather than a silently
+// ignored (or panicking) setting.
+func TestParseRejectsInvalidClientCIDR(t *testing.T) {
+	input := `dnsnameresolver {
+    clientCIDRs not-a-cidr
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with an invalid clientCIDRs entry = nil error, want an error")
+	}
+}
+
+// TestParseClientCIDRs verifies clientCIDRs' arguments are parsed into
+// compiled net.IPNet entries on the plugin.
+func TestParseClientCIDRs(t *testing.T) {
+	input := `dnsnameresolver {
+    clientCIDRs 10.128.0.0/14 fd01::/48
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if len(h.clientCIDRs) != 2 {
+		t.Fatalf("parse() produced %d clientCIDRs entries, want 2: %v", len(h.clientCIDRs), h.clientCIDRs)
+	}
+	if h.clientCIDRs[0].String() != "10.128.0.0/14" || h.clientCIDRs[1].String() != "fd01::/48" {
+		t.Errorf("clientCIDRs = %v, want [10.128.0.0/14 fd01::/48]", h.clientCIDRs)
+	}
+}
+
+// TestParseRequireAuthoritative verifies the requireAuthoritative
+// directive takes no arguments and sets the flag on the handler.
+func TestParseRequireAuthoritative(t *testing.T) {
+	input := `dnsnameresolver {
+    requireAuthoritative
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if !h.requireAuthoritative {
+		t.Error("requireAuthoritative = false, want true")
+	}
+
+	input = `dnsnameresolver {
+    requireAuthoritative on
+}`
+	c = caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() error = nil, want error for requireAuthoritative with an argument")
+	}
+}
+
+// TestParseIPFilterExcludeList verifies ipFilter excludeList parses into
+// an ipFilterFunc that drops the listed addresses.
+func TestParseIPFilterExcludeList(t *testing.T) {
+	input := `dnsnameresolver {
+    ipFilter excludeList 10.0.0.1 10.0.0.2
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if len(h.ipFilters) != 1 {
+		t.Fatalf("parse() produced %d ipFilters, want 1", len(h.ipFilters))
+	}
+	got := h.ipFilters[0](map[string]ipTTL{
+		"10.0.0.1": {ip: "10.0.0.1", ttl: 30},
+		"10.0.0.3": {ip: "10.0.0.3", ttl: 30},
+	})
+	if _, excluded := got["10.0.0.1"]; excluded {
+		t.Error("ipFilter excludeList kept an excluded address")
+	}
+	if _, kept := got["10.0.0.3"]; !kept {
+		t.Error("ipFilter excludeList dropped an address that wasn't listed")
+	}
+}
+
+// TestParseIPFilterRejectsInvalidEntry verifies a non-IP excludeList
+// argument is a Corefile error.
+func TestParseIPFilterRejectsInvalidEntry(t *testing.T) {
+	input := `dnsnameresolver {
+    ipFilter excludeList not-an-ip
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with an invalid ipFilter excludeList entry = nil error, want an error")
+	}
+}
+
+// TestParseIPFilterRejectsUnknownHook verifies an unrecognized ipFilter
+// hook name is a Corefile error rather than silently doing nothing.
+func TestParseIPFilterRejectsUnknownHook(t *testing.T) {
+	input := `dnsnameresolver {
+    ipFilter bogus
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with an unknown ipFilter hook = nil error, want an error")
+	}
+}
+
+// TestParseDisableWildcards verifies the disableWildcards directive takes
+// no arguments and sets the plugin's disableWildcards field.
+func TestParseDisableWildcards(t *testing.T) {
+	input := `dnsnameresolver {
+    disableWildcards
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if !h.disableWildcards {
+		t.Error("disableWildcards = false after parsing the disableWildcards directive, want true")
+	}
+}
+
+// TestParseDisableWildcardsRejectsArgs verifies disableWildcards takes no
+// arguments, matching every other bare-flag directive in this file.
+func TestParseDisableWildcardsRejectsArgs(t *testing.T) {
+	input := `dnsnameresolver {
+    disableWildcards on
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with disableWildcards given an argument = nil error, want an error")
+	}
+}
+
+// TestParseTTLRounding verifies ttlRounding's argument is parsed as the
+// plugin's rounding granularity in seconds.
+func TestParseTTLRounding(t *testing.T) {
+	input := `dnsnameresolver {
+    ttlRounding 5
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if h.ttlRoundingSeconds != 5 {
+		t.Errorf("ttlRoundingSeconds = %d, want 5", h.ttlRoundingSeconds)
+	}
+}
+
+// TestParseTTLRoundingRejectsNonPositive verifies that ttlRounding
+// requires a positive granularity, since 0 or negative wouldn't round to
+// anything meaningful.
+func TestParseTTLRoundingRejectsNonPositive(t *testing.T) {
+	for _, val := range []string{"0", "-5", "not-a-number"} {
+		input := `dnsnameresolver {
+    ttlRounding ` + val + `
+}`
+		c := caddy.NewTestController("dns", input)
+		if _, err := parse(c); err == nil {
+			t.Errorf("parse() with ttlRounding %q = nil error, want an error", val)
+		}
+	}
+}
+
+// TestParseFamilyOrder verifies familyOrder's argument is parsed onto the
+// plugin, and that only its two recognized values are accepted.
+func TestParseFamilyOrder(t *testing.T) {
+	for _, val := range []string{"v4first", "v6first"} {
+		input := `dnsnameresolver {
+    familyOrder ` + val + `
+}`
+		c := caddy.NewTestController("dns", input)
+		h, err := parse(c)
+		if err != nil {
+			t.Fatalf("parse() error = %v", err)
+		}
+		if h.familyOrder != val {
+			t.Errorf("familyOrder = %q, want %q", h.familyOrder, val)
+		}
+	}
+}
+
+// TestParseFamilyOrderRejectsInvalidValue verifies familyOrder rejects
+// anything other than v4first/v6first.
+func TestParseFamilyOrderRejectsInvalidValue(t *testing.T) {
+	input := `dnsnameresolver {
+    familyOrder sideways
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with an invalid familyOrder = nil error, want an error")
+	}
+}
+
+// TestParseManagedBySelector verifies managedBySelector's argument is
+// parsed into a working label selector.
+func TestParseManagedBySelector(t *testing.T) {
+	input := `dnsnameresolver {
+    managedBySelector app=dnsnameresolver-owner
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if h.managedBySelector == nil {
+		t.Fatal("managedBySelector = nil after parsing the managedBySelector directive")
+	}
+	if !h.managedBySelector.Matches(labels.Set{"app": "dnsnameresolver-owner"}) {
+		t.Error("managedBySelector doesn't match its own configured label")
+	}
+	if h.managedBySelector.Matches(labels.Set{"app": "other"}) {
+		t.Error("managedBySelector matches a label it shouldn't")
+	}
+}
+
+// TestParseManagedBySelectorRejectsInvalidExpression verifies a malformed
+// selector expression is a Corefile error rather than a panic later on.
+func TestParseManagedBySelectorRejectsInvalidExpression(t *testing.T) {
+	input := `dnsnameresolver {
+    managedBySelector ===not-a-selector
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with an invalid managedBySelector = nil error, want an error")
+	}
+}
+
+// TestParseFailureRcodes verifies failureRcodes' arguments are parsed as
+// rcode names or numbers into the plugin's failure set.
+func TestParseFailureRcodes(t *testing.T) {
+	input := `dnsnameresolver {
+    failureRcodes SERVFAIL 5
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if !h.failureRcodes[dns.RcodeServerFailure] || !h.failureRcodes[dns.RcodeRefused] {
+		t.Errorf("failureRcodes = %v, want SERVFAIL (%d) and REFUSED (%d) set", h.failureRcodes, dns.RcodeServerFailure, dns.RcodeRefused)
+	}
+	if len(h.failureRcodes) != 2 {
+		t.Errorf("failureRcodes has %d entries, want 2", len(h.failureRcodes))
+	}
+}
+
+// TestParseFailureRcodesRejectsInvalidEntry verifies that an entry that's
+// neither a known rcode name nor a number is a Corefile error rather than a
+// silently ignored (or panicking) setting.
+func TestParseFailureRcodesRejectsInvalidEntry(t *testing.T) {
+	input := `dnsnameresolver {
+    failureRcodes NOTARCODE
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with an invalid failureRcodes entry = nil error, want an error")
+	}
+}
+
+// TestParseRcodeMessages verifies rcodeMessages' name/number, message
+// pairs are parsed onto the plugin's override map.
+func TestParseRcodeMessages(t *testing.T) {
+	input := `dnsnameresolver {
+    rcodeMessages SERVFAIL upstream-failure 5 upstream-refused
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	want := map[int]string{dns.RcodeServerFailure: "upstream-failure", dns.RcodeRefused: "upstream-refused"}
+	if !reflect.DeepEqual(h.rcodeMessages, want) {
+		t.Errorf("rcodeMessages = %v, want %v", h.rcodeMessages, want)
+	}
+}
+
+// TestParseRcodeMessagesRejectsInvalidArgs verifies rcodeMessages rejects
+// an odd number of arguments and an entry that's neither a known rcode
+// name nor a number.
+func TestParseRcodeMessagesRejectsInvalidArgs(t *testing.T) {
+	for _, args := range []string{"", "SERVFAIL", "NOTARCODE upstream-failure"} {
+		input := `dnsnameresolver {
+    rcodeMessages ` + args + `
+}`
+		c := caddy.NewTestController("dns", input)
+		if _, err := parse(c); err == nil {
+			t.Errorf("parse() with rcodeMessages %q = nil error, want an error", args)
+		}
+	}
+}
+
+func TestParseAPIVersionAcceptsSupportedVersion(t *testing.T) {
+	input := `dnsnameresolver {
+    apiVersion network.openshift.io/v1alpha1
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if h.apiVersion != supportedAPIVersion {
+		t.Errorf("apiVersion = %q, want %q", h.apiVersion, supportedAPIVersion)
+	}
+}
+
+func TestParseAPIVersionRejectsUnsupportedVersion(t *testing.T) {
+	input := `dnsnameresolver {
+    apiVersion network.openshift.io/v1beta1
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with an unsupported apiVersion = nil error, want an error")
+	}
+}
+
+func TestParseInstanceAnnotation(t *testing.T) {
+	input := `dnsnameresolver {
+    instanceAnnotation network.openshift.io/updated-by
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if h.instanceAnnotationKey != "network.openshift.io/updated-by" {
+		t.Errorf("instanceAnnotationKey = %q, want %q", h.instanceAnnotationKey, "network.openshift.io/updated-by")
+	}
+}
+
+func TestParseMaxStatusBytes(t *testing.T) {
+	input := `dnsnameresolver {
+    maxStatusBytes 4096
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if h.maxStatusBytes != 4096 {
+		t.Errorf("maxStatusBytes = %d, want 4096", h.maxStatusBytes)
+	}
+}
+
+func TestParseMaxStatusBytesRejectsNonPositive(t *testing.T) {
+	input := `dnsnameresolver {
+    maxStatusBytes 0
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with maxStatusBytes 0 = nil error, want an error")
+	}
+}
+
+func TestParseNodataCountsAsFailure(t *testing.T) {
+	input := `dnsnameresolver {
+    nodataCountsAsFailure
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if !h.nodataCountsAsFailure {
+		t.Error("nodataCountsAsFailure = false, want true")
+	}
+}
+
+func TestParseExportPath(t *testing.T) {
+	input := `dnsnameresolver {
+    exportPath /var/run/dnsnameresolver/export.json
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if h.exportPath != "/var/run/dnsnameresolver/export.json" {
+		t.Errorf("exportPath = %q, want %q", h.exportPath, "/var/run/dnsnameresolver/export.json")
+	}
+}
+
+func TestParseExportPathRejectsWrongArgCount(t *testing.T) {
+	input := `dnsnameresolver {
+    exportPath
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Error("parse() error = nil, want error for exportPath with no argument")
+	}
+}
+
+func TestParseFailureThreshold(t *testing.T) {
+	input := `dnsnameresolver {
+    failureThreshold 3
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if h.failureThreshold != 3 {
+		t.Errorf("failureThreshold = %d, want 3", h.failureThreshold)
+	}
+}
+
+func TestParseFailureThresholdRejectsNonPositive(t *testing.T) {
+	input := `dnsnameresolver {
+    failureThreshold 0
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Fatal("parse() with failureThreshold 0 = nil error, want an error")
+	}
+}
+
+func TestParseRequireRecursionDesired(t *testing.T) {
+	input := `dnsnameresolver {
+    requireRecursionDesired
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if !h.requireRecursionDesired {
+		t.Error("requireRecursionDesired = false, want true")
+	}
+}
+
+func TestParseRequireRecursionDesiredRejectsArgs(t *testing.T) {
+	input := `dnsnameresolver {
+    requireRecursionDesired on
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Error("parse() error = nil, want error for requireRecursionDesired with an argument")
+	}
+}
+
+func TestParseDedupeResolvedAddresses(t *testing.T) {
+	input := `dnsnameresolver {
+    dedupeResolvedAddresses
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if !h.dedupeResolvedAddresses {
+		t.Error("dedupeResolvedAddresses = false, want true")
+	}
+}
+
+func TestParseDedupeResolvedAddressesRejectsArgs(t *testing.T) {
+	input := `dnsnameresolver {
+    dedupeResolvedAddresses on
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Error("parse() error = nil, want error for dedupeResolvedAddresses with an argument")
+	}
+}
+
+func TestParseTrackPTR(t *testing.T) {
+	input := `dnsnameresolver {
+    trackPTR
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if !h.trackPTR {
+		t.Error("trackPTR = false, want true")
+	}
+}
+
+func TestParseTrackPTRRejectsArgs(t *testing.T) {
+	input := `dnsnameresolver {
+    trackPTR on
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Error("parse() error = nil, want error for trackPTR with an argument")
+	}
+}
+
+// TestParseZeroTTLPolicy verifies each of zeroTTLPolicy's four modes
+// parses onto the plugin, with the minimum TTL argument required (and
+// stored) for floor and storeVolatile and rejected for store and skip.
+func TestParseZeroTTLPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		minimum uint32
+	}{
+		{zeroTTLPolicyStore, 0},
+		{zeroTTLPolicySkip, 0},
+		{zeroTTLPolicyFloor, 30},
+		{zeroTTLPolicyStoreVolatile, 30},
+	}
+	for _, tt := range tests {
+		args := tt.policy
+		if tt.minimum != 0 {
+			args += " 30"
+		}
+		input := `dnsnameresolver {
+    zeroTTLPolicy ` + args + `
+}`
+		c := caddy.NewTestController("dns", input)
+		h, err := parse(c)
+		if err != nil {
+			t.Fatalf("parse() with zeroTTLPolicy %q error = %v", args, err)
+		}
+		if h.zeroTTLPolicy != tt.policy {
+			t.Errorf("zeroTTLPolicy = %q, want %q", h.zeroTTLPolicy, tt.policy)
+		}
+		if h.zeroTTLMinimum != tt.minimum {
+			t.Errorf("zeroTTLMinimum = %d, want %d", h.zeroTTLMinimum, tt.minimum)
+		}
+	}
+}
+
+// TestParseZeroTTLPolicyRejectsInvalidArgs verifies zeroTTLPolicy rejects
+// an unknown mode, floor/storeVolatile missing their minimum TTL, and
+// store/skip given one they don't accept.
+func TestParseZeroTTLPolicyRejectsInvalidArgs(t *testing.T) {
+	for _, args := range []string{"bogus", "floor", "storeVolatile", "floor -5", "floor not-a-number", "store 30", "skip 30"} {
+		input := `dnsnameresolver {
+    zeroTTLPolicy ` + args + `
+}`
+		c := caddy.NewTestController("dns", input)
+		if _, err := parse(c); err == nil {
+			t.Errorf("parse() with zeroTTLPolicy %q = nil error, want an error", args)
+		}
+	}
+}
+
+// TestParseMaxAddressAge verifies maxAddressAge parses its duration
+// argument onto the plugin.
+func TestParseMaxAddressAge(t *testing.T) {
+	input := `dnsnameresolver {
+    maxAddressAge 720h
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if want := 720 * time.Hour; h.maxAddressAge != want {
+		t.Errorf("maxAddressAge = %v, want %v", h.maxAddressAge, want)
+	}
+}
+
+// TestParseMaxAddressAgeRejectsInvalidArgs verifies maxAddressAge rejects
+// a missing argument, an unparseable duration, and a non-positive one.
+func TestParseMaxAddressAgeRejectsInvalidArgs(t *testing.T) {
+	for _, args := range []string{"", "not-a-duration", "0h", "-1h"} {
+		input := `dnsnameresolver {
+    maxAddressAge ` + args + `
+}`
+		c := caddy.NewTestController("dns", input)
+		if _, err := parse(c); err == nil {
+			t.Errorf("parse() with maxAddressAge %q = nil error, want an error", args)
+		}
+	}
+}
+
+// TestParseProcessingBudget verifies processingBudget parses its
+// duration argument onto the plugin.
+func TestParseProcessingBudget(t *testing.T) {
+	input := `dnsnameresolver {
+    processingBudget 50ms
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if want := 50 * time.Millisecond; h.processingBudget != want {
+		t.Errorf("processingBudget = %v, want %v", h.processingBudget, want)
+	}
+}
+
+// TestParseProcessingBudgetRejectsInvalidArgs verifies processingBudget
+// rejects a missing argument, an unparseable duration, and a
+// non-positive one.
+func TestParseProcessingBudgetRejectsInvalidArgs(t *testing.T) {
+	for _, args := range []string{"", "not-a-duration", "0ms", "-1ms"} {
+		input := `dnsnameresolver {
+    processingBudget ` + args + `
+}`
+		c := caddy.NewTestController("dns", input)
+		if _, err := parse(c); err == nil {
+			t.Errorf("parse() with processingBudget %q = nil error, want an error", args)
+		}
+	}
+}
+
+// TestParseZones verifies zones' arguments are lowercased, fully
+// qualified, and parsed onto the plugin.
+func TestParseZones(t *testing.T) {
+	input := `dnsnameresolver {
+    zones Example.COM example.org
+}`
+
+	c := caddy.NewTestController("dns", input)
+	h, err := parse(c)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	want := []string{"example.com.", "example.org."}
+	if len(h.zones) != len(want) {
+		t.Fatalf("zones = %v, want %v", h.zones, want)
+	}
+	for i, zone := range want {
+		if h.zones[i] != zone {
+			t.Errorf("zones[%d] = %q, want %q", i, h.zones[i], zone)
+		}
+	}
+}
+
+// TestParseZonesRejectsMissingArgs verifies zones requires at least one
+// zone argument.
+func TestParseZonesRejectsMissingArgs(t *testing.T) {
+	input := `dnsnameresolver {
+    zones
+}`
+
+	c := caddy.NewTestController("dns", input)
+	if _, err := parse(c); err == nil {
+		t.Error("parse() error = nil, want error for zones with no arguments")
+	}
+}
+
+// TestManagerOptionsLeaderElection verifies that --leader-election-id and
+// --enable-leader-election flow into the ctrl.Options newManager builds
+// its manager from, without requiring a real manager (and therefore a
+// live apiserver) to do so.
+func TestManagerOptionsLeaderElection(t *testing.T) {
+	origID, origEnabled := leaderElectionID, enableLeaderElection
+	defer func() { leaderElectionID, enableLeaderElection = origID, origEnabled }()
+
+	leaderElectionID = "test-lease.openshift.io"
+	enableLeaderElection = true
+
+	opts := managerOptions(scheme.Scheme)
+	if !opts.LeaderElection {
+		t.Error("managerOptions().LeaderElection = false, want true")
+	}
+	if opts.LeaderElectionID != "test-lease.openshift.io" {
+		t.Errorf("managerOptions().LeaderElectionID = %q, want %q", opts.LeaderElectionID, "test-lease.openshift.io")
+	}
+}
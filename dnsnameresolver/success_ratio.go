@@ -0,0 +1,78 @@
+package dnsnameresolver
+
+import (
+	"flag"
+	"sync"
+)
+
+// successRatioWindowSize bounds how many recent resolution outcomes are
+// kept per DNS name to compute its rolling success ratio, exposed via
+// OCPDNSNameResolver.ResolutionSuccessRatio and the
+// ocp_dnsnameresolver_success_ratio metric, to answer "which names are
+// flaky" for SLO reporting.
+var successRatioWindowSize int
+
+func init() {
+	flag.IntVar(&successRatioWindowSize, "success-ratio-window-size", 20,
+		"Number of recent resolution outcomes kept per DNS name to compute its rolling success ratio.")
+}
+
+// successRatioTracker is a fixed-capacity, per-name ring buffer of recent
+// resolution outcomes (true meaning success), capped live against
+// successRatioWindowSize rather than a size captured at construction, so
+// --success-ratio-window-size behaves the same way the plugin's other
+// flags do in tests.
+type successRatioTracker struct {
+	mu      sync.Mutex
+	entries map[string][]bool
+}
+
+func newSuccessRatioTracker() *successRatioTracker {
+	return &successRatioTracker{entries: make(map[string][]bool)}
+}
+
+// record appends a resolution outcome for dnsName, trimming the oldest
+// entries once successRatioWindowSize is exceeded, and updates dnsName's
+// success ratio gauge to match.
+func (t *successRatioTracker) record(dnsName string, success bool) {
+	if successRatioWindowSize <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	outcomes := append(t.entries[dnsName], success)
+	if len(outcomes) > successRatioWindowSize {
+		outcomes = outcomes[len(outcomes)-successRatioWindowSize:]
+	}
+	t.entries[dnsName] = outcomes
+
+	successRatio.WithLabelValues(dnsName).Set(ratioOf(outcomes))
+}
+
+// successRatio returns dnsName's rolling resolution success ratio over
+// its most recent --success-ratio-window-size observations, and whether
+// any observations have been recorded yet.
+func (t *successRatioTracker) successRatio(dnsName string) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	outcomes, ok := t.entries[dnsName]
+	if !ok {
+		return 0, false
+	}
+	return ratioOf(outcomes), true
+}
+
+// ratioOf returns the fraction of outcomes that are true.
+func ratioOf(outcomes []bool) float64 {
+	if len(outcomes) == 0 {
+		return 0
+	}
+	var successes int
+	for _, o := range outcomes {
+		if o {
+			successes++
+		}
+	}
+	return float64(successes) / float64(len(outcomes))
+}
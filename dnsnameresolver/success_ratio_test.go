@@ -0,0 +1,50 @@
+package dnsnameresolver
+
+import "testing"
+
+func TestSuccessRatioTrackerComputesRollingRatio(t *testing.T) {
+	old := successRatioWindowSize
+	defer func() { successRatioWindowSize = old }()
+	successRatioWindowSize = 4
+
+	tr := newSuccessRatioTracker()
+	tr.record("example.com.", true)
+	tr.record("example.com.", true)
+	tr.record("example.com.", false)
+	tr.record("example.com.", true)
+
+	got, ok := tr.successRatio("example.com.")
+	if !ok {
+		t.Fatal("successRatio() ok = false, want true after recording observations")
+	}
+	if got != 0.75 {
+		t.Fatalf("successRatio() = %v, want 0.75 (3 successes out of 4)", got)
+	}
+
+	// A fifth observation pushes the oldest (a success) out of the
+	// window, so the ratio recomputes over just the most recent 4.
+	tr.record("example.com.", false)
+	if got, _ := tr.successRatio("example.com."); got != 0.5 {
+		t.Fatalf("successRatio() after window rolled = %v, want 0.5 (2 successes out of 4)", got)
+	}
+}
+
+func TestSuccessRatioTrackerUnknownNameNotOK(t *testing.T) {
+	tr := newSuccessRatioTracker()
+	if _, ok := tr.successRatio("example.com."); ok {
+		t.Fatal("successRatio() ok = true for a name with no recorded observations, want false")
+	}
+}
+
+func TestSuccessRatioTrackerDisabledWhenWindowSizeZero(t *testing.T) {
+	old := successRatioWindowSize
+	defer func() { successRatioWindowSize = old }()
+	successRatioWindowSize = 0
+
+	tr := newSuccessRatioTracker()
+	tr.record("example.com.", true)
+
+	if _, ok := tr.successRatio("example.com."); ok {
+		t.Fatal("successRatio() ok = true while successRatioWindowSize is 0, want false")
+	}
+}
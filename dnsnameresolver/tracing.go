@@ -0,0 +1,85 @@
+package dnsnameresolver
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+// otlpEndpoint holds the --otlp-endpoint value. This plugin carries no
+// OpenTelemetry SDK dependency and no OTLP exporter: nothing reads
+// otlpEndpoint, and completed spans go only to spanExporter (see
+// exportSpan), which is nil by default.
+var otlpEndpoint string
+
+func init() {
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"OTLP endpoint for completed tracing spans (see the tracing directive). The plugin has no OTLP exporter and does not send spans to this endpoint.")
+}
+
+// span is a minimal, dependency-free stand-in for an OpenTelemetry span:
+// a named interval with attributes and child spans, built to be cheap
+// enough to construct unconditionally and safe to call on a nil
+// receiver so instrumented code doesn't need a tracingEnabled check at
+// every call site.
+type span struct {
+	mu         sync.Mutex
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	children   []*span
+}
+
+// newSpan starts a new root span named name.
+func newSpan(name string) *span {
+	return &span{name: name, start: time.Now(), attributes: make(map[string]string)}
+}
+
+// child starts a new span named name as a child of s, or does nothing
+// (returning nil) if s is nil, so a call chain that never had tracing
+// enabled stays a no-op all the way down.
+func (s *span) child(name string) *span {
+	if s == nil {
+		return nil
+	}
+	c := newSpan(name)
+	s.mu.Lock()
+	s.children = append(s.children, c)
+	s.mu.Unlock()
+	return c
+}
+
+// SetAttribute records key/value on s. A nil receiver is a no-op.
+func (s *span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// End marks s complete. A nil receiver is a no-op.
+func (s *span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	s.mu.Unlock()
+}
+
+// spanExporter, when set, receives every root span (one per traced
+// ServeDNS call) once it's ended, with its full child hierarchy already
+// attached. It's nil by default, meaning spans are simply discarded once
+// built; tests override it to inspect the recorded hierarchy the way an
+// in-memory OpenTelemetry span exporter would.
+var spanExporter func(*span)
+
+// exportSpan hands root to spanExporter, if one is set.
+func exportSpan(root *span) {
+	if spanExporter != nil {
+		spanExporter(root)
+	}
+}
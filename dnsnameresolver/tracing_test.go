@@ -0,0 +1,132 @@
+package dnsnameresolver
+
+import (
+	"context"
+	"testing"
+
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+)
+
+// spanNames returns the names of root and every span reachable from it,
+// in a depth-first order, for tests that want to assert on the recorded
+// hierarchy's shape without walking it by hand.
+func spanNames(root *span) []string {
+	if root == nil {
+		return nil
+	}
+	names := []string{root.name}
+	for _, c := range root.children {
+		names = append(names, spanNames(c)...)
+	}
+	return names
+}
+
+// TestServeDNSTracingRecordsSpanHierarchy verifies that with tracing
+// enabled, ServeDNS exports a root span with the expected child spans and
+// attributes attached, using spanExporter as an in-memory recorder the
+// way an OpenTelemetry in-memory span exporter would be used in a test.
+func TestServeDNSTracingRecordsSpanHierarchy(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.tracingEnabled = true
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	var got *span
+	old := spanExporter
+	spanExporter = func(root *span) { got = root }
+	defer func() { spanExporter = old }()
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	if got == nil {
+		t.Fatal("spanExporter was never called")
+	}
+	if got.name != "ServeDNS" {
+		t.Errorf("root span name = %q, want %q", got.name, "ServeDNS")
+	}
+	if qname := got.attributes["qname"]; qname != "foo.example.com." {
+		t.Errorf("root span qname attribute = %q, want %q", qname, "foo.example.com.")
+	}
+	if rcode := got.attributes["rcode"]; rcode != "NOERROR" {
+		t.Errorf("root span rcode attribute = %q, want %q", rcode, "NOERROR")
+	}
+
+	names := spanNames(got)
+	want := map[string]bool{"chain": false, "statusUpdateFanout": false, "namespaceUpdate": false, "updateStatus": false}
+	for _, name := range names {
+		if _, ok := want[name]; ok {
+			want[name] = true
+		}
+	}
+	for name, found := range want {
+		if !found {
+			t.Errorf("span hierarchy %v missing expected span %q", names, name)
+		}
+	}
+
+	updateSpan := findSpan(got, "updateStatus")
+	if updateSpan == nil {
+		t.Fatal("no updateStatus span found in the recorded hierarchy")
+	}
+	if ns := updateSpan.attributes["namespace"]; ns != "ns1" {
+		t.Errorf("updateStatus span namespace attribute = %q, want %q", ns, "ns1")
+	}
+}
+
+// findSpan returns the first span named name found by a depth-first
+// search of root's hierarchy, or nil if none matches.
+func findSpan(root *span, name string) *span {
+	if root == nil {
+		return nil
+	}
+	if root.name == name {
+		return root
+	}
+	for _, c := range root.children {
+		if found := findSpan(c, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// TestServeDNSTracingDisabledDoesNotExport verifies that with tracing
+// off (the default), no span is ever handed to spanExporter.
+func TestServeDNSTracingDisabledDoesNotExport(t *testing.T) {
+	resolverObj := &networkv1alpha1.DNSNameResolver{}
+	resolverObj.Namespace, resolverObj.Name = "ns1", "obj1"
+	fakeClient := fake.NewClientBuilder().WithObjects(resolverObj).WithStatusSubresource(resolverObj).Build()
+
+	h := New()
+	h.client = fakeClient
+	h.addOrUpdateObject("ns1", "obj1", "foo.example.com.", false)
+	h.Next = aAnswerHandler{qname: "foo.example.com."}
+
+	called := false
+	old := spanExporter
+	spanExporter = func(root *span) { called = true }
+	defer func() { spanExporter = old }()
+
+	r := new(dns.Msg)
+	r.SetQuestion("foo.example.com.", dns.TypeA)
+	if _, err := h.ServeDNS(context.Background(), &test.ResponseWriter{}, r); err != nil {
+		t.Fatalf("ServeDNS() returned error: %v", err)
+	}
+
+	if called {
+		t.Error("spanExporter was called with tracing disabled")
+	}
+}
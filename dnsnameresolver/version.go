@@ -0,0 +1,14 @@
+package dnsnameresolver
+
+// version and commit identify the running plugin build; they're populated
+// at build time via -ldflags, e.g.:
+//
+//	-X github.com/openshift/coredns-ocp-dnsnameresolver/dnsnameresolver.version=v1.2.3
+//	-X github.com/openshift/coredns-ocp-dnsnameresolver/dnsnameresolver.commit=abcdef0
+//
+// Both default to "unknown" for a build that doesn't set them, such as
+// `go test` or a local `go build` without ldflags.
+var (
+	version = "unknown"
+	commit  = "unknown"
+)
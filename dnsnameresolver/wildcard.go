@@ -0,0 +1,41 @@
+package dnsnameresolver
+
+import "strings"
+
+// getWildcard reports whether qname falls under a wildcard DNS name of the
+// form "*.example.com." and, if so, returns that wildcard name. qname is
+// expected to be a fully qualified, lower-cased domain name; a dotless
+// name (e.g. "localhost") or the bare root "." safely reports ("", false)
+// rather than panicking, since IndexByte's -1 and "dot is the last byte"
+// are both checked below before qname is sliced.
+func getWildcard(qname string) (string, bool) {
+	i := strings.IndexByte(qname, '.')
+	if i < 0 || i == len(qname)-1 {
+		return "", false
+	}
+	return "*" + qname[i:], true
+}
+
+// getWildcardCandidates returns every wildcard name that could cover
+// qname, ordered from most to least specific: "*.sub.example.com.", then
+// "*.example.com.", and so on. Unlike getWildcard, which only reports the
+// immediate-parent wildcard, this lets a caller check every ancestor
+// level a DNSNameResolver object could have registered a wildcard under,
+// so that when more than one does (e.g. both "*.sub.example.com." and
+// "*.example.com." are tracked), the caller can pick the most specific
+// one that actually matches instead of only ever considering the
+// nearest.
+func getWildcardCandidates(qname string) []string {
+	var candidates []string
+	rest := qname
+	for {
+		wildcard, ok := getWildcard(rest)
+		if !ok {
+			break
+		}
+		candidates = append(candidates, wildcard)
+		i := strings.IndexByte(rest, '.')
+		rest = rest[i+1:]
+	}
+	return candidates
+}
@@ -0,0 +1,73 @@
+package dnsnameresolver
+
+import "testing"
+
+func TestGetWildcard(t *testing.T) {
+	tests := []struct {
+		qname    string
+		wildcard string
+		ok       bool
+	}{
+		{"foo.example.com.", "*.example.com.", true},
+		{"example.com.", "*.com.", true},
+		{"com.", "", false},
+		{".", "", false},
+	}
+
+	for _, tt := range tests {
+		wildcard, ok := getWildcard(tt.qname)
+		if ok != tt.ok || wildcard != tt.wildcard {
+			t.Errorf("getWildcard(%q) = (%q, %v), want (%q, %v)", tt.qname, wildcard, ok, tt.wildcard, tt.ok)
+		}
+	}
+}
+
+func TestGetWildcardCandidates(t *testing.T) {
+	tests := []struct {
+		qname string
+		want  []string
+	}{
+		{"foo.sub.example.com.", []string{"*.sub.example.com.", "*.example.com.", "*.com."}},
+		{"foo.example.com.", []string{"*.example.com.", "*.com."}},
+		{"com.", nil},
+		{".", nil},
+	}
+
+	for _, tt := range tests {
+		got := getWildcardCandidates(tt.qname)
+		if len(got) != len(tt.want) {
+			t.Errorf("getWildcardCandidates(%q) = %v, want %v", tt.qname, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("getWildcardCandidates(%q) = %v, want %v", tt.qname, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// FuzzGetWildcard exercises getWildcard with arbitrary input, including
+// dotless names, already-wildcard names, and other malformed input a
+// well-formed DNS message shouldn't produce but a caller could still
+// pass in. getWildcard must never panic.
+func FuzzGetWildcard(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		".",
+		"localhost",
+		"foo.example.com.",
+		"*.example.com.",
+		"*.*.example.com.",
+		"..",
+		".example.com.",
+		"com.",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, qname string) {
+		getWildcard(qname)
+	})
+}
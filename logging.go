@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var (
+	logLevel  string
+	logFormat string
+)
+
+// bindLogFlags registers the convenience --log-level/--log-format flags
+// so operators don't need to know the underlying zap flag names to get
+// production-ready JSON logging.
+func bindLogFlags() {
+	flag.StringVar(&logLevel, "log-level", "info", "Log level: debug, info, warn, or error.")
+	flag.StringVar(&logFormat, "log-format", "json", "Log format: json or console.")
+}
+
+// applyLogFlags maps level and format onto the zap.Options used to build
+// the controller-runtime logger.
+func applyLogFlags(opts *zap.Options, level, format string) error {
+	var zapLevel zapcore.Level
+	if err := zapLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log-level %q: %w", level, err)
+	}
+	opts.Level = zapLevel
+
+	switch format {
+	case "json":
+		opts.Development = false
+	case "console":
+		opts.Development = true
+	default:
+		return fmt.Errorf("invalid log-format %q: must be %q or %q", format, "json", "console")
+	}
+	return nil
+}
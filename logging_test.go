@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestApplyLogFlags(t *testing.T) {
+	tests := []struct {
+		level       string
+		format      string
+		wantDev     bool
+		wantZapcore zapcore.Level
+		wantErr     bool
+	}{
+		{"info", "json", false, zapcore.InfoLevel, false},
+		{"debug", "console", true, zapcore.DebugLevel, false},
+		{"warn", "json", false, zapcore.WarnLevel, false},
+		{"bogus", "json", false, 0, true},
+		{"info", "bogus", false, 0, true},
+	}
+
+	for _, tt := range tests {
+		opts := &zap.Options{}
+		err := applyLogFlags(opts, tt.level, tt.format)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("applyLogFlags(%q, %q) error = %v, wantErr %v", tt.level, tt.format, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if opts.Development != tt.wantDev {
+			t.Errorf("applyLogFlags(%q, %q) Development = %v, want %v", tt.level, tt.format, opts.Development, tt.wantDev)
+		}
+		if opts.Level != tt.wantZapcore {
+			t.Errorf("applyLogFlags(%q, %q) Level = %v, want %v", tt.level, tt.format, opts.Level, tt.wantZapcore)
+		}
+	}
+}
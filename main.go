@@ -0,0 +1,34 @@
+// Command coredns-ocp-dnsnameresolver builds a CoreDNS server with the
+// dnsnameresolver plugin registered. The plugin keeps DNSNameResolver
+// objects in sync with DNS resolution results observed by this server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/coredns/coredns/coremain"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	_ "github.com/openshift/coredns-ocp-dnsnameresolver/dnsnameresolver"
+)
+
+func init() {
+	zapOpts := zap.Options{Development: true}
+	bindLogFlags()
+	zapOpts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := applyLogFlags(&zapOpts, logLevel, logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&zapOpts)))
+}
+
+func main() {
+	coremain.Run()
+}
@@ -0,0 +1,25 @@
+// Package manifests validates the API manifests this binary carries.
+//
+// This repository does not embed or apply a CRD manifest at runtime: the
+// DNSNameResolver CustomResourceDefinition is installed by the OpenShift
+// cluster network operator, not by this plugin, so there is no
+// manifests.DNSNameResolverCRD()/ensureDNSNameResolverCRD() decode-and-apply
+// path to guard here. What this binary does carry is the compiled-in
+// networkv1alpha1 Go API types it registers into a controller-runtime
+// scheme in dnsnameresolver.newManager. Validate exercises that
+// registration the same way newManager does, so a broken type
+// registration is caught by a build/test-time check rather than surfacing
+// only as a startup failure.
+package manifests
+
+import (
+	networkv1alpha1 "github.com/openshift/api/network/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Validate registers every API manifest this binary ships into a scratch
+// scheme and returns the first error encountered, instead of leaving that
+// failure to surface only when newManager builds its real scheme.
+func Validate() error {
+	return networkv1alpha1.Install(runtime.NewScheme())
+}
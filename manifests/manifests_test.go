@@ -0,0 +1,12 @@
+package manifests
+
+import "testing"
+
+// TestValidate asserts the API manifests this binary ships register
+// cleanly, catching a broken type registration here instead of only at
+// manager startup.
+func TestValidate(t *testing.T) {
+	if err := Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}